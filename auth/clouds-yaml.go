@@ -0,0 +1,192 @@
+package auth
+
+import (
+	"fmt"
+	"gopkg.in/yaml.v2"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// cloudConfig is the configuration of a single cloud within a clouds.yaml file.
+type cloudConfig struct {
+	Auth struct {
+		AuthURL           string `yaml:"auth_url"`
+		Username          string `yaml:"username"`
+		UserID            string `yaml:"user_id"`
+		Password          string `yaml:"password"`
+		UserDomainName    string `yaml:"user_domain_name"`
+		UserDomainID      string `yaml:"user_domain_id"`
+		DomainName        string `yaml:"domain_name"`
+		DomainID          string `yaml:"domain_id"`
+		ProjectName       string `yaml:"project_name"`
+		ProjectID         string `yaml:"project_id"`
+		TenantName        string `yaml:"tenant_name"`
+		TenantID          string `yaml:"tenant_id"`
+		ProjectDomainName string `yaml:"project_domain_name"`
+		ProjectDomainID   string `yaml:"project_domain_id"`
+
+		ApplicationCredentialID     string `yaml:"application_credential_id"`
+		ApplicationCredentialName   string `yaml:"application_credential_name"`
+		ApplicationCredentialSecret string `yaml:"application_credential_secret"`
+		TrustID                     string `yaml:"trust_id"`
+	} `yaml:"auth"`
+	RegionName         string `yaml:"region_name"`
+	Interface          string `yaml:"interface"`
+	IdentityAPIVersion string `yaml:"identity_api_version"`
+}
+
+// cloudsConfigDirs returns the directories searched for clouds.yaml and secure.yaml,
+// in order of precedence.
+func cloudsConfigDirs() []string {
+	dirs := []string{"."}
+	if configHome := os.Getenv("XDG_CONFIG_HOME"); configHome != "" {
+		dirs = append(dirs, filepath.Join(configHome, "openstack"))
+	} else if home, err := os.UserHomeDir(); err == nil {
+		dirs = append(dirs, filepath.Join(home, ".config", "openstack"))
+	}
+	return append(dirs, "/etc/openstack")
+}
+
+// readCloudsFile parses the first file that exists out of the file named by the
+// environment variable and the file with the given name in each config directory.
+// It returns a nil map if none of them exist.
+func readCloudsFile(envVar, name string) (map[interface{}]interface{}, error) {
+	candidates := []string{}
+	if path := os.Getenv(envVar); path != "" {
+		candidates = append(candidates, path)
+	}
+	for _, dir := range cloudsConfigDirs() {
+		candidates = append(candidates, filepath.Join(dir, name))
+	}
+	for _, path := range candidates {
+		data, err := ioutil.ReadFile(path)
+		if os.IsNotExist(err) {
+			continue
+		} else if err != nil {
+			return nil, fmt.Errorf("Unable to read %s: %s", path, err)
+		}
+		contents := make(map[interface{}]interface{})
+		if err = yaml.Unmarshal(data, &contents); err != nil {
+			return nil, fmt.Errorf("Unable to parse %s: %s", path, err)
+		}
+		return contents, nil
+	}
+	return nil, nil
+}
+
+// mergeYAML recursively copies the values from src into dst, which is how secure.yaml
+// adds secrets to the clouds defined in clouds.yaml.
+func mergeYAML(dst, src map[interface{}]interface{}) {
+	for key, value := range src {
+		srcMap, srcIsMap := value.(map[interface{}]interface{})
+		dstMap, dstIsMap := dst[key].(map[interface{}]interface{})
+		if srcIsMap && dstIsMap {
+			mergeYAML(dstMap, srcMap)
+		} else {
+			dst[key] = value
+		}
+	}
+}
+
+// loadCloudConfig finds the named cloud within clouds.yaml and secure.yaml.
+func loadCloudConfig(cloudName string) (*cloudConfig, error) {
+	clouds, err := readCloudsFile("OS_CLIENT_CONFIG_FILE", "clouds.yaml")
+	if err != nil {
+		return nil, err
+	} else if clouds == nil {
+		return nil, fmt.Errorf("Unable to find clouds.yaml in any of %v", cloudsConfigDirs())
+	}
+	secure, err := readCloudsFile("OS_CLIENT_SECURE_FILE", "secure.yaml")
+	if err != nil {
+		return nil, err
+	}
+	mergeYAML(clouds, secure)
+
+	allClouds, _ := clouds["clouds"].(map[interface{}]interface{})
+	cloud, exists := allClouds[cloudName]
+	if !exists {
+		return nil, fmt.Errorf("Cloud %s is not defined in clouds.yaml", cloudName)
+	}
+	// Round-trip the merged cloud through YAML to decode it into a cloudConfig
+	var result cloudConfig
+	cloudYAML, err := yaml.Marshal(cloud)
+	if err == nil {
+		err = yaml.Unmarshal(cloudYAML, &result)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("Unable to parse cloud %s in clouds.yaml: %s", cloudName, err)
+	}
+	return &result, nil
+}
+
+// CredentialsFromCloudsYAML reads the Credentials of the named cloud in clouds.yaml.
+// If cloudName is empty, the value of the OS_CLOUD environment variable is used instead.
+//
+// Like the OpenStack command-line tools, it reads the first clouds.yaml that it finds
+// in the current directory, $XDG_CONFIG_HOME/openstack (~/.config/openstack by default),
+// or /etc/openstack, unless OS_CLIENT_CONFIG_FILE names a different file. Values in a
+// secure.yaml found in the same places are merged in, so that passwords can be kept
+// separately.
+func CredentialsFromCloudsYAML(cloudName string) (Credentials, error) {
+	if cloudName == "" {
+		cloudName = os.Getenv("OS_CLOUD")
+	}
+	if cloudName == "" {
+		return Credentials{}, fmt.Errorf("No cloud name was provided and OS_CLOUD is not set")
+	}
+	cloud, err := loadCloudConfig(cloudName)
+	if err != nil {
+		return Credentials{}, err
+	}
+	version, err := parseAuthVersion(cloud.IdentityAPIVersion)
+	if err != nil {
+		return Credentials{}, err
+	}
+	credentials := Credentials{
+		AuthURL:                     cloud.Auth.AuthURL,
+		AuthVersion:                 version,
+		Username:                    cloud.Auth.Username,
+		UserID:                      cloud.Auth.UserID,
+		Password:                    cloud.Auth.Password,
+		UserDomain:                  firstNonEmpty(cloud.Auth.UserDomainName, cloud.Auth.DomainName),
+		UserDomainID:                firstNonEmpty(cloud.Auth.UserDomainID, cloud.Auth.DomainID),
+		Project:                     firstNonEmpty(cloud.Auth.ProjectName, cloud.Auth.TenantName),
+		ProjectID:                   firstNonEmpty(cloud.Auth.ProjectID, cloud.Auth.TenantID),
+		ProjectDomain:               cloud.Auth.ProjectDomainName,
+		ProjectDomainID:             cloud.Auth.ProjectDomainID,
+		ApplicationCredentialID:     cloud.Auth.ApplicationCredentialID,
+		ApplicationCredentialName:   cloud.Auth.ApplicationCredentialName,
+		ApplicationCredentialSecret: cloud.Auth.ApplicationCredentialSecret,
+		TrustID:                     cloud.Auth.TrustID,
+		Region:                      cloud.RegionName,
+		EndpointType:                cloud.Interface,
+	}
+	if credentials.AuthURL == "" {
+		return credentials, fmt.Errorf("Cloud %s has no auth_url", cloudName)
+	}
+	return credentials, nil
+}
+
+// AuthenticateFromCloudsYAML logs in to OpenStack object storage with the credentials
+// of the named cloud in clouds.yaml (see CredentialsFromCloudsYAML).
+//
+// The auth URL does not need to end with the auth version. If it doesn't, the version
+// is taken from identity_api_version, defaulting to 3.
+func AuthenticateFromCloudsYAML(cloudName string, opts ...Option) (Destination, error) {
+	credentials, err := CredentialsFromCloudsYAML(cloudName)
+	if err != nil {
+		return &SwiftDestination{}, err
+	}
+	return AuthenticateWithCredentials(credentials, opts...)
+}
+
+// firstNonEmpty returns the first of its arguments that is not the empty string.
+func firstNonEmpty(values ...string) string {
+	for _, value := range values {
+		if value != "" {
+			return value
+		}
+	}
+	return ""
+}
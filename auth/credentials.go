@@ -0,0 +1,147 @@
+package auth
+
+import (
+	"fmt"
+	"github.com/ncw/swift"
+	"strconv"
+	"strings"
+)
+
+// Credentials describes how to log in to OpenStack object storage. Only AuthURL
+// is always required; which of the other fields are needed depends upon the
+// auth version and the method of authentication.
+//
+// To log in with a password, set Username (or UserID) and Password. With Keystone
+// v3, set UserDomain (or UserDomainID) as well when using Username.
+//
+// To log in with a Keystone v3 application credential, set ApplicationCredentialID
+// and ApplicationCredentialSecret. An application credential may also be identified
+// by ApplicationCredentialName, in which case Username and UserDomain (or UserID)
+// are required to identify its owner. Application credentials are already scoped
+// to a project, so the project fields are ignored.
+//
+// To obtain a token scoped to a Keystone v3 trust, log in as the trustee and set
+// TrustID instead of a project.
+type Credentials struct {
+	// AuthURL is the identity endpoint, such as https://keystone.example.com/v3.
+	// It does not need to end with the auth version.
+	AuthURL string
+	// AuthVersion is 1, 2, or 3. If it is zero, the version at the end of
+	// AuthURL is used, and version 3 is assumed if AuthURL has none.
+	AuthVersion int
+
+	Username     string
+	UserID       string
+	Password     string
+	UserDomain   string
+	UserDomainID string
+
+	Project         string
+	ProjectID       string
+	ProjectDomain   string
+	ProjectDomainID string
+
+	ApplicationCredentialID     string
+	ApplicationCredentialName   string
+	ApplicationCredentialSecret string
+
+	TrustID string
+
+	// Region selects the object-store endpoint of a region in the service
+	// catalog. If it is empty, the first region is used.
+	Region string
+	// EndpointType selects the "public" (default), "internal", or "admin"
+	// object-store endpoint in the service catalog. Use "internal" to send
+	// traffic over a cloud's private network.
+	EndpointType string
+
+	// TokenCache, if set, stores the token from each login so that later logins
+	// with the same credentials can reuse it until it expires or is rejected.
+	// If it is nil, DefaultTokenCache is used.
+	TokenCache TokenCache `json:"-"`
+}
+
+// parseAuthVersion converts an auth version such as "3", "v3", or "2.0" into its
+// major version number. It returns zero for the empty string.
+func parseAuthVersion(version string) (int, error) {
+	if version == "" {
+		return 0, nil
+	}
+	major := strings.SplitN(strings.TrimPrefix(version, "v"), ".", 2)[0]
+	number, err := strconv.Atoi(major)
+	if err != nil || number < 1 || number > 3 {
+		return 0, fmt.Errorf("Unsupported auth version %s", version)
+	}
+	return number, nil
+}
+
+// endpointType converts the names that OpenStack tools use for endpoint interfaces
+// ("public", "publicURL", "internal", ...) into a swift.EndpointType.
+func endpointType(name string) (swift.EndpointType, error) {
+	switch endpoint := swift.EndpointType(strings.TrimSuffix(strings.ToLower(name), "url")); endpoint {
+	case "", swift.EndpointTypePublic, swift.EndpointTypeInternal, swift.EndpointTypeAdmin:
+		return endpoint, nil
+	default:
+		return "", fmt.Errorf("Unknown endpoint type %s, expected public, internal, or admin", name)
+	}
+}
+
+// connection creates an unauthenticated swift.Connection from the credentials.
+func (c Credentials) connection() (*swift.Connection, error) {
+	if c.AuthURL == "" {
+		return nil, fmt.Errorf("No auth URL was provided")
+	}
+	if c.AuthVersion < 0 || c.AuthVersion > 3 {
+		return nil, fmt.Errorf("Unsupported auth version %d", c.AuthVersion)
+	}
+	endpoint, err := endpointType(c.EndpointType)
+	if err != nil {
+		return nil, err
+	}
+	connection := swift.Connection{
+		AuthUrl:                     c.AuthURL,
+		UserName:                    c.Username,
+		UserId:                      c.UserID,
+		ApiKey:                      c.Password,
+		Domain:                      c.UserDomain,
+		DomainId:                    c.UserDomainID,
+		Tenant:                      c.Project,
+		TenantId:                    c.ProjectID,
+		TenantDomain:                c.ProjectDomain,
+		TenantDomainId:              c.ProjectDomainID,
+		ApplicationCredentialId:     c.ApplicationCredentialID,
+		ApplicationCredentialName:   c.ApplicationCredentialName,
+		ApplicationCredentialSecret: c.ApplicationCredentialSecret,
+		TrustId:                     c.TrustID,
+		Region:                      c.Region,
+		EndpointType:                endpoint,
+	}
+	inferAuthVersion(&connection, c.AuthVersion)
+	if connection.AuthVersion != 3 {
+		if c.ApplicationCredentialSecret != "" {
+			return nil, fmt.Errorf("Application credentials require auth version 3")
+		} else if c.TrustID != "" {
+			return nil, fmt.Errorf("Trusts require auth version 3")
+		}
+	}
+	return &connection, nil
+}
+
+// AuthenticateWithCredentials logs in to OpenStack object storage with the provided
+// credentials and returns a connection to the object store. If a TokenCache is in
+// use, a cached token is used instead of logging in whenever it is still valid.
+func AuthenticateWithCredentials(credentials Credentials, opts ...Option) (Destination, error) {
+	connection, err := credentials.connection()
+	if err != nil {
+		return &SwiftDestination{}, err
+	}
+	destination := newSwiftDestination(connection, opts)
+	cache := credentials.TokenCache
+	if cache == nil {
+		cache = DefaultTokenCache
+	}
+	if cache == nil {
+		return authenticate(destination)
+	}
+	return authenticateWithCache(destination, cache, credentials.cacheKey())
+}
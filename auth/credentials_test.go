@@ -0,0 +1,129 @@
+package auth_test
+
+import (
+	"github.com/ibmjstart/swiftlygo/auth"
+	"github.com/ibmjstart/swiftlygo/auth/mock"
+	"net/http/httptest"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("AuthenticateWithCredentials", func() {
+	var (
+		keystone   *mock.KeystoneServer
+		httpServer *httptest.Server
+	)
+
+	BeforeEach(func() {
+		keystone = mock.NewKeystoneServer("https://public.example.com")
+		keystone.Catalog[1].URL = "https://internal.example.com"
+		httpServer = httptest.NewServer(keystone)
+	})
+
+	AfterEach(func() {
+		httpServer.Close()
+	})
+
+	// identity returns a section of the identity in the last authentication request.
+	identity := func(method string) map[string]interface{} {
+		request := keystone.LastRequest()["auth"].(map[string]interface{})
+		return request["identity"].(map[string]interface{})[method].(map[string]interface{})
+	}
+
+	// scope returns the scope of the last authentication request.
+	scope := func() map[string]interface{} {
+		request := keystone.LastRequest()["auth"].(map[string]interface{})
+		return request["scope"].(map[string]interface{})
+	}
+
+	Context("With application credentials", func() {
+		It("Should authenticate with the application credential method", func() {
+			_, err := auth.AuthenticateWithCredentials(auth.Credentials{
+				AuthURL:                     httpServer.URL,
+				ApplicationCredentialID:     "credential-id",
+				ApplicationCredentialSecret: "secret",
+			})
+			Expect(err).ShouldNot(HaveOccurred())
+			credential := identity("application_credential")
+			Expect(credential["id"]).To(Equal("credential-id"))
+			Expect(credential["secret"]).To(Equal("secret"))
+		})
+		It("Should refuse auth versions other than 3", func() {
+			_, err := auth.AuthenticateWithCredentials(auth.Credentials{
+				AuthURL:                     httpServer.URL,
+				AuthVersion:                 2,
+				ApplicationCredentialID:     "credential-id",
+				ApplicationCredentialSecret: "secret",
+			})
+			Expect(err).Should(HaveOccurred())
+			Expect(keystone.Requests()).To(Equal(0))
+		})
+	})
+	Context("With a trust", func() {
+		It("Should request a trust-scoped token", func() {
+			_, err := auth.AuthenticateWithCredentials(auth.Credentials{
+				AuthURL:    httpServer.URL + "/v3",
+				Username:   "trustee",
+				Password:   "password",
+				UserDomain: "domain",
+				TrustID:    "trust-id",
+			})
+			Expect(err).ShouldNot(HaveOccurred())
+			trust := scope()["OS-TRUST:trust"].(map[string]interface{})
+			Expect(trust["id"]).To(Equal("trust-id"))
+		})
+	})
+	Context("With a project ID", func() {
+		It("Should scope the token to that project", func() {
+			_, err := auth.AuthenticateWithCredentials(auth.Credentials{
+				AuthURL:   httpServer.URL,
+				UserID:    "user-id",
+				Password:  "password",
+				ProjectID: "project-id",
+			})
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(identity("password")["user"].(map[string]interface{})["id"]).To(Equal("user-id"))
+			Expect(scope()["project"].(map[string]interface{})["id"]).To(Equal("project-id"))
+		})
+	})
+	Context("With an endpoint type", func() {
+		credentials := func(endpoint string) auth.Credentials {
+			return auth.Credentials{
+				AuthURL:      httpServer.URL,
+				Username:     "user",
+				Password:     "password",
+				UserDomain:   "domain",
+				EndpointType: endpoint,
+			}
+		}
+		It("Should use the matching endpoint", func() {
+			for _, endpoint := range []string{"internal", "internalURL"} {
+				destination, err := auth.AuthenticateWithCredentials(credentials(endpoint))
+				Expect(err).ShouldNot(HaveOccurred())
+				Expect(destination.(*auth.SwiftDestination).SwiftConnection.StorageUrl).To(Equal("https://internal.example.com"))
+			}
+		})
+		It("Should default to the public endpoint", func() {
+			destination, err := auth.AuthenticateWithCredentials(credentials(""))
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(destination.(*auth.SwiftDestination).SwiftConnection.StorageUrl).To(Equal("https://public.example.com"))
+		})
+		It("Should reject unknown endpoint types", func() {
+			_, err := auth.AuthenticateWithCredentials(credentials("private"))
+			Expect(err).Should(HaveOccurred())
+		})
+	})
+	Context("With an invalid auth version", func() {
+		It("Should return an error", func() {
+			_, err := auth.AuthenticateWithCredentials(auth.Credentials{AuthURL: httpServer.URL, AuthVersion: 4})
+			Expect(err).Should(HaveOccurred())
+		})
+	})
+	Context("Without an auth URL", func() {
+		It("Should return an error", func() {
+			_, err := auth.AuthenticateWithCredentials(auth.Credentials{Username: "user"})
+			Expect(err).Should(HaveOccurred())
+		})
+	})
+})
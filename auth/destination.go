@@ -2,8 +2,13 @@ package auth
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"github.com/ncw/swift"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
 	"io"
 	"net/http"
 	"regexp"
@@ -30,39 +35,172 @@ type Destination interface {
 	Objects(container string) ([]swift.Object, error)
 }
 
+// Limits describes the constraints that an object store places upon the chunks
+// of a large object. MinChunkSize applies to every chunk except the last one.
+type Limits struct {
+	MinChunkSize uint
+	MaxChunkSize uint
+	MaxChunks    uint
+}
+
+// maxFileChunks is the maximum number of chunks that OpenStack Object
+// storage allows within an SLO.
+const maxFileChunks uint = 1000
+
+// maxChunkSize is the largest allowable size for a single chunk in
+// OpenStack object storage.
+const maxChunkSize uint = 1000 * 1000 * 1000 * 5
+
+// SwiftLimits are the chunk constraints of OpenStack Object Storage, which
+// apply to every Destination that is not a LimitedDestination. Since SLO
+// manifests can reference other manifests, the maximum number of chunks is the
+// square of the number that a single manifest can hold.
+var SwiftLimits = Limits{
+	MinChunkSize: 1,
+	MaxChunkSize: maxChunkSize,
+	MaxChunks:    maxFileChunks * maxFileChunks,
+}
+
+// LimitedDestination is implemented by Destinations whose chunk constraints
+// differ from those of OpenStack Object Storage.
+type LimitedDestination interface {
+	Destination
+	Limits() Limits
+}
+
+// ConcurrentDestination is implemented by Destinations that can prepare for a
+// particular number of simultaneous uploads, for instance by sizing a pool of
+// connections.
+type ConcurrentDestination interface {
+	Destination
+	SetConcurrency(uploads uint)
+}
+
+// ContextDestination is implemented by Destinations that can propagate the
+// trace context of a context.Context into the requests that they send.
+type ContextDestination interface {
+	Destination
+	CreateFileContext(ctx context.Context, container, objectName string, checkHash bool, hash string) (WriteCloseHeader, error)
+	CreateSLOContext(ctx context.Context, containerName, manifestName, manifestEtag string, sloManifestJSON []byte) error
+}
+
+// MetadataDestination is implemented by ContextDestinations that can store
+// metadata with the objects and manifests that they create. Each key of
+// metadata is sent as an X-Object-Meta- header. ObjectMetadata returns the
+// metadata stored with an existing object.
+type MetadataDestination interface {
+	ContextDestination
+	CreateFileMetadata(ctx context.Context, container, objectName string, checkHash bool, hash string, metadata map[string]string) (WriteCloseHeader, error)
+	CreateSLOMetadata(ctx context.Context, containerName, manifestName, manifestEtag string, sloManifestJSON []byte, metadata map[string]string) error
+	ObjectMetadata(container, objectName string) (map[string]string, error)
+}
+
+// ContainerDestination is implemented by Destinations that can create the
+// containers that they upload into. EnsureContainer creates the container if
+// it does not already exist.
+type ContainerDestination interface {
+	Destination
+	EnsureContainer(container string) error
+}
+
 // SwiftDestination implements the Destination interface for OpenStack Swift.
 type SwiftDestination struct {
 	SwiftConnection *swift.Connection
+	// Client is used for the requests that the swift.Connection does not make
+	// itself, such as uploading manifests. If it is nil, a client that uses the
+	// connection's transport is used.
+	Client *http.Client
+
+	// transport is set if the destination created the connection's transport,
+	// and may therefore resize its connection pool.
+	transport *http.Transport
+}
+
+// client returns the HTTP client to use for requests made outside of the
+// swift.Connection.
+func (s *SwiftDestination) client() *http.Client {
+	if s.Client != nil {
+		return s.Client
+	} else if s.SwiftConnection.Transport != nil {
+		return &http.Client{Transport: s.SwiftConnection.Transport}
+	}
+	return http.DefaultClient
+}
+
+// SetConcurrency grows the pool of idle connections to object storage so that
+// the given number of uploads, plus a manifest upload, can reuse connections.
+// It has no effect if the transport was provided with WithHTTPClient.
+func (s *SwiftDestination) SetConcurrency(uploads uint) {
+	if s.transport != nil && s.transport.MaxIdleConnsPerHost < int(uploads)+1 {
+		s.transport.MaxIdleConnsPerHost = int(uploads) + 1
+	}
 }
 
 // CreateFile begins the process of creating a file in the destination. Write data to
 // the returned WriteCloser and then close it to upload the data. Be sure to handle errors.
 func (s *SwiftDestination) CreateFile(container, objectName string, checkHash bool, Hash string) (WriteCloseHeader, error) {
-	return s.SwiftConnection.ObjectCreate(container, objectName, checkHash, Hash, "", nil)
+	return s.CreateFileContext(context.Background(), container, objectName, checkHash, Hash)
+}
+
+// CreateFileContext is like CreateFile, but propagates the trace context of ctx
+// in the headers of the upload request using the global OpenTelemetry propagator.
+func (s *SwiftDestination) CreateFileContext(ctx context.Context, container, objectName string, checkHash bool, hash string) (WriteCloseHeader, error) {
+	return s.CreateFileMetadata(ctx, container, objectName, checkHash, hash, nil)
+}
+
+// CreateFileMetadata is like CreateFileContext, but also stores metadata with
+// the object.
+func (s *SwiftDestination) CreateFileMetadata(ctx context.Context, container, objectName string, checkHash bool, hash string, metadata map[string]string) (WriteCloseHeader, error) {
+	headers := swift.Metadata(metadata).ObjectHeaders()
+	otel.GetTextMapPropagator().Inject(ctx, propagation.MapCarrier(headers))
+	upload, err := s.SwiftConnection.ObjectCreate(container, objectName, checkHash, hash, "", headers)
+	if err != nil {
+		return nil, statusError(err)
+	}
+	return swiftUpload{upload}, nil
 }
 
 // CreateSLO sends the provided json to the destination as an SLO manifest.
 func (s *SwiftDestination) CreateSLO(containerName, manifestName, manifestEtag string, sloManifestJSON []byte) error {
+	return s.CreateSLOContext(context.Background(), containerName, manifestName, manifestEtag, sloManifestJSON)
+}
+
+// CreateSLOContext is like CreateSLO, but propagates the trace context of ctx in
+// the headers of the manifest request using the global OpenTelemetry propagator,
+// and records the response's status code on the span in ctx.
+func (s *SwiftDestination) CreateSLOContext(ctx context.Context, containerName, manifestName, manifestEtag string, sloManifestJSON []byte) error {
+	return s.CreateSLOMetadata(ctx, containerName, manifestName, manifestEtag, sloManifestJSON, nil)
+}
+
+// CreateSLOMetadata is like CreateSLOContext, but also stores metadata with the
+// manifest.
+func (s *SwiftDestination) CreateSLOMetadata(ctx context.Context, containerName, manifestName, manifestEtag string, sloManifestJSON []byte, metadata map[string]string) error {
 	targetUrl := s.SwiftConnection.StorageUrl + "/" + containerName + "/" + manifestName + "?multipart-manifest=put"
 
-	request, err := http.NewRequest(http.MethodPut, targetUrl, bytes.NewReader(sloManifestJSON))
+	request, err := http.NewRequestWithContext(ctx, http.MethodPut, targetUrl, bytes.NewReader(sloManifestJSON))
 	if err != nil {
 		return fmt.Errorf("Failed to create request for uploading manifest file: %s", err)
 	}
 	request.Header.Add("X-Auth-Token", s.SwiftConnection.AuthToken)
 	request.Header.Add("Content-Length", strconv.Itoa(len(sloManifestJSON)))
-	response, err := http.DefaultClient.Do(request)
-	defer response.Body.Close()
+	for key, value := range swift.Metadata(metadata).ObjectHeaders() {
+		request.Header.Set(key, value)
+	}
+	otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(request.Header))
+	response, err := s.client().Do(request)
 	if err != nil {
-		return fmt.Errorf("Error sending manifest upload request: %s", err)
-	} else if response.StatusCode < 200 || response.StatusCode >= 300 {
+		return fmt.Errorf("Error sending manifest upload request: %w", err)
+	}
+	defer response.Body.Close()
+	trace.SpanFromContext(ctx).SetAttributes(attribute.Int("http.response.status_code", response.StatusCode))
+	if response.StatusCode < 200 || response.StatusCode >= 300 {
 		body := bytes.NewBufferString("")
 		_, _ = body.ReadFrom(response.Body)
-		return fmt.Errorf("Failed to upload manifest with status %d with reasons:\n%s\nand manifest:\n%s", response.StatusCode, body.String(), string(sloManifestJSON))
+		return fmt.Errorf("Failed to upload manifest %s: %w", manifestName, newHTTPStatusError(response, body.String()))
 	}
 	// Check the returned hash against our locally computed one. We need to strip the quotes off of the sides of the hash first
-	if strings.Trim(response.Header["Etag"][0], "\"") != manifestEtag {
-		return fmt.Errorf("Manifest corrupted on upload, please try again.")
+	if etag := strings.Trim(response.Header.Get("Etag"), "\""); etag != manifestEtag {
+		return &ManifestEtagMismatchError{Container: containerName, Manifest: manifestName, Expected: manifestEtag, Actual: etag}
 	}
 	return nil
 
@@ -80,32 +218,65 @@ func (s *SwiftDestination) CreateDLO(manifestContainer, manifestName, objectCont
 	request.Header.Add("X-Auth-Token", s.SwiftConnection.AuthToken)
 	request.Header.Add("X-Object-Manifest", manifest)
 
-	response, err := http.DefaultClient.Do(request)
-	defer response.Body.Close()
+	response, err := s.client().Do(request)
 	if err != nil {
-		return fmt.Errorf("Error sending manifest upload request: %s", err)
-	} else if response.StatusCode < 200 || response.StatusCode >= 300 {
+		return fmt.Errorf("Error sending manifest upload request: %w", err)
+	}
+	defer response.Body.Close()
+	if response.StatusCode < 200 || response.StatusCode >= 300 {
 		body := bytes.NewBufferString("")
 		_, _ = body.ReadFrom(response.Body)
-		return fmt.Errorf("Failed to upload manifest with status %d with reasons:\n%s", response.StatusCode, body.String())
+		return fmt.Errorf("Failed to upload manifest %s: %w", manifestName, newHTTPStatusError(response, body.String()))
 	}
 
 	return nil
 }
 
+// ObjectMetadata returns the metadata of an object, without the X-Object-Meta-
+// prefix of its headers.
+func (s *SwiftDestination) ObjectMetadata(container, objectName string) (map[string]string, error) {
+	_, headers, err := s.SwiftConnection.Object(container, objectName)
+	if err != nil {
+		return nil, statusError(err)
+	}
+	return headers.ObjectMetadata(), nil
+}
+
 // FileNames returns a slice of the names of all files already in the destination container.
 func (s *SwiftDestination) FileNames(container string) ([]string, error) {
-	return s.SwiftConnection.ObjectNamesAll(container, nil)
+	names, err := s.SwiftConnection.ObjectNamesAll(container, nil)
+	return names, statusError(err)
 }
 
 // Objects returns a slice of swift Objects that container information about the container's
 // contents.
 func (s *SwiftDestination) Objects(container string) ([]swift.Object, error) {
-	return s.SwiftConnection.ObjectsAll(container, nil)
+	objects, err := s.SwiftConnection.ObjectsAll(container, nil)
+	return objects, statusError(err)
 }
 
-// Ensure that SwiftDestination satsifies the interface at compile-time
+// EnsureContainer creates the container unless it already exists. The container
+// is looked up first so that users who may not create containers can still
+// upload into existing ones, and a container that the user may not look up is
+// assumed to exist.
+func (s *SwiftDestination) EnsureContainer(container string) error {
+	_, _, err := s.SwiftConnection.Container(container)
+	if err == swift.ContainerNotFound {
+		err = s.SwiftConnection.ContainerCreate(container, nil)
+	}
+	err = statusError(err)
+	if statusErr, ok := err.(*HTTPStatusError); ok && statusErr.Code == http.StatusForbidden {
+		return nil
+	}
+	return err
+}
+
+// Ensure that SwiftDestination satisfies the interfaces at compile-time
 var _ Destination = &SwiftDestination{}
+var _ ConcurrentDestination = &SwiftDestination{}
+var _ ContextDestination = &SwiftDestination{}
+var _ MetadataDestination = &SwiftDestination{}
+var _ ContainerDestination = &SwiftDestination{}
 
 func getAuthVersion(url string) (int, error) {
 	// Extract auth version from auth URL
@@ -125,39 +296,32 @@ func getAuthVersion(url string) (int, error) {
 }
 
 // Authenticate logs in to OpenStack object storage and returns a connection to the
-// object store. The url MUST have its auth version at the end: https://example.com/v{1,2,3}
-func Authenticate(username, apiKey, authURL, domain, tenant string) (Destination, error) {
-	version, err := getAuthVersion(authURL)
-	if err != nil {
-		return &SwiftDestination{}, err
-	}
-	connection := swift.Connection{
-		UserName:    username,
-		ApiKey:      apiKey,
-		AuthUrl:     authURL,
-		Domain:      domain,
-		Tenant:      tenant,
-		AuthVersion: version,
-	}
-	err = connection.Authenticate()
-	if err != nil {
-		return &SwiftDestination{SwiftConnection: &connection}, fmt.Errorf("Failed to authenticate with object storage: %s", err)
-	}
-	return &SwiftDestination{SwiftConnection: &connection}, nil
+// object store. The url should have its auth version at the end: https://example.com/v{1,2,3}.
+// If it doesn't, version 3 is used. To use application credentials, trusts, or a
+// particular region or endpoint type, use AuthenticateWithCredentials instead.
+func Authenticate(username, apiKey, authURL, domain, tenant string, opts ...Option) (Destination, error) {
+	return AuthenticateWithCredentials(Credentials{
+		AuthURL:    authURL,
+		Username:   username,
+		Password:   apiKey,
+		UserDomain: domain,
+		Project:    tenant,
+	}, opts...)
 }
 
 // AuthenticateWithToken logs in to OpenStack object storage using the authentication token and
 // storage url and returns a connection to the object store. It also checks that the connection is
 // valid.
-func AuthenticateWithToken(authToken, storageUrl string) (Destination, error) {
+func AuthenticateWithToken(authToken, storageUrl string, opts ...Option) (Destination, error) {
 	connection := swift.Connection{
 		StorageUrl: storageUrl,
 		AuthToken:  authToken,
 	}
+	destination := newSwiftDestination(&connection, opts)
 
 	if !connection.Authenticated() {
-		return &SwiftDestination{SwiftConnection: &connection}, fmt.Errorf("Connection not authenticated")
+		return destination, &AuthError{Err: fmt.Errorf("Connection not authenticated")}
 	}
 
-	return &SwiftDestination{SwiftConnection: &connection}, nil
+	return destination, nil
 }
@@ -11,6 +11,23 @@ in the mock subpackage.
 
 The intended use of auth is to call either Authenticate() or
 AuthenticateWithToken with your credentials to set up a Destination.
+If your credentials are already in the standard OpenStack environment
+variables (for instance, from an openrc file) or in a clouds.yaml file,
+AuthenticateFromEnv and AuthenticateFromCloudsYAML read them for you.
+AuthenticateWithCredentials accepts a Credentials struct, which also
+supports Keystone v3 application credentials, trusts, project IDs, an
+explicit auth version, and the choice of region and endpoint type (use
+EndpointType "internal" to keep traffic on a cloud's private network).
+
+Processes that run often can avoid logging in every time by setting
+Credentials.TokenCache, or DefaultTokenCache, to a FileTokenCache. Tokens
+are then reused until they expire or are rejected by object storage.
+
+Every Authenticate function also accepts Options. WithHTTPClient and
+WithTLSConfig configure every request that the Destination makes,
+including manifest uploads, so custom certificate authorities, client
+certificates, and proxies apply throughout. WithTimeouts and
+WithMaxConnections tune timeouts and the connection pool.
 
 The names of the parameters to Authenticate may not match the names
 of the credentials that your OpenStack Object Store provides. In
@@ -38,7 +55,8 @@ You can authenticate with:
 
 	Authenticate("user_name", "password", "https://identity.open.softlayer.com/v3", "domain_name", "")
 
-Please note that we had to append "/v3" to the auth URL.
+Please note that we had to append "/v3" to the auth URL. AuthenticateFromEnv
+and AuthenticateFromCloudsYAML append it for you when it is missing.
 
 For Softlayer object stores, you can find your credentials in the user interface by clicking
 "View Credentials" when viewing an Object Storage instance in the Web UI.
@@ -0,0 +1,111 @@
+package auth
+
+import (
+	"fmt"
+	"github.com/ncw/swift"
+	"os"
+	"strings"
+)
+
+// firstEnv returns the value of the first of the named environment variables
+// that is set to something other than the empty string.
+func firstEnv(names ...string) string {
+	for _, name := range names {
+		if value := os.Getenv(name); value != "" {
+			return value
+		}
+	}
+	return ""
+}
+
+// inferAuthVersion chooses the auth version for the connection and ensures that the
+// auth URL ends with it. An explicitly requested version takes precedence, followed by
+// the version at the end of the auth URL. Otherwise, version 3 is assumed, since it is
+// the only version that current Keystone releases support.
+func inferAuthVersion(connection *swift.Connection, explicit int) {
+	urlVersion, err := getAuthVersion(connection.AuthUrl)
+	hasVersion := err == nil
+	version := 3
+	switch {
+	case explicit != 0:
+		version = explicit
+	case hasVersion:
+		version = urlVersion
+	}
+	if !hasVersion {
+		switch version {
+		case 2:
+			connection.AuthUrl = strings.TrimRight(connection.AuthUrl, "/") + "/v2.0"
+		case 3:
+			connection.AuthUrl = strings.TrimRight(connection.AuthUrl, "/") + "/v3"
+		}
+	}
+	connection.AuthVersion = version
+}
+
+// authenticate logs the connection in to object storage.
+func authenticate(destination *SwiftDestination) (Destination, error) {
+	err := destination.SwiftConnection.Authenticate()
+	if err != nil {
+		return destination, &AuthError{Err: statusError(err)}
+	}
+	return destination, nil
+}
+
+// CredentialsFromEnv reads Credentials from the standard OpenStack environment
+// variables, as set by an openrc file:
+//
+//	OS_AUTH_URL, OS_USERNAME, OS_USER_ID, OS_PASSWORD, OS_USER_DOMAIN_NAME,
+//	OS_USER_DOMAIN_ID, OS_PROJECT_NAME, OS_PROJECT_ID, OS_PROJECT_DOMAIN_NAME,
+//	OS_PROJECT_DOMAIN_ID, OS_APPLICATION_CREDENTIAL_ID, OS_APPLICATION_CREDENTIAL_NAME,
+//	OS_APPLICATION_CREDENTIAL_SECRET, OS_TRUST_ID, OS_REGION_NAME, OS_INTERFACE,
+//	and OS_IDENTITY_API_VERSION
+//
+// The older OS_TENANT_NAME, OS_TENANT_ID, OS_ENDPOINT_TYPE and OS_AUTH_VERSION names
+// and the swift client's ST_AUTH, ST_USER and ST_KEY are also understood.
+func CredentialsFromEnv() (Credentials, error) {
+	version, err := parseAuthVersion(firstEnv("OS_IDENTITY_API_VERSION", "OS_AUTH_VERSION", "ST_AUTH_VERSION"))
+	if err != nil {
+		return Credentials{}, err
+	}
+	credentials := Credentials{
+		AuthURL:                     firstEnv("OS_AUTH_URL", "ST_AUTH"),
+		AuthVersion:                 version,
+		Username:                    firstEnv("OS_USERNAME", "ST_USER"),
+		UserID:                      os.Getenv("OS_USER_ID"),
+		Password:                    firstEnv("OS_PASSWORD", "ST_KEY"),
+		UserDomain:                  firstEnv("OS_USER_DOMAIN_NAME", "OS_DOMAIN_NAME"),
+		UserDomainID:                firstEnv("OS_USER_DOMAIN_ID", "OS_DOMAIN_ID"),
+		Project:                     firstEnv("OS_PROJECT_NAME", "OS_TENANT_NAME"),
+		ProjectID:                   firstEnv("OS_PROJECT_ID", "OS_TENANT_ID"),
+		ProjectDomain:               os.Getenv("OS_PROJECT_DOMAIN_NAME"),
+		ProjectDomainID:             os.Getenv("OS_PROJECT_DOMAIN_ID"),
+		ApplicationCredentialID:     os.Getenv("OS_APPLICATION_CREDENTIAL_ID"),
+		ApplicationCredentialName:   os.Getenv("OS_APPLICATION_CREDENTIAL_NAME"),
+		ApplicationCredentialSecret: os.Getenv("OS_APPLICATION_CREDENTIAL_SECRET"),
+		TrustID:                     os.Getenv("OS_TRUST_ID"),
+		Region:                      os.Getenv("OS_REGION_NAME"),
+		EndpointType:                firstEnv("OS_INTERFACE", "OS_ENDPOINT_TYPE"),
+	}
+	if credentials.AuthURL == "" {
+		return credentials, fmt.Errorf("OS_AUTH_URL is not set")
+	}
+	return credentials, nil
+}
+
+// AuthenticateFromEnv logs in to OpenStack object storage using the credentials in
+// the standard OpenStack environment variables (see CredentialsFromEnv). If both
+// OS_AUTH_TOKEN and OS_STORAGE_URL are set, they are used instead of logging in.
+//
+// The auth URL does not need to end with the auth version. If it doesn't, the version
+// is taken from OS_IDENTITY_API_VERSION, defaulting to 3.
+func AuthenticateFromEnv(opts ...Option) (Destination, error) {
+	if token, storageURL := os.Getenv("OS_AUTH_TOKEN"), os.Getenv("OS_STORAGE_URL"); token != "" && storageURL != "" {
+		return AuthenticateWithToken(token, storageURL, opts...)
+	}
+	credentials, err := CredentialsFromEnv()
+	if err != nil {
+		return &SwiftDestination{}, err
+	}
+	return AuthenticateWithCredentials(credentials, opts...)
+}
@@ -0,0 +1,190 @@
+package auth_test
+
+import (
+	"github.com/ibmjstart/swiftlygo/auth"
+	"github.com/ibmjstart/swiftlygo/auth/mock"
+	"io/ioutil"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+// openstackEnv lists every environment variable that the auth package reads, so
+// that tests can start from a clean environment.
+var openstackEnv = []string{
+	"OS_AUTH_URL", "OS_USERNAME", "OS_USER_ID", "OS_PASSWORD", "OS_USER_DOMAIN_NAME",
+	"OS_USER_DOMAIN_ID", "OS_DOMAIN_NAME", "OS_DOMAIN_ID", "OS_PROJECT_NAME", "OS_PROJECT_ID",
+	"OS_TENANT_NAME", "OS_TENANT_ID", "OS_PROJECT_DOMAIN_NAME", "OS_PROJECT_DOMAIN_ID",
+	"OS_REGION_NAME", "OS_INTERFACE", "OS_ENDPOINT_TYPE", "OS_IDENTITY_API_VERSION",
+	"OS_AUTH_VERSION", "OS_AUTH_TOKEN", "OS_STORAGE_URL", "OS_CLOUD", "OS_CLIENT_CONFIG_FILE",
+	"OS_CLIENT_SECURE_FILE", "ST_AUTH", "ST_USER", "ST_KEY", "ST_AUTH_VERSION",
+}
+
+var _ = Describe("Authenticating from the environment", func() {
+	var (
+		keystone   *mock.KeystoneServer
+		httpServer *httptest.Server
+		saved      map[string]string
+	)
+
+	BeforeEach(func() {
+		saved = make(map[string]string)
+		for _, name := range openstackEnv {
+			if value, set := os.LookupEnv(name); set {
+				saved[name] = value
+			}
+			os.Unsetenv(name)
+		}
+		keystone = mock.NewKeystoneServer("https://storage.example.com/v1/AUTH_project")
+		httpServer = httptest.NewServer(keystone)
+	})
+
+	AfterEach(func() {
+		httpServer.Close()
+		for _, name := range openstackEnv {
+			os.Unsetenv(name)
+		}
+		for name, value := range saved {
+			os.Setenv(name, value)
+		}
+	})
+
+	// storageURL returns the storage URL of an authenticated destination.
+	storageURL := func(destination auth.Destination) string {
+		return destination.(*auth.SwiftDestination).SwiftConnection.StorageUrl
+	}
+
+	Describe("AuthenticateFromEnv", func() {
+		BeforeEach(func() {
+			os.Setenv("OS_USERNAME", "user")
+			os.Setenv("OS_PASSWORD", "password")
+			os.Setenv("OS_USER_DOMAIN_NAME", "domain")
+			os.Setenv("OS_PROJECT_NAME", "project")
+		})
+		Context("With an auth URL that lacks a version", func() {
+			It("Should authenticate with Keystone v3", func() {
+				os.Setenv("OS_AUTH_URL", httpServer.URL)
+				destination, err := auth.AuthenticateFromEnv()
+				Expect(err).ShouldNot(HaveOccurred())
+				Expect(keystone.Requests()).To(Equal(1))
+				Expect(storageURL(destination)).To(Equal("https://storage.example.com/v1/AUTH_project"))
+				Expect(destination.(*auth.SwiftDestination).SwiftConnection.AuthVersion).To(Equal(3))
+			})
+		})
+		Context("With an auth URL that ends in its version", func() {
+			It("Should authenticate with that version", func() {
+				os.Setenv("OS_AUTH_URL", httpServer.URL+"/v3/")
+				_, err := auth.AuthenticateFromEnv()
+				Expect(err).ShouldNot(HaveOccurred())
+				Expect(keystone.Requests()).To(Equal(1))
+			})
+		})
+		Context("With an explicit auth version", func() {
+			It("Should use that version", func() {
+				os.Setenv("OS_AUTH_URL", httpServer.URL)
+				os.Setenv("OS_IDENTITY_API_VERSION", "2")
+				_, err := auth.AuthenticateFromEnv()
+				Expect(err).Should(HaveOccurred())
+				Expect(keystone.Requests()).To(Equal(0))
+			})
+			It("Should reject unknown versions", func() {
+				os.Setenv("OS_AUTH_URL", httpServer.URL)
+				os.Setenv("OS_IDENTITY_API_VERSION", "7")
+				_, err := auth.AuthenticateFromEnv()
+				Expect(err).Should(HaveOccurred())
+			})
+		})
+		Context("With a region", func() {
+			It("Should use the storage URL of that region", func() {
+				keystone.Catalog = append(keystone.Catalog, mock.KeystoneEndpoint{Interface: "public", Region: "RegionTwo", URL: "https://two.example.com"})
+				os.Setenv("OS_AUTH_URL", httpServer.URL)
+				os.Setenv("OS_REGION_NAME", "RegionTwo")
+				destination, err := auth.AuthenticateFromEnv()
+				Expect(err).ShouldNot(HaveOccurred())
+				Expect(storageURL(destination)).To(Equal("https://two.example.com"))
+			})
+		})
+		Context("With a token and storage URL", func() {
+			It("Should not contact Keystone", func() {
+				os.Setenv("OS_AUTH_URL", httpServer.URL)
+				os.Setenv("OS_AUTH_TOKEN", "token")
+				os.Setenv("OS_STORAGE_URL", "https://storage.example.com")
+				destination, err := auth.AuthenticateFromEnv()
+				Expect(err).ShouldNot(HaveOccurred())
+				Expect(storageURL(destination)).To(Equal("https://storage.example.com"))
+				Expect(keystone.Requests()).To(Equal(0))
+			})
+		})
+		Context("Without an auth URL", func() {
+			It("Should return an error", func() {
+				_, err := auth.AuthenticateFromEnv()
+				Expect(err).Should(HaveOccurred())
+			})
+		})
+	})
+
+	Describe("AuthenticateFromCloudsYAML", func() {
+		var directory string
+
+		BeforeEach(func() {
+			var err error
+			directory, err = ioutil.TempDir("", "clouds")
+			Expect(err).ShouldNot(HaveOccurred())
+			clouds := `
+clouds:
+  mycloud:
+    auth:
+      auth_url: ` + httpServer.URL + `
+      username: user
+      user_domain_name: domain
+      project_name: project
+    region_name: RegionOne
+    interface: internal
+    identity_api_version: 3
+`
+			secure := `
+clouds:
+  mycloud:
+    auth:
+      password: secret
+`
+			Expect(ioutil.WriteFile(filepath.Join(directory, "clouds.yaml"), []byte(clouds), 0600)).To(Succeed())
+			Expect(ioutil.WriteFile(filepath.Join(directory, "secure.yaml"), []byte(secure), 0600)).To(Succeed())
+			os.Setenv("OS_CLIENT_CONFIG_FILE", filepath.Join(directory, "clouds.yaml"))
+			os.Setenv("OS_CLIENT_SECURE_FILE", filepath.Join(directory, "secure.yaml"))
+		})
+
+		AfterEach(func() {
+			os.RemoveAll(directory)
+		})
+
+		Context("With a cloud that exists", func() {
+			It("Should authenticate with the merged credentials", func() {
+				_, err := auth.AuthenticateFromCloudsYAML("mycloud")
+				Expect(err).ShouldNot(HaveOccurred())
+				request := keystone.LastRequest()
+				identity := request["auth"].(map[string]interface{})["identity"].(map[string]interface{})
+				user := identity["password"].(map[string]interface{})["user"].(map[string]interface{})
+				Expect(user["name"]).To(Equal("user"))
+				Expect(user["password"]).To(Equal("secret"))
+			})
+		})
+		Context("With the cloud named by OS_CLOUD", func() {
+			It("Should authenticate", func() {
+				os.Setenv("OS_CLOUD", "mycloud")
+				_, err := auth.AuthenticateFromCloudsYAML("")
+				Expect(err).ShouldNot(HaveOccurred())
+				Expect(keystone.Requests()).To(Equal(1))
+			})
+		})
+		Context("With a cloud that does not exist", func() {
+			It("Should return an error", func() {
+				_, err := auth.AuthenticateFromCloudsYAML("othercloud")
+				Expect(err).Should(HaveOccurred())
+			})
+		})
+	})
+})
@@ -0,0 +1,110 @@
+package auth
+
+import (
+	"fmt"
+	"github.com/ncw/swift"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// HTTPStatusError reports that object storage answered a request with an
+// unsuccessful HTTP status code. RetryAfter is how long the response's
+// Retry-After header asked the client to wait before retrying, or 0 if it did
+// not have one.
+type HTTPStatusError struct {
+	Code       int
+	Body       string
+	RetryAfter time.Duration
+}
+
+// newHTTPStatusError creates an HTTPStatusError from an unsuccessful response
+// with the given body.
+func newHTTPStatusError(response *http.Response, body string) *HTTPStatusError {
+	return &HTTPStatusError{
+		Code:       response.StatusCode,
+		Body:       body,
+		RetryAfter: retryAfter(response.Header.Get("Retry-After"), time.Now()),
+	}
+}
+
+// retryAfter parses the value of a Retry-After header, which is either a
+// number of seconds or an HTTP date, relative to now. It returns 0 if the
+// value is missing, invalid, or in the past.
+func retryAfter(value string, now time.Time) time.Duration {
+	if seconds, err := strconv.Atoi(value); err == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	if date, err := http.ParseTime(value); err == nil && date.After(now) {
+		return date.Sub(now)
+	}
+	return 0
+}
+
+func (e *HTTPStatusError) Error() string {
+	if e.Body == "" {
+		return fmt.Sprintf("Status %d: %s", e.Code, http.StatusText(e.Code))
+	}
+	return fmt.Sprintf("Status %d: %s", e.Code, e.Body)
+}
+
+// Temporary reports whether the status indicates a problem that may go away if
+// the request is retried, such as a server error or rate limiting.
+func (e *HTTPStatusError) Temporary() bool {
+	return e.Code >= 500 || e.Code == http.StatusRequestTimeout || e.Code == http.StatusTooManyRequests
+}
+
+// ManifestEtagMismatchError reports that the Etag that object storage computed
+// for an uploaded manifest does not match the one computed locally, which means
+// that the manifest or its segments were corrupted.
+type ManifestEtagMismatchError struct {
+	Container string
+	Manifest  string
+	Expected  string
+	Actual    string
+}
+
+func (e *ManifestEtagMismatchError) Error() string {
+	return fmt.Sprintf("Manifest %s/%s corrupted on upload (expected etag %s, got %s), please try again.", e.Container, e.Manifest, e.Expected, e.Actual)
+}
+
+// AuthError reports that logging in to object storage failed.
+type AuthError struct {
+	Err error
+}
+
+func (e *AuthError) Error() string {
+	return fmt.Sprintf("Failed to authenticate with object storage: %s", e.Err)
+}
+
+func (e *AuthError) Unwrap() error {
+	return e.Err
+}
+
+// statusError converts the errors that swift.Connection reports for unsuccessful
+// responses into HTTPStatusErrors, and returns other errors unchanged.
+func statusError(err error) error {
+	if swiftErr, ok := err.(*swift.Error); ok && swiftErr.StatusCode != 0 {
+		return &HTTPStatusError{Code: swiftErr.StatusCode, Body: swiftErr.Text}
+	}
+	return err
+}
+
+// swiftUpload converts the errors of a swift.ObjectCreateFile with statusError.
+type swiftUpload struct {
+	*swift.ObjectCreateFile
+}
+
+func (s swiftUpload) Write(data []byte) (int, error) {
+	written, err := s.ObjectCreateFile.Write(data)
+	return written, statusError(err)
+}
+
+func (s swiftUpload) Close() error {
+	return statusError(s.ObjectCreateFile.Close())
+}
+
+func (s swiftUpload) Headers() (swift.Headers, error) {
+	headers, err := s.ObjectCreateFile.Headers()
+	return headers, statusError(err)
+}
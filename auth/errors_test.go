@@ -0,0 +1,116 @@
+package auth_test
+
+import (
+	"errors"
+	"github.com/ibmjstart/swiftlygo/auth"
+	"github.com/ncw/swift/swifttest"
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Errors", func() {
+	var (
+		status     int
+		etag       string
+		retryAfter string
+		httpServer *httptest.Server
+		dest       auth.Destination
+	)
+
+	BeforeEach(func() {
+		status, etag, retryAfter = http.StatusCreated, "", ""
+		httpServer = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Etag", etag)
+			if retryAfter != "" {
+				w.Header().Set("Retry-After", retryAfter)
+			}
+			w.WriteHeader(status)
+			w.Write([]byte("reason"))
+		}))
+		var err error
+		dest, err = auth.AuthenticateWithToken("token", httpServer.URL)
+		Expect(err).ShouldNot(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		httpServer.Close()
+	})
+
+	Context("When object storage rejects a manifest", func() {
+		It("Should return an HTTPStatusError", func() {
+			status = http.StatusServiceUnavailable
+			var statusErr *auth.HTTPStatusError
+			Expect(errors.As(dest.CreateDLO("container", "manifest", "container", "prefix"), &statusErr)).To(BeTrue())
+			Expect(statusErr.Code).To(Equal(http.StatusServiceUnavailable))
+			Expect(statusErr.Body).To(Equal("reason"))
+			Expect(statusErr.Temporary()).To(BeTrue())
+
+			status = http.StatusForbidden
+			Expect(errors.As(dest.CreateSLO("container", "manifest", "", []byte("[]")), &statusErr)).To(BeTrue())
+			Expect(statusErr.Code).To(Equal(http.StatusForbidden))
+			Expect(statusErr.Temporary()).To(BeFalse())
+		})
+	})
+	Context("When object storage asks the client to retry later", func() {
+		It("Should report how long to wait", func() {
+			status = http.StatusTooManyRequests
+			var statusErr *auth.HTTPStatusError
+			Expect(errors.As(dest.CreateSLO("container", "manifest", "", []byte("[]")), &statusErr)).To(BeTrue())
+			Expect(statusErr.RetryAfter).To(BeZero())
+
+			retryAfter = "7"
+			Expect(errors.As(dest.CreateSLO("container", "manifest", "", []byte("[]")), &statusErr)).To(BeTrue())
+			Expect(statusErr.RetryAfter).To(Equal(7 * time.Second))
+
+			retryAfter = time.Now().Add(time.Minute).UTC().Format(http.TimeFormat)
+			Expect(errors.As(dest.CreateSLO("container", "manifest", "", []byte("[]")), &statusErr)).To(BeTrue())
+			Expect(statusErr.RetryAfter).To(BeNumerically("~", time.Minute, 2*time.Second))
+
+			retryAfter = "soon"
+			Expect(errors.As(dest.CreateSLO("container", "manifest", "", []byte("[]")), &statusErr)).To(BeTrue())
+			Expect(statusErr.RetryAfter).To(BeZero())
+		})
+	})
+	Context("When a manifest's etag does not match", func() {
+		It("Should return a ManifestEtagMismatchError", func() {
+			etag = "\"actual\""
+			var mismatch *auth.ManifestEtagMismatchError
+			Expect(errors.As(dest.CreateSLO("container", "manifest", "expected", []byte("[]")), &mismatch)).To(BeTrue())
+			Expect(*mismatch).To(Equal(auth.ManifestEtagMismatchError{
+				Container: "container",
+				Manifest:  "manifest",
+				Expected:  "expected",
+				Actual:    "actual",
+			}))
+		})
+	})
+	Context("When a container cannot be looked up", func() {
+		It("Should return an HTTPStatusError", func() {
+			status = http.StatusInternalServerError
+			var statusErr *auth.HTTPStatusError
+			Expect(errors.As(dest.(auth.ContainerDestination).EnsureContainer("container"), &statusErr)).To(BeTrue())
+			Expect(statusErr.Code).To(Equal(http.StatusInternalServerError))
+		})
+		It("Should assume that it exists if looking it up is forbidden", func() {
+			status = http.StatusForbidden
+			Expect(dest.(auth.ContainerDestination).EnsureContainer("container")).To(Succeed())
+		})
+	})
+	Context("When logging in fails", func() {
+		It("Should return an AuthError", func() {
+			server, err := swifttest.NewSwiftServer("localhost")
+			Expect(err).ShouldNot(HaveOccurred())
+			defer server.Close()
+			_, err = auth.Authenticate("wrong", "wrong", server.AuthURL, "", "")
+			var authErr *auth.AuthError
+			Expect(errors.As(err, &authErr)).To(BeTrue())
+			var statusErr *auth.HTTPStatusError
+			Expect(errors.As(err, &statusErr)).To(BeTrue())
+			Expect(statusErr.Code).To(Equal(http.StatusUnauthorized))
+		})
+	})
+})
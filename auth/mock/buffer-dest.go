@@ -2,10 +2,13 @@ package mock
 
 import (
 	"bytes"
+	"context"
 	"crypto/md5"
 	"encoding/hex"
 	"github.com/ibmjstart/swiftlygo/auth"
 	"github.com/ncw/swift"
+	"hash"
+	"sync"
 )
 
 // closableBuffer wraps the bytes.Buffer with the close method so that it can be used
@@ -33,13 +36,47 @@ func (c *closableBuffer) Headers() (swift.Headers, error) {
 	return h, nil
 }
 
+// bufferUpload adds the data of one object to a closableBuffer, and reports
+// the MD5 sum of just that data as its Etag, as object storage would.
+type bufferUpload struct {
+	buffer   *closableBuffer
+	hash     hash.Hash
+	expected string
+}
+
+func (u *bufferUpload) Write(p []byte) (int, error) {
+	u.hash.Write(p)
+	return u.buffer.Write(p)
+}
+
+// Close returns swift.ObjectCorrupted if the data does not match the hash
+// given to CreateFile.
+func (u *bufferUpload) Close() error {
+	if u.expected != "" && u.expected != u.etag() {
+		return swift.ObjectCorrupted
+	}
+	return nil
+}
+
+func (u *bufferUpload) Headers() (swift.Headers, error) {
+	return swift.Headers{"Etag": u.etag()}, nil
+}
+
+func (u *bufferUpload) etag() string {
+	return hex.EncodeToString(u.hash.Sum(nil))
+}
+
 // BufferDestination implements the Destination and keeps the observed
-// container names, object names, file data, and manifest data for later
-// retrieval and testing.
+// container names, object names, file data, manifest data, and object metadata
+// (by the path of the object) for later retrieval and testing.
 type BufferDestination struct {
 	Containers      map[string][]string
 	FileContent     *closableBuffer
 	ManifestContent *bytes.Buffer
+	Metadata        map[string]map[string]string
+
+	// lock guards Metadata, which is looked up while chunks are uploading
+	lock sync.Mutex
 }
 
 // NewBufferDestination creates a new instance of BufferDestination
@@ -48,6 +85,7 @@ func NewBufferDestination() *BufferDestination {
 		FileContent:     newClosableBuffer(),
 		Containers:      make(map[string][]string, 0),
 		ManifestContent: bytes.NewBuffer(make([]byte, 0)),
+		Metadata:        make(map[string]map[string]string),
 	}
 }
 
@@ -76,11 +114,12 @@ func (b *BufferDestination) handleContainerAndObject(container, object string) {
 	}
 }
 
-// CreateFile returns a reference to the fileContent buffer held by this BufferDestination
-// that can be written into, though it may not be safe for concurrent operations.
+// CreateFile returns a writer into the fileContent buffer held by this BufferDestination,
+// though it may not be safe for concurrent operations. If Hash is given, closing the
+// writer fails unless the data written has that MD5 sum.
 func (b *BufferDestination) CreateFile(container, objectName string, checkHash bool, Hash string) (auth.WriteCloseHeader, error) {
 	b.handleContainerAndObject(container, objectName)
-	return b.FileContent, nil
+	return &bufferUpload{buffer: b.FileContent, hash: md5.New(), expected: Hash}, nil
 }
 
 // CreateSLO always returns nil.
@@ -90,12 +129,54 @@ func (b *BufferDestination) CreateSLO(containerName, manifestName, manifestEtag
 	return err
 }
 
+// CreateFileContext is like CreateFile. It ignores ctx.
+func (b *BufferDestination) CreateFileContext(ctx context.Context, container, objectName string, checkHash bool, hash string) (auth.WriteCloseHeader, error) {
+	return b.CreateFile(container, objectName, checkHash, hash)
+}
+
+// CreateFileMetadata is like CreateFile, and records metadata.
+func (b *BufferDestination) CreateFileMetadata(ctx context.Context, container, objectName string, checkHash bool, hash string, metadata map[string]string) (auth.WriteCloseHeader, error) {
+	b.lock.Lock()
+	b.Metadata[container+"/"+objectName] = metadata
+	b.lock.Unlock()
+	return b.CreateFile(container, objectName, checkHash, hash)
+}
+
+// CreateSLOContext is like CreateSLO. It ignores ctx.
+func (b *BufferDestination) CreateSLOContext(ctx context.Context, containerName, manifestName, manifestEtag string, sloManifestJSON []byte) error {
+	return b.CreateSLO(containerName, manifestName, manifestEtag, sloManifestJSON)
+}
+
+// CreateSLOMetadata is like CreateSLO, and records metadata.
+func (b *BufferDestination) CreateSLOMetadata(ctx context.Context, containerName, manifestName, manifestEtag string, sloManifestJSON []byte, metadata map[string]string) error {
+	b.lock.Lock()
+	b.Metadata[containerName+"/"+manifestName] = metadata
+	b.lock.Unlock()
+	return b.CreateSLO(containerName, manifestName, manifestEtag, sloManifestJSON)
+}
+
+// ObjectMetadata returns the metadata recorded for the object, which is nil if
+// none was.
+func (b *BufferDestination) ObjectMetadata(container, objectName string) (map[string]string, error) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	return b.Metadata[container+"/"+objectName], nil
+}
+
 // CreateDLO always returns nil.
 func (b *BufferDestination) CreateDLO(containerName, manifestName, objectContainer, filenamePrefix string) error {
 	b.handleContainerAndObject(containerName, manifestName)
 	return nil
 }
 
+// EnsureContainer adds the container to Containers if it is not already there.
+func (b *BufferDestination) EnsureContainer(container string) error {
+	if _, exists := b.Containers[container]; !exists {
+		b.Containers[container] = make([]string, 0)
+	}
+	return nil
+}
+
 // FileNames returns an empty string slice and nil.
 func (b *BufferDestination) FileNames(container string) ([]string, error) {
 	return b.Containers[container], nil
@@ -111,5 +192,7 @@ func (b *BufferDestination) Objects(container string) ([]swift.Object, error) {
 	return objects, nil
 }
 
-// Ensure that BufferDestination satisfies the Destination interface at compile-time
+// Ensure that BufferDestination satisfies the interfaces at compile-time
 var _ auth.Destination = &BufferDestination{}
+var _ auth.MetadataDestination = &BufferDestination{}
+var _ auth.ContainerDestination = &BufferDestination{}
@@ -4,7 +4,8 @@ Package mock provides fake object storage endpoints for testing
 The structs defined here all implement the github.com/ibmjstart/swiftlygo/auth.Destination
 interface and are therefore useful for testing any code that
 uploads data via a destination. It includes an endpoint that does nothing,
-an endpoint that stores uploaded data in memory, and an endpoint that always
-generates errors.
+an endpoint that stores uploaded data in memory, an endpoint that always
+generates errors, and a wrapper that delays the uploads of another endpoint. It also includes S3Server, a fake S3-compatible object store
+for testing the auth.S3Destination.
 */
 package mock
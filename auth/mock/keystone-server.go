@@ -0,0 +1,98 @@
+package mock
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// KeystoneEndpoint is an object-store endpoint in the service catalog of a
+// KeystoneServer.
+type KeystoneEndpoint struct {
+	Interface string
+	Region    string
+	URL       string
+}
+
+// KeystoneServer is an in-memory fake of the OpenStack Identity v3 token API.
+// Serve it with net/http/httptest and use the server's URL with "/v3" appended
+// as an auth URL. Every authentication request succeeds and receives a new token
+// along with a service catalog containing the configured object-store endpoints.
+type KeystoneServer struct {
+	Catalog []KeystoneEndpoint
+	Expires time.Time
+
+	lock     sync.Mutex
+	requests []map[string]interface{}
+}
+
+// NewKeystoneServer creates a KeystoneServer whose catalog lists storageURL as
+// the public, internal, and admin object-store endpoint of RegionOne.
+func NewKeystoneServer(storageURL string) *KeystoneServer {
+	return &KeystoneServer{
+		Catalog: []KeystoneEndpoint{
+			{Interface: "public", Region: "RegionOne", URL: storageURL},
+			{Interface: "internal", Region: "RegionOne", URL: storageURL},
+			{Interface: "admin", Region: "RegionOne", URL: storageURL},
+		},
+		Expires: time.Now().Add(time.Hour),
+	}
+}
+
+// Requests returns the number of authentication requests that the server has received.
+func (k *KeystoneServer) Requests() int {
+	k.lock.Lock()
+	defer k.lock.Unlock()
+	return len(k.requests)
+}
+
+// LastRequest returns the decoded JSON body of the most recent authentication request.
+func (k *KeystoneServer) LastRequest() map[string]interface{} {
+	k.lock.Lock()
+	defer k.lock.Unlock()
+	if len(k.requests) == 0 {
+		return nil
+	}
+	return k.requests[len(k.requests)-1]
+}
+
+// ServeHTTP issues a token for every POST to /v3/auth/tokens.
+func (k *KeystoneServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost || strings.TrimSuffix(r.URL.Path, "/") != "/v3/auth/tokens" {
+		http.NotFound(w, r)
+		return
+	}
+	var request map[string]interface{}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	k.lock.Lock()
+	k.requests = append(k.requests, request)
+	token := fmt.Sprintf("token-%d", len(k.requests))
+	k.lock.Unlock()
+
+	endpoints := make([]map[string]string, len(k.Catalog))
+	for i, endpoint := range k.Catalog {
+		endpoints[i] = map[string]string{
+			"interface": endpoint.Interface,
+			"region":    endpoint.Region,
+			"region_id": endpoint.Region,
+			"url":       endpoint.URL,
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Subject-Token", token)
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"token": map[string]interface{}{
+			"expires_at": k.Expires.UTC().Format(time.RFC3339),
+			"catalog": []map[string]interface{}{
+				{"type": "object-store", "endpoints": endpoints},
+			},
+		},
+	})
+}
@@ -0,0 +1,115 @@
+package mock
+
+import (
+	"context"
+	"github.com/ibmjstart/swiftlygo/auth"
+	"time"
+)
+
+// LatencyDestination wraps another Destination and waits before creating each
+// file, which simulates a slow or unevenly loaded object store. It forwards
+// the methods of the optional Destination interfaces to the wrapped
+// Destination. If it does not implement them, contexts and metadata are
+// discarded, containers are assumed to exist, and the limits are those of
+// OpenStack Object Storage.
+type LatencyDestination struct {
+	auth.Destination
+	// Latency returns how long to wait before creating the given object.
+	Latency func(container, objectName string) time.Duration
+}
+
+// NewLatencyDestination creates a destination that waits for
+// latency(container, objectName) before passing each call to CreateFile on to
+// dest.
+func NewLatencyDestination(dest auth.Destination, latency func(container, objectName string) time.Duration) *LatencyDestination {
+	return &LatencyDestination{Destination: dest, Latency: latency}
+}
+
+// CreateFile waits for the latency of the object and then creates it in the
+// wrapped destination.
+func (l *LatencyDestination) CreateFile(container, objectName string, checkHash bool, Hash string) (auth.WriteCloseHeader, error) {
+	time.Sleep(l.Latency(container, objectName))
+	return l.Destination.CreateFile(container, objectName, checkHash, Hash)
+}
+
+// CreateFileContext is like CreateFile, but passes ctx on if the wrapped
+// destination takes it.
+func (l *LatencyDestination) CreateFileContext(ctx context.Context, container, objectName string, checkHash bool, hash string) (auth.WriteCloseHeader, error) {
+	contextual, ok := l.Destination.(auth.ContextDestination)
+	if !ok {
+		return l.CreateFile(container, objectName, checkHash, hash)
+	}
+	time.Sleep(l.Latency(container, objectName))
+	return contextual.CreateFileContext(ctx, container, objectName, checkHash, hash)
+}
+
+// CreateSLOContext creates the manifest in the wrapped destination, passing
+// ctx on if it takes it.
+func (l *LatencyDestination) CreateSLOContext(ctx context.Context, containerName, manifestName, manifestEtag string, sloManifestJSON []byte) error {
+	if contextual, ok := l.Destination.(auth.ContextDestination); ok {
+		return contextual.CreateSLOContext(ctx, containerName, manifestName, manifestEtag, sloManifestJSON)
+	}
+	return l.Destination.CreateSLO(containerName, manifestName, manifestEtag, sloManifestJSON)
+}
+
+// CreateFileMetadata is like CreateFileContext, but also stores metadata with
+// the object if the wrapped destination is able to.
+func (l *LatencyDestination) CreateFileMetadata(ctx context.Context, container, objectName string, checkHash bool, hash string, metadata map[string]string) (auth.WriteCloseHeader, error) {
+	described, ok := l.Destination.(auth.MetadataDestination)
+	if !ok {
+		return l.CreateFileContext(ctx, container, objectName, checkHash, hash)
+	}
+	time.Sleep(l.Latency(container, objectName))
+	return described.CreateFileMetadata(ctx, container, objectName, checkHash, hash, metadata)
+}
+
+// CreateSLOMetadata is like CreateSLOContext, but also stores metadata with the
+// manifest if the wrapped destination is able to.
+func (l *LatencyDestination) CreateSLOMetadata(ctx context.Context, containerName, manifestName, manifestEtag string, sloManifestJSON []byte, metadata map[string]string) error {
+	described, ok := l.Destination.(auth.MetadataDestination)
+	if !ok {
+		return l.CreateSLOContext(ctx, containerName, manifestName, manifestEtag, sloManifestJSON)
+	}
+	return described.CreateSLOMetadata(ctx, containerName, manifestName, manifestEtag, sloManifestJSON, metadata)
+}
+
+// ObjectMetadata returns the metadata of the object in the wrapped destination,
+// which is nil if it cannot store metadata.
+func (l *LatencyDestination) ObjectMetadata(container, objectName string) (map[string]string, error) {
+	if described, ok := l.Destination.(auth.MetadataDestination); ok {
+		return described.ObjectMetadata(container, objectName)
+	}
+	return nil, nil
+}
+
+// EnsureContainer creates the container in the wrapped destination if it is
+// able to.
+func (l *LatencyDestination) EnsureContainer(container string) error {
+	if creator, ok := l.Destination.(auth.ContainerDestination); ok {
+		return creator.EnsureContainer(container)
+	}
+	return nil
+}
+
+// SetConcurrency passes the number of uploads on to the wrapped destination if
+// it takes it.
+func (l *LatencyDestination) SetConcurrency(uploads uint) {
+	if concurrent, ok := l.Destination.(auth.ConcurrentDestination); ok {
+		concurrent.SetConcurrency(uploads)
+	}
+}
+
+// Limits returns the limits of the wrapped destination.
+func (l *LatencyDestination) Limits() auth.Limits {
+	if limited, ok := l.Destination.(auth.LimitedDestination); ok {
+		return limited.Limits()
+	}
+	return auth.SwiftLimits
+}
+
+// Ensure that LatencyDestination satisfies the interfaces at compile-time
+var _ auth.Destination = &LatencyDestination{}
+var _ auth.MetadataDestination = &LatencyDestination{}
+var _ auth.ContainerDestination = &LatencyDestination{}
+var _ auth.ConcurrentDestination = &LatencyDestination{}
+var _ auth.LimitedDestination = &LatencyDestination{}
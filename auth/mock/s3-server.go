@@ -0,0 +1,233 @@
+package mock
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// S3Server is an in-memory fake of the subset of the S3 API that
+// auth.S3Destination relies upon: bucket creation, multipart uploads, object
+// listings, and object retrieval. Serve it with net/http/httptest to test code that
+// uploads to S3-compatible object stores without a real one. It checks that
+// requests carry a signature, but does not validate them.
+type S3Server struct {
+	// MinPartSize is enforced for every part except the last when a multipart
+	// upload is completed, just as S3 does.
+	MinPartSize int
+
+	lock    sync.Mutex
+	buckets map[string]bool
+	objects map[string][]byte
+	uploads map[string]*s3ServerUpload
+	nextID  int
+}
+
+// s3ServerUpload holds the parts of an in-progress multipart upload.
+type s3ServerUpload struct {
+	key   string
+	parts map[int][]byte
+}
+
+// NewS3Server creates an empty S3Server that enforces the standard 5MiB
+// minimum part size.
+func NewS3Server() *S3Server {
+	return &S3Server{
+		MinPartSize: 5 * 1024 * 1024,
+		buckets:     make(map[string]bool),
+		objects:     make(map[string][]byte),
+		uploads:     make(map[string]*s3ServerUpload),
+	}
+}
+
+// Object returns the contents of the object with the given bucket and key, and
+// whether it exists.
+func (s *S3Server) Object(bucket, key string) ([]byte, bool) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	data, exists := s.objects[bucket+"/"+key]
+	return data, exists
+}
+
+// Bucket reports whether the bucket has been created. Objects may be uploaded
+// into buckets that have not been created.
+func (s *S3Server) Bucket(bucket string) bool {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.buckets[bucket]
+}
+
+// PendingUploads returns the number of multipart uploads that have been
+// initiated but neither completed nor aborted.
+func (s *S3Server) PendingUploads() int {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return len(s.uploads)
+}
+
+func etag(data []byte) string {
+	sum := md5.Sum(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// writeError sends an S3-style XML error document.
+func writeError(w http.ResponseWriter, status int, code, message string) {
+	w.WriteHeader(status)
+	fmt.Fprintf(w, "<Error><Code>%s</Code><Message>%s</Message></Error>", code, message)
+}
+
+// ServeHTTP dispatches path-style S3 requests.
+func (s *S3Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 ") {
+		writeError(w, http.StatusForbidden, "AccessDenied", "Request is not signed")
+		return
+	}
+	pathParts := strings.SplitN(strings.TrimPrefix(r.URL.Path, "/"), "/", 2)
+	bucket, key := pathParts[0], ""
+	if len(pathParts) > 1 {
+		key = pathParts[1]
+	}
+	query := r.URL.Query()
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	switch {
+	case r.Method == http.MethodHead && key == "":
+		if !s.buckets[bucket] {
+			w.WriteHeader(http.StatusNotFound)
+		}
+	case r.Method == http.MethodPut && key == "":
+		if s.buckets[bucket] {
+			writeError(w, http.StatusConflict, "BucketAlreadyOwnedByYou", "Your previous request to create the named bucket succeeded and you already own it.")
+			return
+		}
+		s.buckets[bucket] = true
+	case r.Method == http.MethodGet && key == "":
+		s.list(w, bucket)
+	case r.Method == http.MethodGet:
+		data, exists := s.objects[bucket+"/"+key]
+		if !exists {
+			writeError(w, http.StatusNotFound, "NoSuchKey", "The specified key does not exist.")
+			return
+		}
+		w.Header().Set("Etag", "\""+etag(data)+"\"")
+		w.Write(data)
+	case r.Method == http.MethodPost && query["uploads"] != nil:
+		s.nextID++
+		id := strconv.Itoa(s.nextID)
+		s.uploads[id] = &s3ServerUpload{key: bucket + "/" + key, parts: make(map[int][]byte)}
+		fmt.Fprintf(w, "<InitiateMultipartUploadResult><Bucket>%s</Bucket><Key>%s</Key><UploadId>%s</UploadId></InitiateMultipartUploadResult>", bucket, key, id)
+	case r.Method == http.MethodPut && query.Get("uploadId") != "":
+		s.uploadPart(w, r, bucket+"/"+key)
+	case r.Method == http.MethodPost && query.Get("uploadId") != "":
+		s.complete(w, r, bucket+"/"+key)
+	case r.Method == http.MethodDelete && query.Get("uploadId") != "":
+		s.abort(w, r, bucket+"/"+key)
+	default:
+		writeError(w, http.StatusNotImplemented, "NotImplemented", "The fake S3 server does not implement this request")
+	}
+}
+
+// list writes a ListObjectsV2 response containing every object in the bucket.
+func (s *S3Server) list(w http.ResponseWriter, bucket string) {
+	var keys []string
+	for path := range s.objects {
+		if strings.HasPrefix(path, bucket+"/") {
+			keys = append(keys, strings.TrimPrefix(path, bucket+"/"))
+		}
+	}
+	sort.Strings(keys)
+	fmt.Fprint(w, "<ListBucketResult><IsTruncated>false</IsTruncated>")
+	for _, key := range keys {
+		data := s.objects[bucket+"/"+key]
+		fmt.Fprintf(w, "<Contents><Key>%s</Key><LastModified>%s</LastModified><ETag>&quot;%s&quot;</ETag><Size>%d</Size></Contents>",
+			key, time.Now().UTC().Format(time.RFC3339), etag(data), len(data))
+	}
+	fmt.Fprint(w, "</ListBucketResult>")
+}
+
+// uploadPart stores a single part of a multipart upload.
+func (s *S3Server) uploadPart(w http.ResponseWriter, r *http.Request, path string) {
+	upload, exists := s.uploads[r.URL.Query().Get("uploadId")]
+	if !exists || upload.key != path {
+		writeError(w, http.StatusNotFound, "NoSuchUpload", "The specified upload does not exist.")
+		return
+	}
+	partNumber, err := strconv.Atoi(r.URL.Query().Get("partNumber"))
+	if err != nil || partNumber < 1 || partNumber > 10000 {
+		writeError(w, http.StatusBadRequest, "InvalidArgument", "Part number must be an integer between 1 and 10000")
+		return
+	}
+	data, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "IncompleteBody", err.Error())
+		return
+	}
+	upload.parts[partNumber] = data
+	w.Header().Set("Etag", "\""+etag(data)+"\"")
+}
+
+// complete assembles the listed parts of a multipart upload into an object.
+func (s *S3Server) complete(w http.ResponseWriter, r *http.Request, path string) {
+	id := r.URL.Query().Get("uploadId")
+	upload, exists := s.uploads[id]
+	if !exists || upload.key != path {
+		writeError(w, http.StatusNotFound, "NoSuchUpload", "The specified upload does not exist.")
+		return
+	}
+	var request struct {
+		Parts []struct {
+			PartNumber int
+			ETag       string
+		} `xml:"Part"`
+	}
+	if err := xml.NewDecoder(r.Body).Decode(&request); err != nil {
+		writeError(w, http.StatusBadRequest, "MalformedXML", err.Error())
+		return
+	}
+	var (
+		object   []byte
+		partSums []byte
+	)
+	for i, part := range request.Parts {
+		data, exists := upload.parts[part.PartNumber]
+		if !exists || strings.Trim(part.ETag, "\"") != etag(data) {
+			writeError(w, http.StatusBadRequest, "InvalidPart", fmt.Sprintf("Part %d could not be found", part.PartNumber))
+			return
+		} else if i > 0 && part.PartNumber <= request.Parts[i-1].PartNumber {
+			writeError(w, http.StatusBadRequest, "InvalidPartOrder", "The list of parts was not in ascending order.")
+			return
+		} else if i < len(request.Parts)-1 && len(data) < s.MinPartSize {
+			// S3 reports this error after sending a successful status code
+			writeError(w, http.StatusOK, "EntityTooSmall", "Your proposed upload is smaller than the minimum allowed size")
+			return
+		}
+		sum := md5.Sum(data)
+		partSums = append(partSums, sum[:]...)
+		object = append(object, data...)
+	}
+	s.objects[path] = object
+	delete(s.uploads, id)
+	sum := md5.Sum(partSums)
+	fmt.Fprintf(w, "<CompleteMultipartUploadResult><Key>%s</Key><ETag>&quot;%s-%d&quot;</ETag></CompleteMultipartUploadResult>",
+		path, hex.EncodeToString(sum[:]), len(request.Parts))
+}
+
+// abort discards an in-progress multipart upload and its parts.
+func (s *S3Server) abort(w http.ResponseWriter, r *http.Request, path string) {
+	id := r.URL.Query().Get("uploadId")
+	upload, exists := s.uploads[id]
+	if !exists || upload.key != path {
+		writeError(w, http.StatusNotFound, "NoSuchUpload", "The specified upload does not exist.")
+		return
+	}
+	delete(s.uploads, id)
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,121 @@
+package auth
+
+import (
+	"crypto/tls"
+	"github.com/ncw/swift"
+	"net"
+	"net/http"
+	"time"
+)
+
+// defaultMaxConnections matches the idle connection pool that swift.Connection
+// uses when it creates its own transport.
+const defaultMaxConnections = 512
+
+// settings collects the effects of a set of Options.
+type settings struct {
+	client         *http.Client
+	tlsConfig      *tls.Config
+	connectTimeout time.Duration
+	timeout        time.Duration
+	maxConnections int
+}
+
+// Option configures how a Destination communicates with object storage.
+type Option func(*settings)
+
+// WithHTTPClient makes every request to object storage, including logging in
+// and uploading manifests, use the provided client and its transport. It takes
+// precedence over WithTLSConfig and WithMaxConnections, which only affect the
+// transport that is created when no client is provided.
+func WithHTTPClient(client *http.Client) Option {
+	return func(s *settings) {
+		s.client = client
+	}
+}
+
+// WithTLSConfig sets the TLS configuration used for every request, for instance
+// to trust a private certificate authority or to present a client certificate.
+// Proxies are still taken from the environment (HTTPS_PROXY, NO_PROXY, ...).
+func WithTLSConfig(config *tls.Config) Option {
+	return func(s *settings) {
+		s.tlsConfig = config
+	}
+}
+
+// WithTimeouts limits how long a connection to object storage may take to open,
+// and how long any single request may go without making progress. Manifest
+// uploads, which are small, must also finish entirely within the request
+// timeout. Zero leaves the default timeouts of 10 and 60 seconds for opening
+// connections and making progress in place, and does not limit manifest uploads.
+func WithTimeouts(connect, request time.Duration) Option {
+	return func(s *settings) {
+		s.connectTimeout = connect
+		s.timeout = request
+	}
+}
+
+// WithMaxConnections sizes the pool of idle connections kept open to object
+// storage. Uploaders also size it to match their concurrency, so this is only
+// needed when using a Destination directly.
+func WithMaxConnections(connections int) Option {
+	return func(s *settings) {
+		s.maxConnections = connections
+	}
+}
+
+// newSettings applies the options to the default settings.
+func newSettings(opts []Option) settings {
+	var s settings
+	for _, opt := range opts {
+		opt(&s)
+	}
+	return s
+}
+
+// transport creates an HTTP transport that follows the settings.
+func (s settings) transport() *http.Transport {
+	connectTimeout := s.connectTimeout
+	if connectTimeout == 0 {
+		connectTimeout = 10 * time.Second
+	}
+	maxConnections := s.maxConnections
+	if maxConnections == 0 {
+		maxConnections = defaultMaxConnections
+	}
+	return &http.Transport{
+		Proxy: http.ProxyFromEnvironment,
+		DialContext: (&net.Dialer{
+			Timeout:   connectTimeout,
+			KeepAlive: 30 * time.Second,
+		}).DialContext,
+		TLSClientConfig:       s.tlsConfig,
+		TLSHandshakeTimeout:   connectTimeout,
+		ResponseHeaderTimeout: s.timeout,
+		ExpectContinueTimeout: 5 * time.Second,
+		MaxIdleConnsPerHost:   maxConnections,
+		IdleConnTimeout:       90 * time.Second,
+	}
+}
+
+// newSwiftDestination applies the options to the connection and wraps it in a
+// SwiftDestination.
+func newSwiftDestination(connection *swift.Connection, opts []Option) *SwiftDestination {
+	s := newSettings(opts)
+	connection.ConnectTimeout = s.connectTimeout
+	connection.Timeout = s.timeout
+	destination := &SwiftDestination{SwiftConnection: connection}
+	if s.client != nil {
+		destination.Client = s.client
+		connection.Transport = s.client.Transport
+		if connection.Transport == nil {
+			connection.Transport = http.DefaultTransport
+		}
+		return destination
+	}
+	transport := s.transport()
+	connection.Transport = transport
+	destination.transport = transport
+	destination.Client = &http.Client{Transport: transport, Timeout: s.timeout}
+	return destination
+}
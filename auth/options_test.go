@@ -0,0 +1,122 @@
+package auth_test
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"github.com/ibmjstart/swiftlygo/auth"
+	"github.com/ncw/swift/swifttest"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+// countingTransport counts the requests that pass through it.
+type countingTransport struct {
+	requests int32
+}
+
+func (c *countingTransport) RoundTrip(request *http.Request) (*http.Response, error) {
+	atomic.AddInt32(&c.requests, 1)
+	return http.DefaultTransport.RoundTrip(request)
+}
+
+var _ = Describe("Destination options", func() {
+	var (
+		server    *swifttest.SwiftServer
+		delay     time.Duration
+		tlsServer *httptest.Server
+	)
+
+	BeforeEach(func() {
+		var err error
+		server, err = swifttest.NewSwiftServer("localhost")
+		Expect(err).ShouldNot(HaveOccurred())
+		delay = 0
+		tlsServer = httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			time.Sleep(delay)
+			w.WriteHeader(http.StatusCreated)
+		}))
+	})
+
+	AfterEach(func() {
+		server.Close()
+		tlsServer.Close()
+	})
+
+	// trusted returns a TLS configuration that trusts the TLS server.
+	trusted := func() *tls.Config {
+		pool := x509.NewCertPool()
+		pool.AddCert(tlsServer.Certificate())
+		return &tls.Config{RootCAs: pool}
+	}
+
+	Context("With an HTTP client", func() {
+		It("Should use the client for logging in and for manifests", func() {
+			transport := &countingTransport{}
+			destination, err := auth.AuthenticateWithCredentials(auth.Credentials{
+				AuthURL:  server.AuthURL,
+				Username: swifttest.TEST_ACCOUNT,
+				Password: swifttest.TEST_ACCOUNT,
+			}, auth.WithHTTPClient(&http.Client{Transport: transport}))
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(atomic.LoadInt32(&transport.requests)).To(BeEquivalentTo(1))
+			Expect(destination.(*auth.SwiftDestination).SwiftConnection.ContainerCreate("container", nil)).To(Succeed())
+			Expect(destination.CreateDLO("container", "manifest", "container", "prefix")).To(Succeed())
+			Expect(atomic.LoadInt32(&transport.requests)).To(BeEquivalentTo(3))
+		})
+	})
+	Context("With a TLS configuration", func() {
+		It("Should trust the configured certificate authorities", func() {
+			destination, err := auth.AuthenticateWithToken("token", tlsServer.URL, auth.WithTLSConfig(trusted()))
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(destination.CreateDLO("container", "manifest", "container", "prefix")).To(Succeed())
+		})
+		It("Should not trust other certificate authorities", func() {
+			destination, err := auth.AuthenticateWithToken("token", tlsServer.URL)
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(destination.CreateDLO("container", "manifest", "container", "prefix")).NotTo(Succeed())
+		})
+	})
+	Context("With a request timeout", func() {
+		It("Should give up on slow manifest uploads", func() {
+			delay = 200 * time.Millisecond
+			destination, err := auth.AuthenticateWithToken("token", tlsServer.URL,
+				auth.WithTLSConfig(trusted()), auth.WithTimeouts(time.Second, 50*time.Millisecond))
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(destination.CreateDLO("container", "manifest", "container", "prefix")).NotTo(Succeed())
+			Expect(destination.CreateSLO("container", "manifest", "", []byte("[]"))).NotTo(Succeed())
+		})
+	})
+	Context("When object storage is unreachable", func() {
+		It("Should return errors from manifest uploads", func() {
+			tlsServer.Close()
+			destination, err := auth.AuthenticateWithToken("token", tlsServer.URL)
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(destination.CreateDLO("container", "manifest", "container", "prefix")).NotTo(Succeed())
+			Expect(destination.CreateSLO("container", "manifest", "", []byte("[]"))).NotTo(Succeed())
+		})
+	})
+	Context("When setting the concurrency", func() {
+		idleConnections := func(destination auth.Destination) int {
+			return destination.(*auth.SwiftDestination).SwiftConnection.Transport.(*http.Transport).MaxIdleConnsPerHost
+		}
+		It("Should grow the connection pool to match", func() {
+			destination, err := auth.AuthenticateWithToken("token", tlsServer.URL, auth.WithMaxConnections(2))
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(idleConnections(destination)).To(Equal(2))
+			destination.(auth.ConcurrentDestination).SetConcurrency(8)
+			Expect(idleConnections(destination)).To(Equal(9))
+		})
+		It("Should leave the transport of a provided client alone", func() {
+			transport := &http.Transport{MaxIdleConnsPerHost: 2}
+			destination, err := auth.AuthenticateWithToken("token", tlsServer.URL, auth.WithHTTPClient(&http.Client{Transport: transport}))
+			Expect(err).ShouldNot(HaveOccurred())
+			destination.(auth.ConcurrentDestination).SetConcurrency(8)
+			Expect(transport.MaxIdleConnsPerHost).To(Equal(2))
+		})
+	})
+})
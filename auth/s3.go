@@ -0,0 +1,614 @@
+package auth
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"github.com/ncw/swift"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// S3MinPartSize is the smallest size that S3 allows for any part of a
+	// multipart upload other than the last.
+	S3MinPartSize uint = 5 * 1024 * 1024
+
+	// S3MaxPartSize is the largest size that S3 allows for a single part.
+	S3MaxPartSize uint = 5 * 1024 * 1024 * 1024
+
+	// S3MaxParts is the largest number of parts that S3 allows within a
+	// single multipart upload.
+	S3MaxParts uint = 10000
+)
+
+// S3PartPattern matches the object names that the SloUploader assigns to file
+// chunks. S3Destination uses it to recover the name of the final object, the
+// chunk number, and the chunk size from the name of each chunk it is asked to
+// create.
+var S3PartPattern = regexp.MustCompile(`^(.+)-chunk-([0-9]+)-size-([0-9]+)$`)
+
+// S3Destination implements the Destination interface for S3-compatible object
+// stores (Ceph RGW, MinIO, AWS) by mapping the SLO upload process onto an S3
+// multipart upload.
+//
+// Each chunk created with CreateFile becomes a part of a multipart upload for the
+// object that the chunk belongs to. SLO manifests passed to CreateSLO are recorded
+// in memory, and the manifest whose name matches the object being uploaded completes
+// the multipart upload. Because the state of in-progress multipart uploads is kept in
+// memory, a single S3Destination must be used for the entire upload of an object,
+// and uploads cannot be resumed by another process.
+//
+// Buckets play the role of containers. S3 has no equivalent to Dynamic Large
+// Objects, so CreateDLO always fails.
+type S3Destination struct {
+	Endpoint        string
+	Region          string
+	AccessKeyID     string
+	SecretAccessKey string
+	Client          *http.Client
+
+	lock      sync.Mutex
+	uploads   map[string]*s3Upload
+	manifests map[string][]s3Part
+}
+
+// s3Upload tracks a multipart upload that has been initiated but not yet completed.
+type s3Upload struct {
+	id string
+}
+
+// s3Part is a single part of a multipart upload, as referenced by a manifest.
+type s3Part struct {
+	Path   string
+	Number int
+	ETag   string
+}
+
+// s3PartWriter streams the data written to it into the body of an UploadPart request.
+type s3PartWriter struct {
+	*io.PipeWriter
+	done chan struct{}
+	etag string
+	err  error
+}
+
+// Close finishes the part upload and waits for the object store to respond.
+func (p *s3PartWriter) Close() error {
+	if err := p.PipeWriter.Close(); err != nil {
+		return err
+	}
+	<-p.done
+	return p.err
+}
+
+// Headers returns the Etag of the uploaded part. It is only valid after Close.
+func (p *s3PartWriter) Headers() (swift.Headers, error) {
+	<-p.done
+	if p.err != nil {
+		return nil, p.err
+	}
+	return swift.Headers{"Etag": p.etag}, nil
+}
+
+// s3ManifestEntry is a single segment within an SLO manifest.
+type s3ManifestEntry struct {
+	Path      string `json:"path"`
+	Etag      string `json:"etag"`
+	SizeBytes uint   `json:"size_bytes"`
+}
+
+type s3InitiateResult struct {
+	UploadID string `xml:"UploadId"`
+}
+
+type s3CompletePart struct {
+	PartNumber int
+	ETag       string
+}
+
+type s3CompleteUpload struct {
+	XMLName xml.Name         `xml:"CompleteMultipartUpload"`
+	Parts   []s3CompletePart `xml:"Part"`
+}
+
+type s3CompleteResult struct {
+	XMLName xml.Name
+	ETag    string
+	Code    string
+	Message string
+}
+
+type s3ListResult struct {
+	Contents []struct {
+		Key          string
+		LastModified time.Time
+		ETag         string
+		Size         int64
+	}
+	IsTruncated           bool
+	NextContinuationToken string
+}
+
+type s3CreateBucket struct {
+	XMLName            xml.Name `xml:"CreateBucketConfiguration"`
+	LocationConstraint string
+}
+
+type s3Error struct {
+	Code    string
+	Message string
+}
+
+// NewS3Destination creates a Destination that uploads to the S3-compatible object store
+// at the given endpoint (for example "http://localhost:9000"). Requests are signed with
+// AWS Signature Version 4 using the provided region and keys and are addressed
+// path-style, which is what Ceph RGW and MinIO expect. The options configure the
+// HTTP client used for every request.
+func NewS3Destination(endpoint, region, accessKeyID, secretAccessKey string, opts ...Option) *S3Destination {
+	if region == "" {
+		region = "us-east-1"
+	}
+	settings := newSettings(opts)
+	client := settings.client
+	if client == nil {
+		// Parts are large, so rely on the transport's timeouts rather than
+		// limiting the duration of entire requests
+		client = &http.Client{Transport: settings.transport()}
+	}
+	return &S3Destination{
+		Endpoint:        strings.TrimRight(endpoint, "/"),
+		Region:          region,
+		AccessKeyID:     accessKeyID,
+		SecretAccessKey: secretAccessKey,
+		Client:          client,
+		uploads:         make(map[string]*s3Upload),
+		manifests:       make(map[string][]s3Part),
+	}
+}
+
+// Limits reports the part size and part count constraints of S3 multipart uploads.
+func (s *S3Destination) Limits() Limits {
+	return Limits{
+		MinChunkSize: S3MinPartSize,
+		MaxChunkSize: S3MaxPartSize,
+		MaxChunks:    S3MaxParts,
+	}
+}
+
+// parseS3PartName splits the name of a chunk into the name of the object that it
+// belongs to, its one-based part number, and its size.
+func parseS3PartName(objectName string) (string, int, uint, error) {
+	matches := S3PartPattern.FindStringSubmatch(objectName)
+	if len(matches) < 4 {
+		return "", 0, 0, fmt.Errorf("Unable to determine the part number of object %s", objectName)
+	}
+	chunkNumber, err := strconv.Atoi(matches[2])
+	if err != nil {
+		return "", 0, 0, fmt.Errorf("Unable to convert chunk number %s to an integer", matches[2])
+	}
+	size, err := strconv.ParseUint(matches[3], 10, 64)
+	if err != nil {
+		return "", 0, 0, fmt.Errorf("Unable to convert chunk size %s to an integer", matches[3])
+	}
+	if uint(chunkNumber) >= S3MaxParts {
+		return "", 0, 0, fmt.Errorf("Chunk %d exceeds the S3 limit of %d parts", chunkNumber, S3MaxParts)
+	}
+	return matches[1], chunkNumber + 1, uint(size), nil
+}
+
+// upload retrieves the multipart upload for the given object, initiating it if
+// it does not yet exist.
+func (s *S3Destination) upload(bucket, key string) (*s3Upload, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if upload, exists := s.uploads[bucket+"/"+key]; exists {
+		return upload, nil
+	}
+	_, body, err := s.do(http.MethodPost, bucket, key, url.Values{"uploads": {""}}, nil)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to initiate multipart upload for %s/%s: %w", bucket, key, err)
+	}
+	var result s3InitiateResult
+	if err = xml.Unmarshal(body, &result); err != nil || result.UploadID == "" {
+		return nil, fmt.Errorf("Failed to read the upload ID for %s/%s: %s", bucket, key, body)
+	}
+	upload := &s3Upload{id: result.UploadID}
+	s.uploads[bucket+"/"+key] = upload
+	return upload, nil
+}
+
+// CreateFile begins uploading a part of a multipart upload. The objectName must match
+// S3PartPattern so that the part number and size can be determined. Write exactly the
+// number of bytes in the name to the returned WriteCloser and then close it to
+// finish uploading the part.
+func (s *S3Destination) CreateFile(bucket, objectName string, checkHash bool, Hash string) (WriteCloseHeader, error) {
+	key, partNumber, size, err := parseS3PartName(objectName)
+	if err != nil {
+		return nil, err
+	}
+	upload, err := s.upload(bucket, key)
+	if err != nil {
+		return nil, err
+	}
+	reader, writer := io.Pipe()
+	request, err := s.newRequest(http.MethodPut, bucket, key, url.Values{
+		"partNumber": {strconv.Itoa(partNumber)},
+		"uploadId":   {upload.id},
+	}, reader, "UNSIGNED-PAYLOAD")
+	if err != nil {
+		return nil, err
+	}
+	request.ContentLength = int64(size)
+	if checkHash && Hash != "" {
+		sum, err := hex.DecodeString(Hash)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid hash %s for part %s: %w", Hash, objectName, err)
+		}
+		request.Header.Set("Content-Md5", base64.StdEncoding.EncodeToString(sum))
+	}
+	part := &s3PartWriter{PipeWriter: writer, done: make(chan struct{})}
+	go func() {
+		defer close(part.done)
+		headers, _, err := s.send(request)
+		if err != nil {
+			part.err = fmt.Errorf("Failed to upload part %d of %s/%s: %w", partNumber, bucket, key, err)
+			reader.CloseWithError(part.err)
+			return
+		}
+		reader.Close()
+		part.etag = strings.Trim(headers.Get("Etag"), "\"")
+	}()
+	return part, nil
+}
+
+// CreateSLO records the manifest so that it can be referenced by later manifests. If
+// the manifest has the same name as an object with a multipart upload in progress, the
+// parts referenced by the manifest are used to complete that upload, which is aborted
+// if it cannot be completed.
+func (s *S3Destination) CreateSLO(bucket, manifestName, manifestEtag string, sloManifestJSON []byte) error {
+	var (
+		entries []s3ManifestEntry
+		parts   []s3Part
+		etags   string
+	)
+	if err := json.Unmarshal(sloManifestJSON, &entries); err != nil {
+		return fmt.Errorf("Failed to parse manifest %s: %w", manifestName, err)
+	}
+	s.lock.Lock()
+	for _, entry := range entries {
+		etags += entry.Etag
+		if subParts, isManifest := s.manifests[entry.Path]; isManifest {
+			parts = append(parts, subParts...)
+			continue
+		}
+		pathParts := strings.SplitN(entry.Path, "/", 2)
+		if len(pathParts) < 2 {
+			s.lock.Unlock()
+			return fmt.Errorf("Manifest %s references invalid path %s", manifestName, entry.Path)
+		}
+		key, partNumber, _, err := parseS3PartName(pathParts[1])
+		if err != nil {
+			s.lock.Unlock()
+			return fmt.Errorf("Manifest %s references %s, which is neither a part nor a manifest", manifestName, entry.Path)
+		}
+		parts = append(parts, s3Part{Path: pathParts[0] + "/" + key, Number: partNumber, ETag: entry.Etag})
+	}
+	upload, completesUpload := s.uploads[bucket+"/"+manifestName]
+	if !completesUpload {
+		s.manifests[bucket+"/"+manifestName] = parts
+	}
+	s.lock.Unlock()
+
+	if !completesUpload {
+		sum := md5.Sum([]byte(etags))
+		if etag := hex.EncodeToString(sum[:]); etag != manifestEtag {
+			return &ManifestEtagMismatchError{Container: bucket, Manifest: manifestName, Expected: manifestEtag, Actual: etag}
+		}
+		return nil
+	}
+	if err := s.complete(bucket, manifestName, upload, parts); err != nil {
+		// The error completing the upload explains more than one aborting it
+		_ = s.Abort(bucket, manifestName)
+		return err
+	}
+	return nil
+}
+
+// complete finishes a multipart upload with the provided parts and checks that the
+// resulting object has the expected multipart Etag.
+func (s *S3Destination) complete(bucket, key string, upload *s3Upload, parts []s3Part) error {
+	sort.Slice(parts, func(i, j int) bool { return parts[i].Number < parts[j].Number })
+	request := s3CompleteUpload{}
+	var partSums []byte
+	for _, part := range parts {
+		if part.Path != bucket+"/"+key {
+			return fmt.Errorf("Manifest %s/%s references part %d of a different object %s", bucket, key, part.Number, part.Path)
+		}
+		sum, err := hex.DecodeString(part.ETag)
+		if err != nil {
+			return fmt.Errorf("Part %d of %s/%s has invalid etag %s", part.Number, bucket, key, part.ETag)
+		}
+		partSums = append(partSums, sum...)
+		request.Parts = append(request.Parts, s3CompletePart{PartNumber: part.Number, ETag: "\"" + part.ETag + "\""})
+	}
+	body, err := xml.Marshal(request)
+	if err != nil {
+		return fmt.Errorf("Failed to generate request to complete %s/%s: %w", bucket, key, err)
+	}
+	_, response, err := s.do(http.MethodPost, bucket, key, url.Values{"uploadId": {upload.id}}, body)
+	if err != nil {
+		return fmt.Errorf("Failed to complete multipart upload of %s/%s: %w", bucket, key, err)
+	}
+	// S3 can report a failure to complete the upload after it has already sent a
+	// successful status code, so the body needs to be checked for errors as well.
+	var result s3CompleteResult
+	if err = xml.Unmarshal(response, &result); err != nil {
+		return fmt.Errorf("Failed to read the result of completing %s/%s: %w", bucket, key, err)
+	} else if result.XMLName.Local == "Error" {
+		return fmt.Errorf("Failed to complete multipart upload of %s/%s: %s: %s", bucket, key, result.Code, result.Message)
+	}
+	// The upload is over even if the object is not what was expected
+	s.lock.Lock()
+	delete(s.uploads, bucket+"/"+key)
+	s.lock.Unlock()
+	sum := md5.Sum(partSums)
+	expected := fmt.Sprintf("%s-%d", hex.EncodeToString(sum[:]), len(parts))
+	if etag := strings.Trim(result.ETag, "\""); etag != expected {
+		return &ManifestEtagMismatchError{Container: bucket, Manifest: key, Expected: expected, Actual: etag}
+	}
+	return nil
+}
+
+// Abort abandons the multipart upload of an object if one is in progress, so
+// that the object store discards the parts that were uploaded for it rather
+// than keeping them until they expire. Parts that fail to upload leave the
+// upload in progress so that they can be retried, so uploads that are given up
+// on must be aborted.
+func (s *S3Destination) Abort(bucket, key string) error {
+	s.lock.Lock()
+	upload, exists := s.uploads[bucket+"/"+key]
+	delete(s.uploads, bucket+"/"+key)
+	s.lock.Unlock()
+	if !exists {
+		return nil
+	}
+	if _, _, err := s.do(http.MethodDelete, bucket, key, url.Values{"uploadId": {upload.id}}, nil); err != nil {
+		return fmt.Errorf("Failed to abort multipart upload of %s/%s: %w", bucket, key, err)
+	}
+	return nil
+}
+
+// CreateDLO always fails, since S3 has no equivalent to Dynamic Large Objects.
+func (s *S3Destination) CreateDLO(manifestContainer, manifestName, objectContainer, filenamePrefix string) error {
+	return fmt.Errorf("S3 object stores do not support Dynamic Large Objects")
+}
+
+// EnsureContainer creates the bucket unless it already exists. Outside of the
+// default region, the bucket is created in the destination's Region. A bucket
+// that the user may not look up is assumed to exist.
+func (s *S3Destination) EnsureContainer(bucket string) error {
+	_, _, err := s.do(http.MethodHead, bucket, "", nil, nil)
+	var statusErr *HTTPStatusError
+	if !errors.As(err, &statusErr) {
+		return err
+	} else if statusErr.Code == http.StatusForbidden {
+		return nil
+	} else if statusErr.Code != http.StatusNotFound {
+		return err
+	}
+	var body []byte
+	if s.Region != "us-east-1" {
+		body, err = xml.Marshal(s3CreateBucket{LocationConstraint: s.Region})
+		if err != nil {
+			return err
+		}
+	}
+	if _, _, err = s.do(http.MethodPut, bucket, "", nil, body); err != nil {
+		return fmt.Errorf("Failed to create bucket %s: %w", bucket, err)
+	}
+	return nil
+}
+
+// FileNames returns a slice of the names of all objects in the bucket.
+func (s *S3Destination) FileNames(bucket string) ([]string, error) {
+	objects, err := s.Objects(bucket)
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, len(objects))
+	for i, object := range objects {
+		names[i] = object.Name
+	}
+	return names, nil
+}
+
+// Objects returns a slice of swift Objects describing every object in the bucket.
+// Parts of multipart uploads that have not been completed are not objects, so they
+// are not included.
+func (s *S3Destination) Objects(bucket string) ([]swift.Object, error) {
+	var (
+		objects []swift.Object
+		token   string
+	)
+	for {
+		query := url.Values{"list-type": {"2"}}
+		if token != "" {
+			query.Set("continuation-token", token)
+		}
+		_, body, err := s.do(http.MethodGet, bucket, "", query, nil)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to list objects in bucket %s: %w", bucket, err)
+		}
+		var result s3ListResult
+		if err = xml.Unmarshal(body, &result); err != nil {
+			return nil, fmt.Errorf("Failed to parse object listing for bucket %s: %w", bucket, err)
+		}
+		for _, content := range result.Contents {
+			objects = append(objects, swift.Object{
+				Name:         content.Key,
+				Bytes:        content.Size,
+				Hash:         strings.Trim(content.ETag, "\""),
+				LastModified: content.LastModified,
+			})
+		}
+		if !result.IsTruncated {
+			return objects, nil
+		}
+		token = result.NextContinuationToken
+	}
+}
+
+// do sends a request with an in-memory body and returns the response headers and body.
+func (s *S3Destination) do(method, bucket, key string, query url.Values, body []byte) (http.Header, []byte, error) {
+	payloadHash := sha256.Sum256(body)
+	request, err := s.newRequest(method, bucket, key, query, bytes.NewReader(body), hex.EncodeToString(payloadHash[:]))
+	if err != nil {
+		return nil, nil, err
+	}
+	return s.send(request)
+}
+
+// send performs the request and converts error responses into errors.
+func (s *S3Destination) send(request *http.Request) (http.Header, []byte, error) {
+	response, err := s.Client.Do(request)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer response.Body.Close()
+	body, err := ioutil.ReadAll(response.Body)
+	if err != nil {
+		return nil, nil, err
+	}
+	if response.StatusCode < 200 || response.StatusCode >= 300 {
+		var reason s3Error
+		if xml.Unmarshal(body, &reason) == nil && reason.Code != "" {
+			return nil, nil, newHTTPStatusError(response, reason.Code+": "+reason.Message)
+		}
+		return nil, nil, newHTTPStatusError(response, string(body))
+	}
+	return response.Header, body, nil
+}
+
+// newRequest creates a signed path-style request for the given bucket and key.
+func (s *S3Destination) newRequest(method, bucket, key string, query url.Values, body io.Reader, payloadHash string) (*http.Request, error) {
+	path := "/" + bucket
+	if key != "" {
+		path += "/" + key
+	}
+	target := s.Endpoint + s3Escape(path, false)
+	if len(query) > 0 {
+		target += "?" + s3CanonicalQuery(query)
+	}
+	request, err := http.NewRequest(method, target, body)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to create request for %s: %w", path, err)
+	}
+	s.sign(request, path, query, payloadHash, time.Now())
+	return request, nil
+}
+
+// sign adds an AWS Signature Version 4 Authorization header to the request.
+func (s *S3Destination) sign(request *http.Request, path string, query url.Values, payloadHash string, now time.Time) {
+	amzDate := now.UTC().Format("20060102T150405Z")
+	scope := amzDate[:8] + "/" + s.Region + "/s3/aws4_request"
+	request.Header.Set("X-Amz-Date", amzDate)
+	request.Header.Set("X-Amz-Content-Sha256", payloadHash)
+
+	headers := map[string]string{
+		"host":                 request.URL.Host,
+		"x-amz-content-sha256": payloadHash,
+		"x-amz-date":           amzDate,
+	}
+	if contentMD5 := request.Header.Get("Content-Md5"); contentMD5 != "" {
+		headers["content-md5"] = contentMD5
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var canonicalHeaders string
+	for _, name := range names {
+		canonicalHeaders += name + ":" + strings.TrimSpace(headers[name]) + "\n"
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		request.Method,
+		s3Escape(path, false),
+		s3CanonicalQuery(query),
+		canonicalHeaders,
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+	requestHash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(requestHash[:])
+
+	key := []byte("AWS4" + s.SecretAccessKey)
+	for _, part := range []string{amzDate[:8], s.Region, "s3", "aws4_request"} {
+		key = hmacSHA256(key, part)
+	}
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+	request.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		s.AccessKeyID, scope, signedHeaders, signature))
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+// s3CanonicalQuery encodes the query string the way that Signature Version 4 expects.
+func s3CanonicalQuery(query url.Values) string {
+	keys := make([]string, 0, len(query))
+	for key := range query {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	var pairs []string
+	for _, key := range keys {
+		for _, value := range query[key] {
+			pairs = append(pairs, s3Escape(key, true)+"="+s3Escape(value, true))
+		}
+	}
+	return strings.Join(pairs, "&")
+}
+
+// s3Escape percent-encodes every byte except the unreserved characters, as required by
+// Signature Version 4. Slashes are left alone unless encodeSlash is set.
+func s3Escape(str string, encodeSlash bool) string {
+	var escaped strings.Builder
+	for _, b := range []byte(str) {
+		switch {
+		case 'A' <= b && b <= 'Z', 'a' <= b && b <= 'z', '0' <= b && b <= '9',
+			b == '-', b == '_', b == '.', b == '~':
+			escaped.WriteByte(b)
+		case b == '/' && !encodeSlash:
+			escaped.WriteByte(b)
+		default:
+			fmt.Fprintf(&escaped, "%%%02X", b)
+		}
+	}
+	return escaped.String()
+}
+
+// Ensure that S3Destination satisfies the interfaces at compile-time
+var _ LimitedDestination = &S3Destination{}
+var _ ContainerDestination = &S3Destination{}
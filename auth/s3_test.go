@@ -0,0 +1,178 @@
+package auth_test
+
+import (
+	"bytes"
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"github.com/ibmjstart/swiftlygo/auth"
+	"github.com/ibmjstart/swiftlygo/auth/mock"
+	"github.com/ibmjstart/swiftlygo/pipeline"
+	"net/http/httptest"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("S3Destination", func() {
+	var (
+		server      *mock.S3Server
+		httpServer  *httptest.Server
+		destination *auth.S3Destination
+	)
+
+	BeforeEach(func() {
+		server = mock.NewS3Server()
+		server.MinPartSize = 4
+		httpServer = httptest.NewServer(server)
+		destination = auth.NewS3Destination(httpServer.URL, "", "access", "secret")
+	})
+
+	AfterEach(func() {
+		httpServer.Close()
+	})
+
+	// uploadPart writes data as the chunk with the given number and returns the
+	// resulting chunk with its hash.
+	uploadPart := func(number uint, data []byte) pipeline.FileChunk {
+		chunk := pipeline.FileChunk{
+			Number:    number,
+			Container: "bucket",
+			Object:    fmt.Sprintf("object-chunk-%04d-size-%d", number, len(data)),
+			Size:      uint(len(data)),
+		}
+		upload, err := destination.CreateFile(chunk.Container, chunk.Object, true, "")
+		Expect(err).ShouldNot(HaveOccurred())
+		_, err = upload.Write(data)
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(upload.Close()).To(Succeed())
+		headers, err := upload.Headers()
+		Expect(err).ShouldNot(HaveOccurred())
+		chunk.Hash = headers["Etag"]
+		return chunk
+	}
+
+	// manifest builds an SLO manifest out of chunks and returns its JSON and hash.
+	manifest := func(chunks ...pipeline.FileChunk) ([]byte, string) {
+		var etags string
+		for _, chunk := range chunks {
+			etags += chunk.Hash
+		}
+		sum := md5.Sum([]byte(etags))
+		data, err := json.Marshal(chunks)
+		Expect(err).ShouldNot(HaveOccurred())
+		return data, hex.EncodeToString(sum[:])
+	}
+
+	Describe("Reporting limits", func() {
+		It("Should report the S3 multipart limits", func() {
+			limits := destination.Limits()
+			Expect(limits.MinChunkSize).To(Equal(auth.S3MinPartSize))
+			Expect(limits.MaxChunks).To(Equal(auth.S3MaxParts))
+		})
+	})
+	Describe("Uploading chunks", func() {
+		Context("With names that do not follow the chunk naming scheme", func() {
+			It("Should return an error", func() {
+				_, err := destination.CreateFile("bucket", "object", true, "")
+				Expect(err).Should(HaveOccurred())
+			})
+		})
+		Context("With a part number larger than S3 allows", func() {
+			It("Should return an error", func() {
+				_, err := destination.CreateFile("bucket", "object-chunk-10000-size-5", true, "")
+				Expect(err).Should(HaveOccurred())
+			})
+		})
+		Context("With the wrong number of bytes", func() {
+			It("Should fail to close the upload", func() {
+				upload, err := destination.CreateFile("bucket", "object-chunk-0000-size-10", true, "")
+				Expect(err).ShouldNot(HaveOccurred())
+				_, err = upload.Write([]byte("short"))
+				Expect(err).ShouldNot(HaveOccurred())
+				Expect(upload.Close()).ShouldNot(Succeed())
+			})
+			It("Should discard the upload once it is aborted", func() {
+				upload, err := destination.CreateFile("bucket", "object-chunk-0000-size-10", true, "")
+				Expect(err).ShouldNot(HaveOccurred())
+				_, err = upload.Write([]byte("short"))
+				Expect(err).ShouldNot(HaveOccurred())
+				Expect(upload.Close()).ShouldNot(Succeed())
+				Expect(server.PendingUploads()).To(Equal(1))
+				Expect(destination.Abort("bucket", "object")).To(Succeed())
+				Expect(server.PendingUploads()).To(Equal(0))
+				Expect(destination.Abort("bucket", "object")).To(Succeed())
+			})
+		})
+	})
+	Describe("Uploading manifests", func() {
+		Context("That reference every part of the object", func() {
+			It("Should assemble the object from its parts", func() {
+				first := uploadPart(0, []byte("first "))
+				second := uploadPart(1, []byte("second"))
+				layerOne, layerOneHash := manifest(first, second)
+				Expect(destination.CreateSLO("bucket", "object-manifest-0000", layerOneHash, layerOne)).To(Succeed())
+				Expect(server.PendingUploads()).To(Equal(1))
+
+				subManifest := pipeline.FileChunk{Container: "bucket", Object: "object-manifest-0000", Hash: layerOneHash, Size: 12}
+				top, topHash := manifest(subManifest)
+				Expect(destination.CreateSLO("bucket", "object", topHash, top)).To(Succeed())
+
+				data, exists := server.Object("bucket", "object")
+				Expect(exists).To(BeTrue())
+				Expect(data).To(Equal([]byte("first second")))
+				Expect(server.PendingUploads()).To(Equal(0))
+			})
+		})
+		Context("With the wrong manifest hash", func() {
+			It("Should return an error", func() {
+				layerOne, _ := manifest(uploadPart(0, []byte("data")))
+				Expect(destination.CreateSLO("bucket", "object-manifest-0000", "wrong", layerOne)).ShouldNot(Succeed())
+			})
+		})
+		Context("With parts smaller than the minimum part size", func() {
+			It("Should return an error even though S3 reports success", func() {
+				top, topHash := manifest(uploadPart(0, []byte("a")), uploadPart(1, []byte("b")))
+				Expect(destination.CreateSLO("bucket", "object", topHash, top)).ShouldNot(Succeed())
+				_, exists := server.Object("bucket", "object")
+				Expect(exists).To(BeFalse())
+				Expect(server.PendingUploads()).To(Equal(0))
+			})
+		})
+	})
+	Describe("Listing objects", func() {
+		It("Should list completed objects with their sizes", func() {
+			top, topHash := manifest(uploadPart(0, []byte("data")))
+			Expect(destination.CreateSLO("bucket", "object", topHash, top)).To(Succeed())
+			objects, err := destination.Objects("bucket")
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(objects).To(HaveLen(1))
+			Expect(objects[0].Name).To(Equal("object"))
+			Expect(objects[0].Bytes).To(Equal(int64(4)))
+			names, err := destination.FileNames("bucket")
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(names).To(Equal([]string{"object"}))
+		})
+	})
+	Describe("Creating buckets", func() {
+		It("Should create missing buckets and leave existing ones alone", func() {
+			Expect(server.Bucket("bucket")).To(BeFalse())
+			Expect(destination.EnsureContainer("bucket")).To(Succeed())
+			Expect(server.Bucket("bucket")).To(BeTrue())
+			Expect(destination.EnsureContainer("bucket")).To(Succeed())
+		})
+	})
+	Describe("Creating a DLO", func() {
+		It("Should return an error", func() {
+			Expect(destination.CreateDLO("bucket", "dlo", "bucket", "prefix")).ShouldNot(Succeed())
+		})
+	})
+	Describe("Signing requests", func() {
+		It("Should be rejected by the server when unsigned", func() {
+			response, err := httpServer.Client().Post(httpServer.URL+"/bucket/object?uploads", "", bytes.NewReader(nil))
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(response.StatusCode).To(Equal(403))
+		})
+	})
+})
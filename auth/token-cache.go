@@ -0,0 +1,167 @@
+package auth
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"github.com/ncw/swift"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// CachedToken is an authentication token and the storage URL that it grants
+// access to.
+type CachedToken struct {
+	AuthToken  string    `json:"auth_token"`
+	StorageURL string    `json:"storage_url"`
+	Expires    time.Time `json:"expires,omitempty"`
+}
+
+// TokenCache stores authentication tokens between logins, so that processes
+// which run often don't need to log in every time. Keys are opaque strings
+// derived from a set of Credentials.
+type TokenCache interface {
+	Load(key string) (CachedToken, bool)
+	Store(key string, token CachedToken) error
+	Delete(key string) error
+}
+
+// DefaultTokenCache is used by AuthenticateWithCredentials, and therefore by
+// Authenticate, AuthenticateFromEnv, and AuthenticateFromCloudsYAML, when the
+// Credentials do not specify a TokenCache. It is nil by default, which disables
+// caching.
+var DefaultTokenCache TokenCache
+
+// FileTokenCache is a TokenCache that keeps each token in its own file within a
+// directory. The directory and files are only accessible to their owner, since
+// the tokens grant access to object storage.
+type FileTokenCache struct {
+	Dir string
+}
+
+// NewFileTokenCache creates a FileTokenCache in the given directory. If dir is
+// empty, the swiftlygo directory within the user's cache directory is used.
+func NewFileTokenCache(dir string) (*FileTokenCache, error) {
+	if dir == "" {
+		cacheDir, err := os.UserCacheDir()
+		if err != nil {
+			return nil, fmt.Errorf("Unable to find a cache directory for tokens: %s", err)
+		}
+		dir = filepath.Join(cacheDir, "swiftlygo")
+	}
+	return &FileTokenCache{Dir: dir}, nil
+}
+
+func (f *FileTokenCache) path(key string) string {
+	return filepath.Join(f.Dir, key+".json")
+}
+
+// Load reads the token stored under key, if there is one.
+func (f *FileTokenCache) Load(key string) (CachedToken, bool) {
+	var token CachedToken
+	data, err := ioutil.ReadFile(f.path(key))
+	if err != nil {
+		return token, false
+	}
+	if err = json.Unmarshal(data, &token); err != nil || token.AuthToken == "" || token.StorageURL == "" {
+		return token, false
+	}
+	return token, true
+}
+
+// Store writes the token under key, replacing any token already stored there.
+func (f *FileTokenCache) Store(key string, token CachedToken) error {
+	data, err := json.Marshal(token)
+	if err != nil {
+		return fmt.Errorf("Unable to encode token: %s", err)
+	}
+	if err = os.MkdirAll(f.Dir, 0700); err != nil {
+		return fmt.Errorf("Unable to create token cache directory: %s", err)
+	}
+	// Write to a temporary file and rename it so that other processes never
+	// read a partially written token
+	temp, err := ioutil.TempFile(f.Dir, key+".tmp")
+	if err != nil {
+		return fmt.Errorf("Unable to create token cache file: %s", err)
+	}
+	defer os.Remove(temp.Name())
+	if err = temp.Chmod(0600); err == nil {
+		_, err = temp.Write(data)
+	}
+	if closeErr := temp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(temp.Name(), f.path(key))
+	}
+	if err != nil {
+		return fmt.Errorf("Unable to write token cache file: %s", err)
+	}
+	return nil
+}
+
+// Delete removes the token stored under key.
+func (f *FileTokenCache) Delete(key string) error {
+	err := os.Remove(f.path(key))
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("Unable to delete token cache file: %s", err)
+	}
+	return nil
+}
+
+// Ensure that FileTokenCache satisfies the interface at compile-time
+var _ TokenCache = &FileTokenCache{}
+
+// cacheKey returns a hash that identifies the credentials without revealing them.
+func (c Credentials) cacheKey() string {
+	c.TokenCache = nil
+	data, _ := json.Marshal(c)
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// cachedToken returns the token that the connection is currently using.
+func cachedToken(connection *swift.Connection) CachedToken {
+	return CachedToken{
+		AuthToken:  connection.AuthToken,
+		StorageURL: connection.StorageUrl,
+		Expires:    connection.Expires,
+	}
+}
+
+// authenticateWithCache logs the connection in using a token from the cache if
+// it has a valid one, and logs in with its credentials otherwise. New tokens
+// are written to the cache.
+func authenticateWithCache(destination *SwiftDestination, cache TokenCache, key string) (Destination, error) {
+	connection := destination.SwiftConnection
+	if token, found := cache.Load(key); found {
+		connection.AuthToken = token.AuthToken
+		connection.StorageUrl = token.StorageURL
+		connection.Expires = token.Expires
+	}
+	// Authenticated reports false for tokens that expire within the next minute.
+	// Tokens without an expiry time are assumed to be valid until they are rejected.
+	if connection.Authenticated() {
+		// Check that the token is still accepted. If it has been revoked,
+		// the connection logs in again with its credentials by itself.
+		token := cachedToken(connection)
+		_, _, err := connection.Account()
+		if err == nil {
+			if connection.AuthToken != token.AuthToken {
+				_ = cache.Store(key, cachedToken(connection))
+			}
+			return destination, nil
+		}
+		connection.UnAuthenticate()
+	}
+	if _, err := authenticate(destination); err != nil {
+		_ = cache.Delete(key)
+		return destination, err
+	}
+	// Failing to cache the token is not a reason to fail to log in
+	_ = cache.Store(key, cachedToken(connection))
+	return destination, nil
+}
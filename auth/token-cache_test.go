@@ -0,0 +1,138 @@
+package auth_test
+
+import (
+	"github.com/ibmjstart/swiftlygo/auth"
+	"github.com/ncw/swift/swifttest"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Token caching", func() {
+	var (
+		server      *swifttest.SwiftServer
+		directory   string
+		cache       *auth.FileTokenCache
+		credentials auth.Credentials
+	)
+
+	BeforeEach(func() {
+		var err error
+		server, err = swifttest.NewSwiftServer("localhost")
+		Expect(err).ShouldNot(HaveOccurred())
+		directory, err = ioutil.TempDir("", "tokens")
+		Expect(err).ShouldNot(HaveOccurred())
+		cache, err = auth.NewFileTokenCache(filepath.Join(directory, "cache"))
+		Expect(err).ShouldNot(HaveOccurred())
+		credentials = auth.Credentials{
+			AuthURL:    server.AuthURL,
+			Username:   swifttest.TEST_ACCOUNT,
+			Password:   swifttest.TEST_ACCOUNT,
+			TokenCache: cache,
+		}
+	})
+
+	AfterEach(func() {
+		server.Close()
+		os.RemoveAll(directory)
+	})
+
+	// token returns the auth token of an authenticated destination.
+	token := func(destination auth.Destination) string {
+		return destination.(*auth.SwiftDestination).SwiftConnection.AuthToken
+	}
+
+	// cacheFiles returns the paths of the files in the cache directory.
+	cacheFiles := func() []string {
+		files, err := filepath.Glob(filepath.Join(cache.Dir, "*"))
+		Expect(err).ShouldNot(HaveOccurred())
+		return files
+	}
+
+	// cacheKey returns the key of the only token in the cache.
+	cacheKey := func() string {
+		files := cacheFiles()
+		Expect(files).To(HaveLen(1))
+		return strings.TrimSuffix(filepath.Base(files[0]), ".json")
+	}
+
+	It("Should store tokens in files that only their owner can access", func() {
+		_, err := auth.AuthenticateWithCredentials(credentials)
+		Expect(err).ShouldNot(HaveOccurred())
+		files := cacheFiles()
+		Expect(files).To(HaveLen(1))
+		info, err := os.Stat(files[0])
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(info.Mode().Perm()).To(Equal(os.FileMode(0600)))
+		info, err = os.Stat(cache.Dir)
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(info.Mode().Perm()).To(Equal(os.FileMode(0700)))
+	})
+	It("Should not write credentials to the cache", func() {
+		credentials.Password = "a-very-secret-password"
+		_, _ = auth.AuthenticateWithCredentials(credentials)
+		for _, file := range cacheFiles() {
+			Expect(ioutil.ReadFile(file)).NotTo(ContainSubstring("a-very-secret-password"))
+		}
+	})
+	It("Should reuse a cached token", func() {
+		first, err := auth.AuthenticateWithCredentials(credentials)
+		Expect(err).ShouldNot(HaveOccurred())
+		second, err := auth.AuthenticateWithCredentials(credentials)
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(token(second)).To(Equal(token(first)))
+		Expect(server.Sessions).To(HaveLen(1))
+	})
+	It("Should not share tokens between different credentials", func() {
+		_, err := auth.AuthenticateWithCredentials(credentials)
+		Expect(err).ShouldNot(HaveOccurred())
+		credentials.Project = "other"
+		_, err = auth.AuthenticateWithCredentials(credentials)
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(server.Sessions).To(HaveLen(2))
+		Expect(cacheFiles()).To(HaveLen(2))
+	})
+	It("Should log in again if the cached token is rejected", func() {
+		first, err := auth.AuthenticateWithCredentials(credentials)
+		Expect(err).ShouldNot(HaveOccurred())
+		key := cacheKey()
+		cached, found := cache.Load(key)
+		Expect(found).To(BeTrue())
+		for id := range server.Sessions {
+			delete(server.Sessions, id)
+		}
+
+		second, err := auth.AuthenticateWithCredentials(credentials)
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(token(second)).NotTo(Equal(token(first)))
+		Expect(token(second)).NotTo(Equal(cached.AuthToken))
+		cached, _ = cache.Load(key)
+		Expect(cached.AuthToken).To(Equal(token(second)))
+	})
+	It("Should not use expired tokens", func() {
+		_, err := auth.AuthenticateWithCredentials(credentials)
+		Expect(err).ShouldNot(HaveOccurred())
+		key := cacheKey()
+		cached, _ := cache.Load(key)
+		cached.Expires = time.Now().Add(-time.Hour)
+		Expect(cache.Store(key, cached)).To(Succeed())
+
+		destination, err := auth.AuthenticateWithCredentials(credentials)
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(token(destination)).NotTo(Equal(cached.AuthToken))
+		Expect(server.Sessions).To(HaveLen(2))
+	})
+	It("Should use the default cache when the credentials have none", func() {
+		auth.DefaultTokenCache = cache
+		defer func() { auth.DefaultTokenCache = nil }()
+		credentials.TokenCache = nil
+		_, err := auth.AuthenticateWithCredentials(credentials)
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(cacheFiles()).To(HaveLen(1))
+	})
+})
@@ -0,0 +1,81 @@
+package auth_test
+
+import (
+	"context"
+	"github.com/ibmjstart/swiftlygo/auth"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Tracing", func() {
+	var (
+		lock        sync.Mutex
+		traceparent []string
+		httpServer  *httptest.Server
+		dest        auth.ContextDestination
+		recorder    *tracetest.SpanRecorder
+		ctx         context.Context
+		propagator  propagation.TextMapPropagator
+	)
+
+	BeforeEach(func() {
+		traceparent = nil
+		httpServer = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			io.Copy(ioutil.Discard, r.Body)
+			lock.Lock()
+			traceparent = append(traceparent, r.Header.Get("Traceparent"))
+			lock.Unlock()
+			w.WriteHeader(http.StatusCreated)
+		}))
+		destination, err := auth.AuthenticateWithToken("token", httpServer.URL)
+		Expect(err).ShouldNot(HaveOccurred())
+		dest = destination.(auth.ContextDestination)
+		propagator = otel.GetTextMapPropagator()
+		otel.SetTextMapPropagator(propagation.TraceContext{})
+		recorder = tracetest.NewSpanRecorder()
+		provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+		ctx, _ = provider.Tracer("test").Start(context.Background(), "test")
+	})
+
+	AfterEach(func() {
+		otel.SetTextMapPropagator(propagator)
+		httpServer.Close()
+	})
+
+	Context("When uploading with a traced context", func() {
+		It("Should send the trace context with chunks", func() {
+			upload, err := dest.CreateFileContext(ctx, "container", "object", false, "")
+			Expect(err).ShouldNot(HaveOccurred())
+			_, err = upload.Write([]byte("data"))
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(upload.Close()).To(Succeed())
+			Expect(traceparent).To(HaveLen(1))
+			Expect(traceparent[0]).To(MatchRegexp("^00-[0-9a-f]{32}-[0-9a-f]{16}-01$"))
+		})
+		It("Should send the trace context with manifests and record the status code", func() {
+			Expect(dest.CreateSLOContext(ctx, "container", "manifest", "", []byte("[]"))).To(Succeed())
+			Expect(traceparent).To(HaveLen(1))
+			Expect(traceparent[0]).NotTo(BeEmpty())
+			trace.SpanFromContext(ctx).End()
+			Expect(recorder.Ended()[0].Attributes()).To(ContainElement(attribute.Int("http.response.status_code", http.StatusCreated)))
+		})
+	})
+	Context("When uploading without a traced context", func() {
+		It("Should not send a trace context", func() {
+			Expect(dest.CreateSLO("container", "manifest", "", []byte("[]"))).To(Succeed())
+			Expect(traceparent).To(Equal([]string{""}))
+		})
+	})
+})
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"encoding/hex"
+	"fmt"
+	"github.com/ibmjstart/swiftlygo/pipeline"
+	"github.com/ncw/swift"
+	"hash"
+	"sort"
+)
+
+// checksummer computes the checksums that an object's metadata lists so that
+// they can be compared with the metadata. Checksums with unknown names are
+// ignored.
+type checksummer struct {
+	names    []string
+	hashes   []hash.Hash
+	expected map[string]string
+}
+
+func newChecksummer(metadata swift.Metadata) *checksummer {
+	c := &checksummer{expected: pipeline.MetadataChecksums(metadata)}
+	for name := range c.expected {
+		if _, ok := pipeline.LookupChecksum(name); ok {
+			c.names = append(c.names, name)
+		}
+	}
+	sort.Strings(c.names)
+	for _, name := range c.names {
+		checksum, _ := pipeline.LookupChecksum(name)
+		c.hashes = append(c.hashes, checksum.New())
+	}
+	return c
+}
+
+// Write adds p to every checksum. It never returns an error.
+func (c *checksummer) Write(p []byte) (int, error) {
+	for _, h := range c.hashes {
+		h.Write(p)
+	}
+	return len(p), nil
+}
+
+// mismatches describes each checksum of the data written that differs from the
+// metadata.
+func (c *checksummer) mismatches() []string {
+	var problems []string
+	for i, name := range c.names {
+		if sum := hex.EncodeToString(c.hashes[i].Sum(nil)); sum != c.expected[name] {
+			problems = append(problems, fmt.Sprintf("expected %s %s, found %s", name, c.expected[name], sum))
+		}
+	}
+	return problems
+}
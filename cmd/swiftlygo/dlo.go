@@ -0,0 +1,26 @@
+package main
+
+import (
+	"flag"
+	"github.com/ibmjstart/swiftlygo"
+)
+
+var dloCommand = command{
+	name:        "dlo create",
+	args:        "<dlo-container> <dlo-name> <object-container> <prefix>",
+	minArgs:     4,
+	maxArgs:     4,
+	description: "Create a Dynamic Large Object made of every object in object-container whose name starts with prefix.",
+	setup: func(flags *flag.FlagSet) runner {
+		return func(creds *credentials, args []string) error {
+			destination, err := creds.connect()
+			if err != nil {
+				return err
+			}
+			if err = swiftlygo.NewDloUploader(destination, args[0], args[1], args[2], args[3]).Upload(); err != nil {
+				return fail(exitFailure, "%s", err)
+			}
+			return nil
+		}
+	},
+}
@@ -0,0 +1,185 @@
+package main
+
+import (
+	"flag"
+	"github.com/ibmjstart/swiftlygo/pipeline"
+	"github.com/ncw/swift"
+	"io"
+	"os"
+	"path"
+	"strings"
+)
+
+var downloadCommand = command{
+	name:        "download",
+	args:        "<container> <object> [file]",
+	minArgs:     2,
+	maxArgs:     3,
+	description: "Download an object into a file. The file defaults to the base name of the object, use - for stdout.",
+	setup: func(flags *flag.FlagSet) runner {
+		keyFile := flags.String("key-file", "", "decrypt segments encrypted with the AES-256 key in this `file` (32 bytes or 64 hex digits)")
+		return func(creds *credentials, args []string) error {
+			container, object, target := args[0], args[1], path.Base(args[1])
+			if len(args) > 2 {
+				target = args[2]
+			}
+			var keys pipeline.KeyProvider
+			if *keyFile != "" {
+				var err error
+				if keys, err = readKeyFile(*keyFile); err != nil {
+					return fail(exitUsage, "Unable to read key: %s", err)
+				}
+			}
+			return download(creds, container, object, target, keys)
+		}
+	},
+}
+
+// download copies the contents of an object into the target file, checking the
+// MD5 sum of objects that are not large objects and any checksums stored in the
+// object's metadata. Compressed objects are decompressed. If keys is not nil,
+// each segment is downloaded separately and decrypted if it was encrypted;
+// otherwise encrypted objects are refused.
+func download(creds *credentials, container, object, target string, keys pipeline.KeyProvider) error {
+	destination, err := creds.connect()
+	if err != nil {
+		return err
+	}
+	connection := destination.SwiftConnection
+	if keys == nil {
+		// Without a key, the ciphertext would be written as if it were the data
+		isEncrypted, err := encrypted(connection, container, object)
+		if err != nil {
+			return fail(exitFailure, "Unable to read %s/%s: %s", container, object, err)
+		} else if isEncrypted {
+			return fail(exitUsage, "Object %s/%s is encrypted; pass -key-file", container, object)
+		}
+	}
+
+	output := os.Stdout
+	if target != "-" {
+		output, err = os.Create(target)
+		if err != nil {
+			return fail(exitFailure, "Unable to create %s: %s", target, err)
+		}
+		defer output.Close()
+	}
+	if keys == nil {
+		err = downloadObject(connection, container, object, output)
+	} else {
+		err = downloadSegments(connection, container, object, output, keys)
+	}
+	if err != nil {
+		return err
+	}
+	if target != "-" {
+		if err = output.Close(); err != nil {
+			return fail(exitFailure, "Failed to write %s: %s", target, err)
+		}
+	}
+	return nil
+}
+
+// encrypted reports whether an object, or the first segment of a large object,
+// was encrypted. Only the segments of a large object carry encryption metadata.
+func encrypted(connection *swift.Connection, container, object string) (bool, error) {
+	_, headers, err := connection.Object(container, object)
+	if err != nil {
+		return false, err
+	}
+	if pipeline.IsEncrypted(headers.ObjectMetadata()) {
+		return true, nil
+	}
+	segments, _, err := largeObjectSegments(connection, container, object)
+	if err == swift.NotLargeObject || (err == nil && len(segments) == 0) {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+	_, headers, err = connection.Object(segments[0].container, segments[0].Name)
+	if err != nil {
+		return false, err
+	}
+	return pipeline.IsEncrypted(headers.ObjectMetadata()), nil
+}
+
+// downloadObject copies the contents of an object to output in one request,
+// decompressing them if the object's metadata says that they are compressed.
+func downloadObject(connection *swift.Connection, container, object string, output io.Writer) error {
+	contents, headers, err := connection.ObjectOpen(container, object, true, nil)
+	if err != nil {
+		return fail(exitFailure, "Unable to download %s/%s: %s", container, object, err)
+	}
+	defer contents.Close()
+	metadata := headers.ObjectMetadata()
+	data, err := pipeline.NewDecompressor(contents, metadata)
+	if err != nil {
+		return fail(exitFailure, "Unable to decompress %s/%s: %s", container, object, err)
+	}
+	defer data.Close()
+	checksums := newChecksummer(metadata)
+	if _, err = io.Copy(io.MultiWriter(output, checksums), data); err != nil {
+		return fail(exitFailure, "Failed to download %s/%s: %s", container, object, err)
+	}
+	// Closing the download is what reports a corrupted object
+	if err = contents.Close(); err != nil {
+		return fail(exitFailure, "Failed to download %s/%s: %s", container, object, err)
+	}
+	if problems := checksums.mismatches(); len(problems) > 0 {
+		return fail(exitMismatch, "Downloaded %s/%s does not match its metadata: %s", container, object, strings.Join(problems, ", "))
+	}
+	return nil
+}
+
+// downloadSegments copies the plaintext of each segment of a large object, or
+// of the object itself if it is not a large object, to output, decompressing
+// segments that are compressed. Each segment
+// carries its own encryption metadata, so they are downloaded one at a time.
+func downloadSegments(connection *swift.Connection, container, object string, output io.Writer, keys pipeline.KeyProvider) error {
+	_, headers, err := connection.Object(container, object)
+	if err != nil {
+		return fail(exitFailure, "Unable to read %s/%s: %s", container, object, err)
+	}
+	whole := newChecksummer(headers.ObjectMetadata())
+	segments, _, err := largeObjectSegments(connection, container, object)
+	if err == swift.NotLargeObject {
+		segments = []segment{{container: container, Object: swift.Object{Name: object}}}
+	} else if err != nil {
+		return fail(exitFailure, "Unable to find the segments of %s/%s: %s", container, object, err)
+	}
+	for _, current := range segments {
+		contents, headers, err := connection.ObjectOpen(current.container, current.Name, true, nil)
+		if err != nil {
+			return fail(exitFailure, "Unable to download %s/%s: %s", current.container, current.Name, err)
+		}
+		metadata := headers.ObjectMetadata()
+		plaintext, err := pipeline.NewDecrypter(contents, metadata, keys)
+		if err != nil {
+			contents.Close()
+			return fail(exitFailure, "Unable to decrypt %s/%s: %s", current.container, current.Name, err)
+		}
+		data, err := pipeline.NewDecompressor(plaintext, metadata)
+		if err != nil {
+			contents.Close()
+			return fail(exitFailure, "Unable to decompress %s/%s: %s", current.container, current.Name, err)
+		}
+		checksums := newChecksummer(metadata)
+		_, err = io.Copy(io.MultiWriter(output, checksums, whole), data)
+		data.Close()
+		if closeErr := contents.Close(); err == nil {
+			err = closeErr
+		}
+		if err == pipeline.ErrDecryption {
+			return fail(exitMismatch, "Unable to decrypt %s/%s: %s", current.container, current.Name, err)
+		} else if err != nil {
+			return fail(exitFailure, "Failed to download %s/%s: %s", current.container, current.Name, err)
+		}
+		if problems := checksums.mismatches(); len(problems) > 0 {
+			return fail(exitMismatch, "Downloaded %s/%s does not match its metadata: %s", current.container, current.Name, strings.Join(problems, ", "))
+		}
+	}
+	if problems := whole.mismatches(); len(problems) > 0 {
+		return fail(exitMismatch, "Downloaded %s/%s does not match its metadata: %s", container, object, strings.Join(problems, ", "))
+	}
+	return nil
+}
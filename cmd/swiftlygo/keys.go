@@ -0,0 +1,25 @@
+package main
+
+import (
+	"encoding/hex"
+	"fmt"
+	"github.com/ibmjstart/swiftlygo/pipeline"
+	"io/ioutil"
+	"strings"
+)
+
+// readKeyFile loads an AES-256 key from path, which holds either the 32 bytes of
+// the key or 64 hexadecimal digits encoding them.
+func readKeyFile(path string) (pipeline.KeyProvider, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) != 32 {
+		data, err = hex.DecodeString(strings.TrimSpace(string(data)))
+		if err != nil || len(data) != 32 {
+			return nil, fmt.Errorf("%s must hold 32 bytes or 64 hexadecimal digits", path)
+		}
+	}
+	return pipeline.NewStaticKey(data), nil
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github.com/ncw/swift"
+	"os"
+	"text/tabwriter"
+)
+
+var lsCommand = command{
+	name:        "ls",
+	args:        "[container]",
+	minArgs:     0,
+	maxArgs:     1,
+	description: "List the containers in the account, or the objects within a container.",
+	setup: func(flags *flag.FlagSet) runner {
+		long := flags.Bool("l", false, "show sizes and modification times")
+		prefix := flags.String("prefix", "", "only list names beginning with `prefix`")
+		return func(creds *credentials, args []string) error {
+			destination, err := creds.connect()
+			if err != nil {
+				return err
+			}
+			output := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', tabwriter.AlignRight)
+			defer output.Flush()
+			connection := destination.SwiftConnection
+			if len(args) == 0 {
+				containers, err := connection.ContainersAll(&swift.ContainersOpts{Prefix: *prefix})
+				if err != nil {
+					return fail(exitFailure, "Unable to list containers: %s", err)
+				}
+				for _, container := range containers {
+					if *long {
+						fmt.Fprintf(output, "%d\t%d\t %s\n", container.Count, container.Bytes, container.Name)
+					} else {
+						fmt.Fprintln(output, container.Name)
+					}
+				}
+				return nil
+			}
+			objects, err := connection.ObjectsAll(args[0], &swift.ObjectsOpts{Prefix: *prefix})
+			if err != nil {
+				return fail(exitFailure, "Unable to list objects in %s: %s", args[0], err)
+			}
+			for _, object := range objects {
+				if *long {
+					fmt.Fprintf(output, "%d\t %s\t %s\n", object.Bytes, object.LastModified.Format("2006-01-02 15:04:05"), object.Name)
+				} else {
+					fmt.Fprintln(output, object.Name)
+				}
+			}
+			return nil
+		}
+	},
+}
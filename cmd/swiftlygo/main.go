@@ -0,0 +1,227 @@
+/*
+Command swiftlygo uploads, downloads, and manages large objects in OpenStack
+Object Storage.
+
+Usage:
+
+	swiftlygo <command> [flags] [arguments]
+
+The commands are:
+
+	upload      upload a file as a Static Large Object
+	dlo create  create a Dynamic Large Object manifest
+	download    download an object to a file
+	ls          list containers, or the objects within a container
+	rm          remove an object, optionally with its segments
+	verify      check that an uploaded object matches a local file
+
+Every command accepts the credential flags -auth-url, -username, -api-key,
+-domain, and -tenant, or -token and -storage-url to reuse an existing
+authentication token. Each of them defaults to the value of the matching
+OpenStack environment variable (OS_AUTH_URL, OS_USERNAME, OS_PASSWORD,
+OS_USER_DOMAIN_NAME, OS_PROJECT_NAME, OS_AUTH_TOKEN and OS_STORAGE_URL).
+When none of those flags are given, every standard OpenStack environment
+variable is honoured, including OS_REGION_NAME and OS_INTERFACE, and the
+auth URL does not need to end in its version. The -cloud flag (default
+$OS_CLOUD) reads the named cloud from clouds.yaml instead. With -cache-token,
+the authentication token is kept in the user's cache directory and reused by
+later runs until it expires or is rejected.
+
+The exit status is 0 on success, 1 if the operation failed, 2 for invalid
+usage, 3 if authentication failed, 4 if verification found differences,
+and 5 if the requested container or object does not exist.
+*/
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/ibmjstart/swiftlygo/auth"
+	"github.com/ncw/swift"
+	"net/http"
+	"os"
+)
+
+// Exit statuses
+const (
+	exitOK       = 0
+	exitFailure  = 1
+	exitUsage    = 2
+	exitAuth     = 3
+	exitMismatch = 4
+	exitNotFound = 5
+)
+
+// commandError pairs an error with the exit status that it should produce.
+type commandError struct {
+	status int
+	err    error
+}
+
+func (c *commandError) Error() string {
+	return c.err.Error()
+}
+
+// fail wraps an error with an exit status, choosing exitNotFound for errors
+// that indicate a missing container or object.
+func fail(status int, format string, args ...interface{}) error {
+	err := fmt.Errorf(format, args...)
+	for _, arg := range args {
+		var statusErr *auth.HTTPStatusError
+		if arg == swift.ObjectNotFound || arg == swift.ContainerNotFound {
+			status = exitNotFound
+		} else if argErr, ok := arg.(error); ok && errors.As(argErr, &statusErr) && statusErr.Code == http.StatusNotFound {
+			status = exitNotFound
+		}
+	}
+	return &commandError{status: status, err: err}
+}
+
+// credentials holds the authentication flags shared by every command.
+type credentials struct {
+	authURL, username, apiKey, domain, tenant string
+	token, storageURL                         string
+	cloud                                     string
+	cacheToken                                bool
+	// fromFlags is set if any of the username and password flags were given
+	fromFlags bool
+}
+
+// register adds the credential flags to the flag set, using the OpenStack
+// environment variables as their defaults.
+func (c *credentials) register(flags *flag.FlagSet) {
+	flags.StringVar(&c.authURL, "auth-url", os.Getenv("OS_AUTH_URL"), "authentication `url`, ending in the auth version (e.g. /v3)")
+	flags.StringVar(&c.username, "username", os.Getenv("OS_USERNAME"), "user name")
+	flags.StringVar(&c.apiKey, "api-key", os.Getenv("OS_PASSWORD"), "API key or password")
+	flags.StringVar(&c.domain, "domain", os.Getenv("OS_USER_DOMAIN_NAME"), "domain name (v3 auth only)")
+	flags.StringVar(&c.tenant, "tenant", os.Getenv("OS_PROJECT_NAME"), "tenant or project name")
+	flags.StringVar(&c.token, "token", os.Getenv("OS_AUTH_TOKEN"), "existing authentication token, used with -storage-url")
+	flags.StringVar(&c.storageURL, "storage-url", os.Getenv("OS_STORAGE_URL"), "storage `url`, used with -token")
+	flags.StringVar(&c.cloud, "cloud", os.Getenv("OS_CLOUD"), "`name` of a cloud in clouds.yaml to authenticate with")
+	flags.BoolVar(&c.cacheToken, "cache-token", false, "reuse the authentication token between runs")
+}
+
+// parsed records which credential flags were given on the command line.
+func (c *credentials) parsed(flags *flag.FlagSet) {
+	flags.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "auth-url", "username", "api-key", "domain", "tenant":
+			c.fromFlags = true
+		}
+	})
+}
+
+// connect authenticates with object storage, preferring an existing token
+// when one is available, then a clouds.yaml entry, then the credential flags.
+// Without any credential flags, the OpenStack environment variables are used.
+func (c *credentials) connect() (*auth.SwiftDestination, error) {
+	var (
+		destination auth.Destination
+		err         error
+	)
+	if c.cacheToken {
+		if auth.DefaultTokenCache, err = auth.NewFileTokenCache(""); err != nil {
+			return nil, &commandError{status: exitFailure, err: err}
+		}
+	}
+	switch {
+	case c.token != "" && c.storageURL != "":
+		destination, err = auth.AuthenticateWithToken(c.token, c.storageURL)
+	case c.cloud != "" && !c.fromFlags:
+		destination, err = auth.AuthenticateFromCloudsYAML(c.cloud)
+	case !c.fromFlags:
+		destination, err = auth.AuthenticateFromEnv()
+	default:
+		destination, err = auth.Authenticate(c.username, c.apiKey, c.authURL, c.domain, c.tenant)
+	}
+	if err != nil {
+		return nil, &commandError{status: exitAuth, err: err}
+	}
+	return destination.(*auth.SwiftDestination), nil
+}
+
+// runner performs a command with its positional arguments.
+type runner func(creds *credentials, args []string) error
+
+// command is a single swiftlygo subcommand. Its setup function registers the
+// command's flags and returns the runner that uses them.
+type command struct {
+	name        string
+	args        string
+	minArgs     int
+	maxArgs     int
+	description string
+	setup       func(flags *flag.FlagSet) runner
+}
+
+var commands = []command{
+	uploadCommand,
+	dloCommand,
+	downloadCommand,
+	lsCommand,
+	rmCommand,
+	verifyCommand,
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "Usage: swiftlygo <command> [flags] [arguments]\n\nCommands:")
+	for _, cmd := range commands {
+		fmt.Fprintf(os.Stderr, "  %-12s%s\n", cmd.name, cmd.description)
+	}
+	fmt.Fprintln(os.Stderr, "\nRun 'swiftlygo <command> -h' for help with a command.")
+}
+
+// run executes the command named by the arguments and returns the exit status.
+func run(args []string) int {
+	if len(args) < 1 {
+		usage()
+		return exitUsage
+	}
+	name, args := args[0], args[1:]
+	// dlo has a single subcommand, so treat "dlo create" as one command name
+	if name == "dlo" && len(args) > 0 && args[0] == "create" {
+		name, args = "dlo create", args[1:]
+	}
+	for _, cmd := range commands {
+		if cmd.name != name {
+			continue
+		}
+		flags := flag.NewFlagSet(cmd.name, flag.ContinueOnError)
+		flags.Usage = func() {
+			fmt.Fprintf(os.Stderr, "Usage: swiftlygo %s [flags] %s\n\n%s\n\nFlags:\n", cmd.name, cmd.args, cmd.description)
+			flags.PrintDefaults()
+		}
+		creds := &credentials{}
+		creds.register(flags)
+		run := cmd.setup(flags)
+		if err := flags.Parse(args); err != nil {
+			if err == flag.ErrHelp {
+				return exitOK
+			}
+			return exitUsage
+		}
+		creds.parsed(flags)
+		if flags.NArg() < cmd.minArgs || flags.NArg() > cmd.maxArgs {
+			fmt.Fprintf(os.Stderr, "%s expects arguments: %s\n", cmd.name, cmd.args)
+			flags.Usage()
+			return exitUsage
+		}
+		if err := run(creds, flags.Args()); err != nil {
+			if cmdErr, ok := err.(*commandError); ok {
+				fmt.Fprintln(os.Stderr, "Error:", cmdErr)
+				return cmdErr.status
+			}
+			fmt.Fprintln(os.Stderr, "Error:", err)
+			return exitFailure
+		}
+		return exitOK
+	}
+	fmt.Fprintf(os.Stderr, "Unknown command %q\n\n", name)
+	usage()
+	return exitUsage
+}
+
+func main() {
+	os.Exit(run(os.Args[1:]))
+}
@@ -0,0 +1,255 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"math/rand"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/ibmjstart/swiftlygo/auth"
+	"github.com/ibmjstart/swiftlygo/pipeline"
+	"github.com/ncw/swift"
+	"github.com/ncw/swift/swifttest"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Swiftlygo command", func() {
+	var (
+		server     *swifttest.SwiftServer
+		connection *swift.Connection
+		directory  string
+		source     string
+		data       []byte
+		authFlags  []string
+	)
+
+	BeforeEach(func() {
+		var err error
+		server, err = swifttest.NewSwiftServer("localhost")
+		Expect(err).ShouldNot(HaveOccurred())
+		connection = &swift.Connection{UserName: swifttest.TEST_ACCOUNT, ApiKey: swifttest.TEST_ACCOUNT, AuthUrl: server.AuthURL}
+		Expect(connection.Authenticate()).To(Succeed())
+		Expect(connection.ContainerCreate("container", nil)).To(Succeed())
+		authFlags = []string{"-auth-url", server.AuthURL, "-username", swifttest.TEST_ACCOUNT, "-api-key", swifttest.TEST_ACCOUNT}
+
+		directory, err = ioutil.TempDir("", "swiftlygo")
+		Expect(err).ShouldNot(HaveOccurred())
+		data = make([]byte, 1024)
+		rand.Read(data)
+		source = filepath.Join(directory, "source")
+		Expect(ioutil.WriteFile(source, data, 0600)).To(Succeed())
+	})
+
+	AfterEach(func() {
+		server.Close()
+		os.RemoveAll(directory)
+	})
+
+	// command builds the arguments to run a command with the test credentials.
+	command := func(name string, args ...string) []string {
+		return append(append([]string{name}, authFlags...), args...)
+	}
+
+	Context("When invoked without a command", func() {
+		It("Should exit with a usage error", func() {
+			Expect(run(nil)).To(Equal(exitUsage))
+			Expect(run([]string{"nonexistent"})).To(Equal(exitUsage))
+		})
+	})
+	Context("When invoked with the wrong number of arguments", func() {
+		It("Should exit with a usage error", func() {
+			Expect(run(command("upload", "container"))).To(Equal(exitUsage))
+		})
+	})
+	Context("When authentication fails", func() {
+		It("Should exit with an authentication error", func() {
+			Expect(run([]string{"ls", "-auth-url", server.AuthURL, "-username", "wrong", "-api-key", "wrong"})).To(Equal(exitAuth))
+		})
+	})
+	Context("When credentials come from the environment", func() {
+		BeforeEach(func() {
+			os.Setenv("ST_AUTH", server.AuthURL)
+			os.Setenv("ST_USER", swifttest.TEST_ACCOUNT)
+			os.Setenv("ST_KEY", swifttest.TEST_ACCOUNT)
+		})
+		AfterEach(func() {
+			os.Unsetenv("ST_AUTH")
+			os.Unsetenv("ST_USER")
+			os.Unsetenv("ST_KEY")
+		})
+		It("Should authenticate without credential flags", func() {
+			Expect(run([]string{"ls", "container"})).To(Equal(exitOK))
+		})
+	})
+	Context("When downloading an object", func() {
+		It("Should write the object's data to the file", func() {
+			Expect(connection.ObjectPutBytes("container", "object", data, "")).To(Succeed())
+			target := filepath.Join(directory, "target")
+			Expect(run(command("download", "container", "object", target))).To(Equal(exitOK))
+			downloaded, err := ioutil.ReadFile(target)
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(downloaded).To(Equal(data))
+		})
+	})
+	Context("When verifying an object", func() {
+		It("Should succeed only if the local file matches", func() {
+			Expect(connection.ObjectPutBytes("container", "object", data, "")).To(Succeed())
+			Expect(run(command("verify", "container", "object", source))).To(Equal(exitOK))
+			data[500]++
+			Expect(ioutil.WriteFile(source, data, 0600)).To(Succeed())
+			Expect(run(command("verify", "container", "object", source))).To(Equal(exitMismatch))
+		})
+	})
+	Context("When an object has checksums in its metadata", func() {
+		// put uploads the data with sha256 as its SHA-256 checksum
+		put := func(sha256 string) {
+			metadata := swift.Metadata{"checksum-sha256": sha256}.ObjectHeaders()
+			_, err := connection.ObjectPut("container", "object", bytes.NewReader(data), true, "", "", metadata)
+			Expect(err).ShouldNot(HaveOccurred())
+		}
+		It("Should verify and download objects that match them", func() {
+			sum := sha256.Sum256(data)
+			put(hex.EncodeToString(sum[:]))
+			Expect(run(command("verify", "container", "object", source))).To(Equal(exitOK))
+			Expect(run(command("download", "container", "object", filepath.Join(directory, "target")))).To(Equal(exitOK))
+		})
+		It("Should report objects whose data does not match them", func() {
+			put(strings.Repeat("0", 64))
+			Expect(run(command("verify", "container", "object", source))).To(Equal(exitMismatch))
+			Expect(run(command("download", "container", "object", filepath.Join(directory, "target")))).To(Equal(exitMismatch))
+		})
+	})
+	Context("When an object is encrypted", func() {
+		var keyFile string
+
+		BeforeEach(func() {
+			key := make([]byte, 32)
+			rand.Read(key)
+			keyFile = filepath.Join(directory, "key")
+			Expect(ioutil.WriteFile(keyFile, []byte(hex.EncodeToString(key)), 0600)).To(Succeed())
+			chunks := make(chan pipeline.FileChunk, 1)
+			chunks <- pipeline.FileChunk{Size: uint(len(data)), Object: "object", Container: "container"}
+			close(chunks)
+			errs := make(chan error, 10)
+			dest := &auth.SwiftDestination{SwiftConnection: connection}
+			for range pipeline.ReadHashAndUpload(chunks, errs, bytes.NewReader(data), dest,
+				pipeline.WithEncryption(pipeline.NewStaticKey(key)), pipeline.WithChecksums(pipeline.SHA256)) {
+			}
+			Expect(errs).To(BeEmpty())
+		})
+		It("Should decrypt it with the key", func() {
+			target := filepath.Join(directory, "target")
+			Expect(run(command("download", "-key-file", keyFile, "container", "object", target))).To(Equal(exitOK))
+			downloaded, err := ioutil.ReadFile(target)
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(downloaded).To(Equal(data))
+		})
+		It("Should refuse to download it or a large object of it without a key", func() {
+			target := filepath.Join(directory, "target")
+			Expect(run(command("download", "container", "object", target))).To(Equal(exitUsage))
+			dest := &auth.SwiftDestination{SwiftConnection: connection}
+			Expect(dest.CreateDLO("container", "large", "container", "object")).To(Succeed())
+			Expect(run(command("download", "container", "large", target))).To(Equal(exitUsage))
+			_, err := os.Stat(target)
+			Expect(os.IsNotExist(err)).To(BeTrue())
+		})
+		It("Should fail to decrypt it with another key", func() {
+			Expect(ioutil.WriteFile(keyFile, bytes.Repeat([]byte{1}, 32), 0600)).To(Succeed())
+			Expect(run(command("download", "-key-file", keyFile, "container", "object", filepath.Join(directory, "target")))).To(Equal(exitFailure))
+		})
+	})
+	Context("When an object is compressed", func() {
+		BeforeEach(func() {
+			chunks := make(chan pipeline.FileChunk, 1)
+			chunks <- pipeline.FileChunk{Size: uint(len(data)), Object: "object", Container: "container"}
+			close(chunks)
+			errs := make(chan error, 10)
+			dest := &auth.SwiftDestination{SwiftConnection: connection}
+			for range pipeline.ReadHashAndUpload(chunks, errs, bytes.NewReader(data), dest, pipeline.WithCompression(pipeline.Zstd)) {
+			}
+			Expect(errs).To(BeEmpty())
+		})
+		It("Should decompress it when downloading", func() {
+			target := filepath.Join(directory, "target")
+			Expect(run(command("download", "container", "object", target))).To(Equal(exitOK))
+			downloaded, err := ioutil.ReadFile(target)
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(downloaded).To(Equal(data))
+		})
+		It("Should refuse to verify it", func() {
+			Expect(run(command("verify", "container", "object", source))).To(Equal(exitUsage))
+		})
+	})
+	Context("When deduplicating an upload", func() {
+		It("Should reject -only-missing", func() {
+			Expect(run(command("upload", "-dedup-container", "segments", "-only-missing", "container", "object", source))).To(Equal(exitUsage))
+		})
+		It("Should reject -segment-container", func() {
+			Expect(run(command("upload", "-dedup-container", "segments", "-segment-container", "container_segments", "container", "object", source))).To(Equal(exitUsage))
+		})
+		It("Should reject chunk sizes that cannot be split by content", func() {
+			Expect(run(command("upload", "-dedup-container", "segments", "-chunk-size", "100", "container", "object", source))).To(Equal(exitUsage))
+		})
+	})
+	Context("When an upload cannot be prepared", func() {
+		It("Should only report a usage error for problems with the arguments", func() {
+			Expect(prepareStatus(fmt.Errorf("Chunk size must be between 1byte and 5 bytes"))).To(Equal(exitUsage))
+			Expect(prepareStatus(fmt.Errorf("Unable to create container c: %w", &auth.HTTPStatusError{Code: http.StatusForbidden}))).To(Equal(exitFailure))
+			Expect(prepareStatus(fmt.Errorf("Unable to create container c: %w", &net.OpError{Op: "dial", Err: fmt.Errorf("connection refused")}))).To(Equal(exitFailure))
+		})
+	})
+	Context("When uploading with an unknown compression", func() {
+		It("Should exit with a usage error", func() {
+			Expect(run(command("upload", "-compress", "lz4", "container", "object", source))).To(Equal(exitUsage))
+		})
+	})
+	Context("When uploading with an unknown checksum", func() {
+		It("Should exit with a usage error", func() {
+			Expect(run(command("upload", "-checksum", "md4", "container", "object", source))).To(Equal(exitUsage))
+		})
+	})
+	Context("When removing a DLO with its segments", func() {
+		It("Should leave the container empty", func() {
+			Expect(connection.ObjectPutBytes("container", "prefix-0", data[:512], "")).To(Succeed())
+			Expect(connection.ObjectPutBytes("container", "prefix-1", data[512:], "")).To(Succeed())
+			Expect(run(append([]string{"dlo", "create"}, append(authFlags, "container", "dlo", "container", "prefix-")...))).To(Equal(exitOK))
+			Expect(run(command("rm", "-with-segments", "container", "dlo"))).To(Equal(exitOK))
+			names, err := connection.ObjectNamesAll("container", nil)
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(names).To(BeEmpty())
+		})
+	})
+	Context("When removing an object whose segments are shared by content", func() {
+		It("Should keep the shared segments", func() {
+			sum := sha256.Sum256(data)
+			shared := "sha256-" + hex.EncodeToString(sum[:])
+			Expect(connection.ObjectPutBytes("container", shared, data, "")).To(Succeed())
+			Expect(run(append([]string{"dlo", "create"}, append(authFlags, "container", "dlo", "container", "sha256-")...))).To(Equal(exitOK))
+			Expect(run(command("rm", "-with-segments", "container", "dlo"))).To(Equal(exitOK))
+			names, err := connection.ObjectNamesAll("container", nil)
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(names).To(Equal([]string{shared}))
+		})
+	})
+	Context("When removing an object that does not exist", func() {
+		It("Should exit with a not found error", func() {
+			Expect(run(command("rm", "container", "missing"))).To(Equal(exitNotFound))
+		})
+	})
+	Context("When creating a DLO", func() {
+		It("Should create the manifest", func() {
+			Expect(run(append([]string{"dlo", "create"}, append(authFlags, "container", "dlo", "container", "prefix-")...))).To(Equal(exitOK))
+			_, headers, err := connection.Object("container", "dlo")
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(headers["X-Object-Manifest"]).To(Equal("container/prefix-"))
+		})
+	})
+})
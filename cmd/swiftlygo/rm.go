@@ -0,0 +1,80 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github.com/ibmjstart/swiftlygo"
+	"github.com/ncw/swift"
+	"os"
+	"regexp"
+)
+
+// sharedSegmentPattern matches the names of segments uploaded by content with
+// -dedup-container, which other objects may refer to as well.
+var sharedSegmentPattern = regexp.MustCompile("^" + fmt.Sprintf(regexp.QuoteMeta(swiftlygo.DedupSegmentFormat), "[0-9a-f]{64}") + "$")
+
+var rmCommand = command{
+	name:        "rm",
+	args:        "<container> <object>",
+	minArgs:     2,
+	maxArgs:     2,
+	description: "Remove an object. Use -with-segments to also remove the segments of a large object.",
+	setup: func(flags *flag.FlagSet) runner {
+		withSegments := flags.Bool("with-segments", false, "also remove the segments and nested manifests of a large object, except for segments shared by content")
+		return func(creds *credentials, args []string) error {
+			destination, err := creds.connect()
+			if err != nil {
+				return err
+			}
+			connection := destination.SwiftConnection
+			if *withSegments {
+				return removeLargeObject(connection, args[0], args[1])
+			}
+			if err = connection.ObjectDelete(args[0], args[1]); err != nil {
+				return fail(exitFailure, "Unable to remove %s/%s: %s", args[0], args[1], err)
+			}
+			return nil
+		}
+	},
+}
+
+// removeLargeObject removes a large object, its nested manifests, and its segments.
+// The top-level manifest is removed first so that a partially removed large object
+// is never left readable. Segments named by their content are kept, since other
+// objects uploaded with -dedup-container may still refer to them.
+func removeLargeObject(connection *swift.Connection, container, object string) error {
+	segments, manifests, err := largeObjectSegments(connection, container, object)
+	if err != nil && err != swift.NotLargeObject {
+		return fail(exitFailure, "Unable to find the segments of %s/%s: %s", container, object, err)
+	}
+	if err = connection.ObjectDelete(container, object); err != nil {
+		return fail(exitFailure, "Unable to remove %s/%s: %s", container, object, err)
+	}
+	removable, shared := manifests, 0
+	for _, current := range segments {
+		if sharedSegmentPattern.MatchString(current.Name) {
+			shared++
+			continue
+		}
+		removable = append(removable, current)
+	}
+	if shared > 0 {
+		fmt.Fprintf(os.Stderr, "Kept %d segments of %s/%s that may be shared with other objects\n", shared, container, object)
+	}
+	byContainer := make(map[string][]string)
+	for _, current := range removable {
+		byContainer[current.container] = append(byContainer[current.container], current.Name)
+	}
+	for segmentContainer, names := range byContainer {
+		if _, err = connection.BulkDelete(segmentContainer, names); err == nil {
+			continue
+		}
+		// Bulk deletion is optional, so fall back to removing each segment
+		for _, name := range names {
+			if err = connection.ObjectDelete(segmentContainer, name); err != nil && err != swift.ObjectNotFound {
+				return fail(exitFailure, "Unable to remove segment %s/%s: %s", segmentContainer, name, err)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"github.com/ncw/swift"
+)
+
+// segment is a single object referenced by a large object manifest.
+type segment struct {
+	container string
+	swift.Object
+}
+
+// largeObjectSegments returns the data segments of a large object in order. Unlike
+// swift.Connection.LargeObjectGetSegments, it descends into nested SLO manifests
+// like those created by swiftlygo, and returns the nested manifests separately. It
+// returns swift.NotLargeObject if the object is not a large object.
+func largeObjectSegments(connection *swift.Connection, container, object string) (segments, manifests []segment, err error) {
+	segmentContainer, objects, err := connection.LargeObjectGetSegments(container, object)
+	if err != nil || len(objects) == 0 {
+		return nil, nil, err
+	}
+	// swiftlygo never mixes manifests and data segments within a manifest, so the
+	// first segment indicates whether the rest of them are manifests
+	_, headers, err := connection.Object(segmentContainer, objects[0].Name)
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, object := range objects {
+		current := segment{container: segmentContainer, Object: object}
+		if !headers.IsLargeObjectSLO() {
+			segments = append(segments, current)
+			continue
+		}
+		manifests = append(manifests, current)
+		subSegments, subManifests, err := largeObjectSegments(connection, segmentContainer, object.Name)
+		if err != nil {
+			return nil, nil, err
+		}
+		segments = append(segments, subSegments...)
+		manifests = append(manifests, subManifests...)
+	}
+	return segments, manifests, nil
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/ibmjstart/swiftlygo"
+	"github.com/ibmjstart/swiftlygo/auth"
+	"github.com/ibmjstart/swiftlygo/pipeline"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"time"
+)
+
+var uploadCommand = command{
+	name:        "upload",
+	args:        "<container> <object> <file>",
+	minArgs:     3,
+	maxArgs:     3,
+	description: "Upload a file as a Static Large Object.",
+	setup: func(flags *flag.FlagSet) runner {
+		chunkSize := flags.Uint("chunk-size", 100*1000*1000, "size of each chunk in `bytes`")
+		concurrency := flags.Uint("concurrency", 8, "maximum number of chunks to upload in parallel")
+		onlyMissing := flags.Bool("only-missing", false, "only upload chunks that are not already in the container")
+		dedupContainer := flags.String("dedup-container", "", "split the file where its content allows, with chunks of about -chunk-size bytes, and store them by content in this shared `container`, skipping those already there")
+		segmentContainer := flags.String("segment-container", "", "store the chunks in this `container`, conventionally <container>_segments, creating it if needed")
+		manifestContainer := flags.String("manifest-container", "", "store the intermediate manifests in this `container`, creating it if needed")
+		checksum := flags.String("checksum", "", "also store this checksum (sha256, blake3 or crc32c) in the metadata of each segment and the object")
+		compress := flags.String("compress", "", "compress each segment with this algorithm (gzip or zstd)")
+		keyFile := flags.String("key-file", "", "encrypt each segment with the AES-256 key in this `file` (32 bytes or 64 hex digits)")
+		quiet := flags.Bool("quiet", false, "do not print progress")
+		verbose := flags.Bool("verbose", false, "print the upload log to stderr")
+		return func(creds *credentials, args []string) error {
+			var log io.Writer = ioutil.Discard
+			if *verbose {
+				log = os.Stderr
+			}
+			var opts []swiftlygo.Option
+			if *checksum != "" {
+				algorithm, ok := pipeline.LookupChecksum(*checksum)
+				if !ok {
+					return fail(exitUsage, "Unknown checksum %s", *checksum)
+				}
+				opts = append(opts, swiftlygo.WithChecksums(algorithm))
+			}
+			if *compress != "" {
+				compression, ok := pipeline.LookupCompression(*compress)
+				if !ok {
+					return fail(exitUsage, "Unknown compression %s", *compress)
+				}
+				opts = append(opts, swiftlygo.WithCompression(compression))
+			}
+			if *keyFile != "" {
+				keys, err := readKeyFile(*keyFile)
+				if err != nil {
+					return fail(exitUsage, "Unable to read key: %s", err)
+				}
+				opts = append(opts, swiftlygo.WithEncryption(keys))
+			}
+			if *dedupContainer != "" && *onlyMissing {
+				return fail(exitUsage, "-only-missing cannot be used with -dedup-container, which always skips existing chunks")
+			}
+			if *dedupContainer != "" && *segmentContainer != "" {
+				return fail(exitUsage, "-segment-container cannot be used with -dedup-container, which already holds the chunks")
+			}
+			if *segmentContainer != "" {
+				opts = append(opts, swiftlygo.WithSegmentContainer(*segmentContainer))
+			}
+			if *manifestContainer != "" {
+				opts = append(opts, swiftlygo.WithManifestContainer(*manifestContainer))
+			}
+			return upload(creds, args[0], args[1], args[2], *chunkSize, *concurrency, *onlyMissing, *dedupContainer, !*quiet, log, opts...)
+		}
+	},
+}
+
+// upload performs an SLO upload, printing progress to stderr if requested. If
+// dedupContainer is not empty, the chunks are found by content and stored in it.
+func upload(creds *credentials, container, object, path string, chunkSize, concurrency uint, onlyMissing bool, dedupContainer string, progress bool, log io.Writer, opts ...swiftlygo.Option) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return fail(exitFailure, "Unable to open %s: %s", path, err)
+	}
+	defer file.Close()
+	destination, err := creds.connect()
+	if err != nil {
+		return err
+	}
+	var uploader *swiftlygo.SloUploader
+	if dedupContainer != "" {
+		params := pipeline.ChunkingParams{MinSize: chunkSize / 4, AvgSize: chunkSize, MaxSize: chunkSize * 4}
+		uploader, err = swiftlygo.NewDedupUploader(destination, params, container, dedupContainer, object, file, concurrency, log, opts...)
+	} else {
+		uploader, err = swiftlygo.NewSloUploader(destination, chunkSize, container, object, file, concurrency, onlyMissing, log, opts...)
+	}
+	if err != nil {
+		return fail(prepareStatus(err), "Unable to prepare upload: %s", err)
+	}
+
+	done := make(chan error)
+	go func() {
+		done <- uploader.Upload()
+	}()
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case err = <-done:
+			if progress {
+				printProgress(uploader.Status)
+				fmt.Fprintf(os.Stderr, "\n%s\n", uploader.Status)
+			}
+			if err != nil {
+				return fail(exitFailure, "Upload of %s failed: %s", path, err)
+			}
+			return nil
+		case <-ticker.C:
+			if progress {
+				printProgress(uploader.Status)
+			}
+		}
+	}
+}
+
+// prepareStatus chooses the exit status for an error from preparing an upload.
+// Failures of object storage or of the network, such as while creating the
+// segment container, are not problems with the arguments.
+func prepareStatus(err error) int {
+	var (
+		authErr   *auth.AuthError
+		statusErr *auth.HTTPStatusError
+		netErr    net.Error
+	)
+	switch {
+	case errors.As(err, &authErr):
+		return exitAuth
+	case errors.As(err, &statusErr), errors.As(err, &netErr):
+		return exitFailure
+	}
+	return exitUsage
+}
+
+// printProgress overwrites the current line of stderr with the upload's progress.
+func printProgress(status *swiftlygo.Status) {
+	remaining := "unknown"
+	if status.Rate() > 0 {
+		remaining = status.TimeRemaining().String()
+	}
+	fmt.Fprintf(os.Stderr, "\r%6.2f%% uploaded  %8.2f MB/sec  %s remaining    ",
+		status.PercentComplete(), status.RateMBPS(), remaining)
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"github.com/ibmjstart/swiftlygo/pipeline"
+	"github.com/ncw/swift"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+)
+
+var verifyCommand = command{
+	name:        "verify",
+	args:        "<container> <object> <file>",
+	minArgs:     3,
+	maxArgs:     3,
+	description: "Check that every segment of an uploaded object, and any checksums in its metadata, match a local file.",
+	setup: func(flags *flag.FlagSet) runner {
+		return func(creds *credentials, args []string) error {
+			return verify(creds, args[0], args[1], args[2])
+		}
+	},
+}
+
+// verify compares the MD5 sum of each segment of the object with the MD5 sum of
+// the same region of the local file and reports every difference. Checksums
+// stored in the metadata of the segments and of the object are compared too.
+func verify(creds *credentials, container, object, path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return fail(exitFailure, "Unable to open %s: %s", path, err)
+	}
+	defer file.Close()
+	destination, err := creds.connect()
+	if err != nil {
+		return err
+	}
+	connection := destination.SwiftConnection
+
+	// The checksums of a large object's manifest cover the whole file
+	whole := newChecksummer(nil)
+	segments, _, err := largeObjectSegments(connection, container, object)
+	if err == swift.NotLargeObject {
+		info, _, err := connection.Object(container, object)
+		if err != nil {
+			return fail(exitFailure, "Unable to read %s/%s: %s", container, object, err)
+		}
+		segments = []segment{{container: container, Object: info}}
+	} else if err != nil {
+		return fail(exitFailure, "Unable to find the segments of %s/%s: %s", container, object, err)
+	} else {
+		_, headers, err := connection.Object(container, object)
+		if err != nil {
+			return fail(exitFailure, "Unable to read %s/%s: %s", container, object, err)
+		}
+		whole = newChecksummer(headers.ObjectMetadata())
+	}
+
+	var (
+		offset     int64
+		mismatches int
+	)
+	for _, current := range segments {
+		_, headers, err := connection.Object(current.container, current.Name)
+		if err != nil {
+			return fail(exitFailure, "Unable to read %s/%s: %s", current.container, current.Name, err)
+		}
+		metadata := headers.ObjectMetadata()
+		if pipeline.IsCompressed(metadata) || pipeline.IsEncrypted(metadata) {
+			return fail(exitUsage, "Unable to verify %s/%s: compressed and encrypted segments cannot be compared with the file", current.container, current.Name)
+		}
+		checksums := newChecksummer(metadata)
+		hash := md5.New()
+		read, err := io.CopyN(io.MultiWriter(hash, checksums, whole), file, current.Bytes)
+		if err != nil && err != io.EOF {
+			return fail(exitFailure, "Unable to read %s: %s", path, err)
+		}
+		if sum := hex.EncodeToString(hash.Sum(nil)); read != current.Bytes || sum != current.Hash {
+			fmt.Printf("MISMATCH %s/%s at offset %d: expected %d bytes with md5 %s, found %d bytes with md5 %s\n",
+				current.container, current.Name, offset, current.Bytes, current.Hash, read, sum)
+			mismatches++
+		} else if problems := checksums.mismatches(); len(problems) > 0 {
+			fmt.Printf("MISMATCH %s/%s at offset %d: %s\n", current.container, current.Name, offset, strings.Join(problems, ", "))
+			mismatches++
+		}
+		offset += read
+	}
+	if extra, _ := io.Copy(ioutil.Discard, file); extra > 0 {
+		fmt.Printf("MISMATCH %s has %d bytes beyond the end of %s/%s\n", path, extra, container, object)
+		mismatches++
+	} else if problems := whole.mismatches(); len(problems) > 0 {
+		fmt.Printf("MISMATCH %s/%s as a whole: %s\n", container, object, strings.Join(problems, ", "))
+		mismatches++
+	}
+	if mismatches > 0 {
+		return fail(exitMismatch, "%d of %d segments of %s/%s do not match %s", mismatches, len(segments), container, object, path)
+	}
+	fmt.Printf("OK %s/%s matches %s (%d segments, %d bytes)\n", container, object, path, len(segments), offset)
+	return nil
+}
@@ -0,0 +1,143 @@
+package swiftlygo
+
+import (
+	"fmt"
+	"github.com/ibmjstart/swiftlygo/auth"
+	"github.com/ibmjstart/swiftlygo/pipeline"
+	"github.com/ncw/swift"
+	"io"
+	"os"
+)
+
+// DedupSegmentFormat is the name, within the segment container, of a chunk
+// uploaded by an uploader from NewDedupUploader, formatted with the hex-encoded
+// SHA-256 sum of the chunk's data.
+const DedupSegmentFormat = "sha256-%s"
+
+// NewDedupUploader prepares an upload for an SLO whose chunks are found by
+// content-defined chunking with params rather than at fixed offsets, so that
+// changing part of a file only changes the chunks around the change. Each
+// chunk is named by the SHA-256 sum of its data with DedupSegmentFormat and
+// stored in segmentContainer, which may be shared by many uploads: chunks that
+// are already there, or that appear earlier in the same file, are not uploaded
+// again. The manifests, which refer to the chunks in segmentContainer, are
+// stored in container, with the top-level manifest named object, unless
+// WithManifestContainer moves the intermediate manifests elsewhere. Missing
+// containers are created as they are by NewSloUploader.
+// NewDedupUploader reads the whole file to find its chunks before it returns,
+// and fails if a chunk that is already in segmentContainer was compressed or
+// encrypted differently than WithCompression and WithEncryption would store it.
+// It does not support auth.S3Destination, whose parts cannot be named by content.
+func NewDedupUploader(connection auth.Destination, params pipeline.ChunkingParams, container, segmentContainer,
+	object string, source *os.File, maxUploads uint, outputFile io.Writer, opts ...Option) (*SloUploader, error) {
+	settings := newSettings(outputFile, opts)
+	log := settings.logger
+	if err := checkUpload(connection, settings, container, object, source, maxUploads); err != nil {
+		return nil, err
+	}
+	if segmentContainer == "" {
+		return nil, fmt.Errorf("Segment container name cannot be the empty string")
+	}
+	// S3 needs every part to be named after the object that it belongs to
+	if _, ok := connection.(*auth.S3Destination); ok {
+		return nil, fmt.Errorf("Unable to deduplicate chunks for an S3 destination, which cannot share parts between objects")
+	}
+	if err := params.Validate(); err != nil {
+		return nil, err
+	}
+	limits := auth.SwiftLimits
+	if limited, ok := connection.(auth.LimitedDestination); ok {
+		limits = limited.Limits()
+	}
+	if params.MaxSize > limits.MaxChunkSize || params.MinSize < limits.MinChunkSize {
+		return nil, fmt.Errorf("Chunk sizes must be between %d and %d bytes for this destination", limits.MinChunkSize, limits.MaxChunkSize)
+	}
+
+	fileSize, err := getSize(source)
+	if err != nil {
+		return nil, err
+	}
+	// Find every chunk in advance to know how many there are
+	scanErrors := make(chan error, 1)
+	var found []pipeline.FileChunk
+	for chunk := range pipeline.ContentDefinedChunks(io.NewSectionReader(source, 0, int64(fileSize)), params, scanErrors) {
+		found = append(found, chunk)
+	}
+	select {
+	case err = <-scanErrors:
+		return nil, fmt.Errorf("Unable to find the chunks of %s: %w", source.Name(), err)
+	default:
+	}
+	if uint(len(found)) > limits.MaxChunks {
+		return nil, fmt.Errorf("File would be split into %d chunks, but at most %d are allowed. Use a larger chunk size", len(found), limits.MaxChunks)
+	}
+	if concurrent, ok := connection.(auth.ConcurrentDestination); ok {
+		concurrent.SetConcurrency(maxUploads)
+	}
+
+	if err = ensureContainers(connection, container, segmentContainer, settings.manifests); err != nil {
+		return nil, err
+	}
+	existing, err := connection.Objects(segmentContainer)
+	if err != nil {
+		log.Warn("Problem getting existing chunk names from object storage", "container", segmentContainer, "error", err)
+	}
+	if err = checkShared(connection, settings, segmentContainer, found, existing); err != nil {
+		return nil, err
+	}
+	fromSource := make(chan pipeline.FileChunk, len(found))
+	for _, chunk := range found {
+		fromSource <- chunk
+	}
+	close(fromSource)
+	chunkSize := params.AvgSize
+	if len(found) > 0 {
+		chunkSize = (fileSize + uint(len(found)) - 1) / uint(len(found))
+	}
+
+	return newUploader(connection, settings, uploadPlan{
+		container: container,
+		object:    object,
+		source:    source,
+		size:      fileSize,
+		chunks:    fromSource,
+		count:     uint(len(found)),
+		chunkSize: chunkSize,
+		existing:  existing,
+		name: func(chunks <-chan pipeline.FileChunk, errors chan<- error) <-chan pipeline.FileChunk {
+			chunks = pipeline.ContentNamer(chunks, errors, DedupSegmentFormat)
+			return pipeline.Containerizer(chunks, errors, segmentContainer)
+		},
+		deduplicate: true,
+	}, maxUploads)
+}
+
+// checkShared refuses to refer to existing chunks in segmentContainer that were
+// compressed or encrypted differently than this upload would store them. They
+// may be shared with other objects, whose manifests would no longer match them
+// if they were uploaded again.
+func checkShared(connection auth.Destination, settings settings, segmentContainer string, chunks []pipeline.FileChunk, existing []swift.Object) error {
+	described, ok := connection.(auth.MetadataDestination)
+	if !ok {
+		return nil
+	}
+	unchecked := make(map[string]bool, len(existing))
+	for _, serverObject := range existing {
+		unchecked[serverObject.Name] = true
+	}
+	for _, chunk := range chunks {
+		name := fmt.Sprintf(DedupSegmentFormat, chunk.Checksums[pipeline.SHA256.Name])
+		if !unchecked[name] {
+			continue
+		}
+		delete(unchecked, name)
+		metadata, err := described.ObjectMetadata(segmentContainer, name)
+		if err != nil {
+			return fmt.Errorf("Unable to get the metadata of chunk %s in %s: %w", name, segmentContainer, err)
+		}
+		if !pipeline.MatchesTransforms(metadata, settings.compression, settings.keys) {
+			return fmt.Errorf("Chunk %s in %s was compressed or encrypted differently and may be shared with other objects", name, segmentContainer)
+		}
+	}
+	return nil
+}
@@ -34,7 +34,7 @@ func NewDloUploader(connection auth.Destination, dloContainer, dloName, objectCo
 func (d *DloUploader) Upload() error {
 	err := d.connection.CreateDLO(d.dloContainer, d.dloName, d.objectContainer, d.prefix)
 	if err != nil {
-		return fmt.Errorf("Failed to upload DLO: %s", err)
+		return fmt.Errorf("Failed to upload DLO: %w", err)
 	}
 	return nil
 }
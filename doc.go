@@ -6,6 +6,7 @@ Object Storage instance. See the documentation of the auth package for details
 on how to authenticate with Object Storage Instances.
 The pipeline subpackage implements a low-level API for Static Large Object creation if
 the SloUploader doesn't offer the level of control that your application requires.
+The metrics subpackage exports the progress of uploads as Prometheus metrics.
 
 The root swiftlygo package provides functionality for easily creating Dynamic
 Large Objects and Static Large Objects.
@@ -0,0 +1,46 @@
+package swiftlygo
+
+import (
+	"fmt"
+	"github.com/ibmjstart/swiftlygo/pipeline"
+	"strings"
+)
+
+// UploadError is returned by SloUploader.Upload when any part of the upload
+// failed. Errors lists every failure in the order that it occurred. Use
+// errors.As to look for a particular kind of failure, such as a
+// *pipeline.ChunkUploadError or an *auth.ManifestEtagMismatchError.
+type UploadError struct {
+	Errors []error
+}
+
+func (e *UploadError) Error() string {
+	messages := make([]string, len(e.Errors))
+	for i, err := range e.Errors {
+		messages[i] = "\t" + err.Error()
+	}
+	return fmt.Sprintf("Encountered %d errors:\n%s", len(e.Errors), strings.Join(messages, "\n"))
+}
+
+// Unwrap returns the individual failures so that errors.Is and errors.As
+// examine each of them.
+func (e *UploadError) Unwrap() []error {
+	return e.Errors
+}
+
+// MissingChunksError is one of the Errors of an UploadError when some chunks
+// could not be uploaded. The manifest is not uploaded in that case, since it
+// would refer to segments that do not exist. Chunks lists the chunks that are
+// missing, in order. Uploading again with onlyMissing set retries just those
+// chunks before uploading the manifest.
+type MissingChunksError struct {
+	Chunks []pipeline.FileChunk
+}
+
+func (e *MissingChunksError) Error() string {
+	names := make([]string, len(e.Chunks))
+	for i, chunk := range e.Chunks {
+		names[i] = chunk.Object
+	}
+	return fmt.Sprintf("Did not upload the manifest because %d chunks are missing: %s", len(e.Chunks), strings.Join(names, ", "))
+}
@@ -0,0 +1,125 @@
+package metrics
+
+import (
+	"errors"
+	"github.com/ibmjstart/swiftlygo/auth"
+	"github.com/ibmjstart/swiftlygo/pipeline"
+	"github.com/prometheus/client_golang/prometheus"
+	"net"
+	"strconv"
+)
+
+// ChunkDurationBuckets are the upper bounds, in seconds, of the buckets of the
+// chunk upload duration histogram. They range from 100 milliseconds to about
+// 7 minutes.
+var ChunkDurationBuckets = prometheus.ExponentialBuckets(0.1, 2, 13)
+
+// Collector is a prometheus.Collector for the Events of uploads. Every metric
+// is labelled with the container that the upload writes to.
+type Collector struct {
+	bytes            *prometheus.CounterVec
+	chunks           *prometheus.CounterVec
+	chunkDuration    *prometheus.HistogramVec
+	retries          *prometheus.CounterVec
+	inFlight         *prometheus.GaugeVec
+	manifestDuration *prometheus.HistogramVec
+}
+
+// NewCollector creates a Collector whose metric names begin with namespace,
+// which may be empty.
+func NewCollector(namespace string) *Collector {
+	return &Collector{
+		bytes: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "uploaded_bytes_total",
+			Help:      "Bytes of chunk data uploaded successfully.",
+		}, []string{"container"}),
+		chunks: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "chunks_total",
+			Help:      "Chunks processed, by result: uploaded, skipped or failed.",
+		}, []string{"container", "result"}),
+		chunkDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "chunk_upload_duration_seconds",
+			Help:      "Duration of successful chunk upload attempts.",
+			Buckets:   ChunkDurationBuckets,
+		}, []string{"container"}),
+		retries: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "chunk_retries_total",
+			Help:      "Failed chunk upload attempts that were retried, by reason.",
+		}, []string{"container", "reason"}),
+		inFlight: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "uploads_in_flight",
+			Help:      "Uploads that have started but not finished.",
+		}, []string{"container"}),
+		manifestDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "manifest_upload_duration_seconds",
+			Help:      "Duration of successful manifest uploads.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"container"}),
+	}
+}
+
+func (c *Collector) collectors() []prometheus.Collector {
+	return []prometheus.Collector{c.bytes, c.chunks, c.chunkDuration, c.retries, c.inFlight, c.manifestDuration}
+}
+
+// Describe sends the descriptions of the Collector's metrics to descriptions.
+func (c *Collector) Describe(descriptions chan<- *prometheus.Desc) {
+	for _, collector := range c.collectors() {
+		collector.Describe(descriptions)
+	}
+}
+
+// Collect sends the current values of the Collector's metrics to metrics.
+func (c *Collector) Collect(metrics chan<- prometheus.Metric) {
+	for _, collector := range c.collectors() {
+		collector.Collect(metrics)
+	}
+}
+
+// Observer returns a pipeline.Observer that records the Events of an upload
+// to container.
+func (c *Collector) Observer(container string) pipeline.Observer {
+	return pipeline.ObserverFunc(func(event pipeline.Event) {
+		switch event := event.(type) {
+		case pipeline.UploadStarted:
+			c.inFlight.WithLabelValues(container).Inc()
+		case pipeline.UploadFinished, pipeline.UploadFailed:
+			c.inFlight.WithLabelValues(container).Dec()
+		case pipeline.ChunkCompleted:
+			c.bytes.WithLabelValues(container).Add(float64(event.Bytes))
+			c.chunks.WithLabelValues(container, "uploaded").Inc()
+			c.chunkDuration.WithLabelValues(container).Observe(event.Duration.Seconds())
+		case pipeline.ChunkSkipped:
+			c.chunks.WithLabelValues(container, "skipped").Inc()
+		case pipeline.ChunkFailed:
+			c.chunks.WithLabelValues(container, "failed").Inc()
+		case pipeline.ChunkRetried:
+			c.retries.WithLabelValues(container, Reason(event.Err)).Inc()
+		case pipeline.ManifestUploaded:
+			c.manifestDuration.WithLabelValues(container).Observe(event.Duration.Seconds())
+		}
+	})
+}
+
+// Reason classifies the cause of a failed upload attempt for the reason label
+// of the retry counter. It returns the status code of an *auth.HTTPStatusError,
+// "timeout" for network timeouts, and "other" for anything else.
+func Reason(err error) string {
+	var statusErr *auth.HTTPStatusError
+	var netErr net.Error
+	if errors.As(err, &statusErr) {
+		return strconv.Itoa(statusErr.Code)
+	} else if errors.As(err, &netErr) && netErr.Timeout() {
+		return "timeout"
+	}
+	return "other"
+}
+
+// Ensure that Collector satisfies the interface at compile-time
+var _ prometheus.Collector = &Collector{}
@@ -0,0 +1,114 @@
+package metrics_test
+
+import (
+	"fmt"
+	"github.com/ibmjstart/swiftlygo/auth"
+	"github.com/ibmjstart/swiftlygo/metrics"
+	"github.com/ibmjstart/swiftlygo/pipeline"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"strings"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+// timeoutError is a net.Error that reports a timeout.
+type timeoutError struct{}
+
+func (timeoutError) Error() string   { return "timed out" }
+func (timeoutError) Timeout() bool   { return true }
+func (timeoutError) Temporary() bool { return true }
+
+var _ = Describe("Collector", func() {
+	var (
+		collector *metrics.Collector
+		registry  *prometheus.Registry
+		observer  pipeline.Observer
+	)
+
+	BeforeEach(func() {
+		collector = metrics.NewCollector("swiftlygo")
+		registry = prometheus.NewPedanticRegistry()
+		Expect(registry.Register(collector)).To(Succeed())
+		observer = collector.Observer("container")
+	})
+
+	Context("When an upload is in progress", func() {
+		It("Should count it as in flight until it finishes", func() {
+			observer.OnEvent(pipeline.UploadStarted{Container: "container"})
+			collector.Observer("other").OnEvent(pipeline.UploadStarted{Container: "other"})
+			Expect(testutil.CollectAndCompare(collector, strings.NewReader(`
+# HELP swiftlygo_uploads_in_flight Uploads that have started but not finished.
+# TYPE swiftlygo_uploads_in_flight gauge
+swiftlygo_uploads_in_flight{container="container"} 1
+swiftlygo_uploads_in_flight{container="other"} 1
+`), "swiftlygo_uploads_in_flight")).To(Succeed())
+			observer.OnEvent(pipeline.UploadFinished{Container: "container"})
+			Expect(testutil.CollectAndCompare(collector, strings.NewReader(`
+# HELP swiftlygo_uploads_in_flight Uploads that have started but not finished.
+# TYPE swiftlygo_uploads_in_flight gauge
+swiftlygo_uploads_in_flight{container="container"} 0
+swiftlygo_uploads_in_flight{container="other"} 1
+`), "swiftlygo_uploads_in_flight")).To(Succeed())
+		})
+	})
+	Context("When chunks are processed", func() {
+		It("Should count bytes and chunks by result", func() {
+			observer.OnEvent(pipeline.ChunkCompleted{Number: 0, Bytes: 100, Duration: 300 * time.Millisecond})
+			observer.OnEvent(pipeline.ChunkCompleted{Number: 1, Bytes: 50, Duration: time.Second})
+			observer.OnEvent(pipeline.ChunkSkipped{Number: 2, Bytes: 100})
+			observer.OnEvent(pipeline.ChunkFailed{Number: 3, Bytes: 100})
+			Expect(testutil.CollectAndCompare(collector, strings.NewReader(`
+# HELP swiftlygo_uploaded_bytes_total Bytes of chunk data uploaded successfully.
+# TYPE swiftlygo_uploaded_bytes_total counter
+swiftlygo_uploaded_bytes_total{container="container"} 150
+# HELP swiftlygo_chunks_total Chunks processed, by result: uploaded, skipped or failed.
+# TYPE swiftlygo_chunks_total counter
+swiftlygo_chunks_total{container="container",result="failed"} 1
+swiftlygo_chunks_total{container="container",result="skipped"} 1
+swiftlygo_chunks_total{container="container",result="uploaded"} 2
+`), "swiftlygo_uploaded_bytes_total", "swiftlygo_chunks_total")).To(Succeed())
+			Expect(testutil.CollectAndCount(collector, "swiftlygo_chunk_upload_duration_seconds")).To(Equal(1))
+		})
+		It("Should record chunk latency in a histogram", func() {
+			observer.OnEvent(pipeline.ChunkCompleted{Duration: 150 * time.Millisecond})
+			observer.OnEvent(pipeline.ChunkCompleted{Duration: 250 * time.Millisecond})
+			metricFamilies, err := registry.Gather()
+			Expect(err).ShouldNot(HaveOccurred())
+			for _, family := range metricFamilies {
+				if family.GetName() == "swiftlygo_chunk_upload_duration_seconds" {
+					histogram := family.GetMetric()[0].GetHistogram()
+					Expect(histogram.GetSampleCount()).To(Equal(uint64(2)))
+					Expect(histogram.GetSampleSum()).To(BeNumerically("~", 0.4, 0.001))
+					Expect(histogram.GetBucket()[1].GetCumulativeCount()).To(Equal(uint64(1)))
+					return
+				}
+			}
+			Fail("The histogram was not gathered")
+		})
+	})
+	Context("When chunks are retried", func() {
+		It("Should count retries by reason", func() {
+			observer.OnEvent(pipeline.ChunkRetried{Err: &auth.HTTPStatusError{Code: 503}})
+			observer.OnEvent(pipeline.ChunkRetried{Err: fmt.Errorf("Error uploading data: %w", &auth.HTTPStatusError{Code: 503})})
+			observer.OnEvent(pipeline.ChunkRetried{Err: fmt.Errorf("Error initializing upload: %w", timeoutError{})})
+			observer.OnEvent(pipeline.ChunkRetried{Err: fmt.Errorf("disk on fire")})
+			Expect(testutil.CollectAndCompare(collector, strings.NewReader(`
+# HELP swiftlygo_chunk_retries_total Failed chunk upload attempts that were retried, by reason.
+# TYPE swiftlygo_chunk_retries_total counter
+swiftlygo_chunk_retries_total{container="container",reason="503"} 2
+swiftlygo_chunk_retries_total{container="container",reason="other"} 1
+swiftlygo_chunk_retries_total{container="container",reason="timeout"} 1
+`), "swiftlygo_chunk_retries_total")).To(Succeed())
+		})
+	})
+	Context("When manifests are uploaded", func() {
+		It("Should record their duration", func() {
+			observer.OnEvent(pipeline.ManifestUploaded{Duration: 20 * time.Millisecond})
+			Expect(testutil.CollectAndCount(collector, "swiftlygo_manifest_upload_duration_seconds")).To(Equal(1))
+			Expect(testutil.CollectAndCount(collector, "swiftlygo_chunk_upload_duration_seconds")).To(BeZero())
+		})
+	})
+})
@@ -0,0 +1,15 @@
+/*
+Package metrics exports the progress of uploads as Prometheus metrics.
+
+Create a Collector, register it with a prometheus.Registerer, and give each
+upload an Observer for the container that it uploads to:
+
+	collector := metrics.NewCollector("swiftlygo")
+	prometheus.MustRegister(collector)
+	uploader, err := swiftlygo.NewSloUploader(destination, chunkSize, container, object,
+		file, 8, false, nil, swiftlygo.WithObserver(collector.Observer(container)))
+
+One Collector may observe any number of concurrent uploads. The Observer can
+also be given to the stages of a custom pipeline with pipeline.WithObserver.
+*/
+package metrics
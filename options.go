@@ -0,0 +1,198 @@
+package swiftlygo
+
+import (
+	"github.com/ibmjstart/swiftlygo/pipeline"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/trace"
+	"io"
+)
+
+// settings holds the configuration that Options apply to an uploader.
+type settings struct {
+	logger      pipeline.Logger
+	observers   pipeline.Observers
+	provider    trace.TracerProvider
+	limiter     *pipeline.RateLimiter
+	adaptive    bool
+	minimum     uint
+	retry       pipeline.RetryPolicy
+	checksums   []pipeline.Checksum
+	etags       bool
+	keys        pipeline.KeyProvider
+	compression *pipeline.Compression
+	segments    string
+	manifests   string
+}
+
+// Option configures optional behavior of an uploader.
+type Option func(*settings)
+
+// WithLogger makes the uploader, its Status, and its pipeline stages log to
+// logger instead of to the outputFile given to NewSloUploader. A *log/slog.Logger
+// may be used directly.
+func WithLogger(logger pipeline.Logger) Option {
+	return func(s *settings) {
+		if logger != nil {
+			s.logger = logger
+		}
+	}
+}
+
+// WithObserver makes the uploader send the Events of each upload to observer.
+// It may be given more than once to subscribe several independent observers.
+func WithObserver(observer pipeline.Observer) Option {
+	return func(s *settings) {
+		if observer != nil {
+			s.observers = append(s.observers, observer)
+		}
+	}
+}
+
+// WithRateLimit limits the combined rate at which the uploader's workers send
+// data to bytesPerSecond. The limit can be changed during an upload with
+// SloUploader.SetRateLimit.
+func WithRateLimit(bytesPerSecond uint) Option {
+	return func(s *settings) {
+		s.limiter = pipeline.NewRateLimiter(bytesPerSecond)
+	}
+}
+
+// WithRateLimiter makes the uploader share limiter with anything else that
+// uses it, such as other uploaders, so that their combined rate stays within
+// its limit. Changing the rate of limiter affects all of them.
+func WithRateLimiter(limiter *pipeline.RateLimiter) Option {
+	return func(s *settings) {
+		if limiter != nil {
+			s.limiter = limiter
+		}
+	}
+}
+
+// WithAdaptiveConcurrency makes the uploader adjust how many chunks it uploads
+// at once, between minUploads and the maxUploads given to NewSloUploader. It
+// starts at minUploads, adds an upload each time that doing so has improved
+// throughput, and halves the number when uploads fail or slow down sharply.
+// The current number is reported by Status.Concurrency.
+func WithAdaptiveConcurrency(minUploads uint) Option {
+	return func(s *settings) {
+		s.adaptive = true
+		s.minimum = minUploads
+	}
+}
+
+// WithRetryPolicy makes the uploader retry failed chunk and manifest uploads
+// according to policy instead of pipeline.DefaultRetryPolicy.
+func WithRetryPolicy(policy pipeline.RetryPolicy) Option {
+	return func(s *settings) {
+		if policy != nil {
+			s.retry = policy
+		}
+	}
+}
+
+// WithChecksums makes the uploader compute checksums of each chunk, such as
+// pipeline.SHA256, in addition to the MD5 sum that it checks against the Etag
+// that object storage returns. If the destination is an
+// auth.MetadataDestination, each chunk's checksums are stored in its metadata
+// and those of the whole file in the metadata of the top-level manifest.
+func WithChecksums(checksums ...pipeline.Checksum) Option {
+	return func(s *settings) {
+		s.checksums = append(s.checksums, checksums...)
+	}
+}
+
+// WithPrecomputedEtags makes the uploader read each chunk twice: first to
+// compute its MD5 sum, and then to upload it with the sum as the expected
+// Etag, so that object storage rejects data corrupted in transit instead of
+// storing it.
+func WithPrecomputedEtags() Option {
+	return func(s *settings) {
+		s.etags = true
+	}
+}
+
+// WithEncryption makes the uploader encrypt each chunk with AES-256-GCM using
+// the current key of keys, so that object storage only ever holds ciphertext.
+// The destination must be an auth.MetadataDestination, since the key's ID and
+// each chunk's nonce are stored in the chunk's metadata. The manifests are
+// not encrypted; read the file back by decrypting each segment with
+// pipeline.NewDecrypter.
+func WithEncryption(keys pipeline.KeyProvider) Option {
+	return func(s *settings) {
+		s.keys = keys
+	}
+}
+
+// WithCompression makes the uploader compress each chunk independently with
+// compression, such as pipeline.Gzip or pipeline.Zstd, before encrypting it if
+// WithEncryption is also given. Each segment's metadata records the algorithm
+// and the chunk's offset and size in the file, and the manifests refer to the
+// compressed segments. The destination must be an auth.MetadataDestination.
+// Read the file back with pipeline.NewDecompressor, or read any part of it with
+// pipeline.NewIndexedReader and the UploadReport's Index.
+func WithCompression(compression pipeline.Compression) Option {
+	return func(s *settings) {
+		s.compression = &compression
+	}
+}
+
+// SegmentContainerSuffix is appended to the name of a container to name the
+// container that holds its segments, following the usual Swift convention.
+const SegmentContainerSuffix = "_segments"
+
+// SegmentContainer returns the conventional name of the container that holds
+// the segments of the large objects in container.
+func SegmentContainer(container string) string {
+	return container + SegmentContainerSuffix
+}
+
+// WithSegmentContainer makes the uploader store the chunks of the file in
+// container rather than in the container of the top-level manifest, so that
+// listing that container only shows whole objects. SegmentContainer gives the
+// conventional name. NewDedupUploader ignores this option, since it is given
+// its segment container directly. NewSloUploader refuses it for an
+// auth.S3Destination, since S3 only assembles an object out of parts uploaded
+// to the object's bucket.
+func WithSegmentContainer(container string) Option {
+	return func(s *settings) {
+		s.segments = container
+	}
+}
+
+// WithManifestContainer makes the uploader store the intermediate manifests,
+// which each refer to up to 1000 chunks, in container rather than in the
+// container of the top-level manifest.
+func WithManifestContainer(container string) Option {
+	return func(s *settings) {
+		s.manifests = container
+	}
+}
+
+// WithTracerProvider makes the uploader create OpenTelemetry spans with
+// provider: one for each call to Upload, with children for each attempt to
+// upload a chunk and for each manifest. By default, the global TracerProvider
+// is used, which does nothing unless the application configures one.
+func WithTracerProvider(provider trace.TracerProvider) Option {
+	return func(s *settings) {
+		if provider != nil {
+			s.provider = provider
+		}
+	}
+}
+
+// newSettings applies opts to the default settings, which log informational
+// messages to output if it is not nil and do not limit the upload rate.
+func newSettings(output io.Writer, opts []Option) settings {
+	s := settings{
+		logger:   pipeline.NopLogger(),
+		provider: otel.GetTracerProvider(),
+		limiter:  pipeline.NewRateLimiter(0),
+	}
+	if output != nil {
+		s.logger = pipeline.NewWriterLogger(output, pipeline.LevelInfo)
+	}
+	for _, opt := range opts {
+		opt(&s)
+	}
+	return s
+}
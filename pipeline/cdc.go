@@ -0,0 +1,226 @@
+package pipeline
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"math/bits"
+)
+
+// ChunkingParams are the sizes, in bytes, of the chunks that
+// ContentDefinedChunks finds. Chunks are at least MinSize and at most MaxSize
+// bytes long, except that the final chunk may be shorter than MinSize, and
+// are AvgSize bytes long on average.
+type ChunkingParams struct {
+	MinSize uint
+	AvgSize uint
+	MaxSize uint
+}
+
+// DefaultChunkingParams produces chunks of 4 MiB on average.
+var DefaultChunkingParams = ChunkingParams{
+	MinSize: 1 << 20,
+	AvgSize: 4 << 20,
+	MaxSize: 16 << 20,
+}
+
+// Validate returns an error unless 64 <= MinSize < AvgSize < MaxSize.
+func (p ChunkingParams) Validate() error {
+	if p.MinSize < 64 || p.MinSize >= p.AvgSize || p.AvgSize >= p.MaxSize {
+		return fmt.Errorf("Chunk sizes must satisfy 64 <= minimum (%d) < average (%d) < maximum (%d)", p.MinSize, p.AvgSize, p.MaxSize)
+	}
+	return nil
+}
+
+// masks returns the masks that FastCDC's normalized chunking compares with the
+// fingerprint before and after the average size. The small mask has more bits
+// than the average size implies, making a cut less likely before it, and the
+// large mask fewer, making one more likely after it. The bits are the high
+// bits of the fingerprint, which depend on the most bytes.
+func (p ChunkingParams) masks() (small, large uint64) {
+	n := uint(bits.Len(p.AvgSize) - 1)
+	return ^uint64(0) << (64 - (n + 1)), ^uint64(0) << (64 - (n - 1))
+}
+
+// gear holds a random value for each byte, which FastCDC adds to its rolling
+// fingerprint. It must never change, since content-defined chunks are named by
+// their contents and a different table would find different chunks.
+var gear = func() (table [256]uint64) {
+	// splitmix64 from a fixed seed
+	state := uint64(0x9e3779b97f4a7c15)
+	for i := range table {
+		state += 0x9e3779b97f4a7c15
+		z := state
+		z = (z ^ (z >> 30)) * 0xbf58476d1ce4e5b9
+		z = (z ^ (z >> 27)) * 0x94d049bb133111eb
+		table[i] = z ^ (z >> 31)
+	}
+	return table
+}()
+
+// cutPoint returns the length of the chunk that begins data, which holds the
+// rest of the source if it is shorter than MaxSize.
+func (p ChunkingParams) cutPoint(data []byte, small, large uint64) int {
+	n := uint(len(data))
+	if n <= p.MinSize {
+		return int(n)
+	}
+	n = min(n, p.MaxSize)
+	normal := min(n, p.AvgSize)
+	var fingerprint uint64
+	i := p.MinSize
+	for ; i < normal; i++ {
+		fingerprint = (fingerprint << 1) + gear[data[i]]
+		if fingerprint&small == 0 {
+			return int(i + 1)
+		}
+	}
+	for ; i < n; i++ {
+		fingerprint = (fingerprint << 1) + gear[data[i]]
+		if fingerprint&large == 0 {
+			return int(i + 1)
+		}
+	}
+	return int(n)
+}
+
+// ContentDefinedChunks reads source to its end and sends back a FileChunk for
+// each region of it found with FastCDC, with its Number, Offset, and Size set
+// and the SHA-256 sum of its data in its Checksums. Since the boundaries of the
+// chunks depend on the data around them rather than on their offset, inserting
+// or removing data only changes the chunks around the change. Read errors and
+// invalid params are sent on errors, after which no more chunks are sent.
+func ContentDefinedChunks(source io.Reader, params ChunkingParams, errors chan<- error) <-chan FileChunk {
+	chunks := make(chan FileChunk)
+	go func() {
+		defer close(chunks)
+		if err := params.Validate(); err != nil {
+			errors <- err
+			return
+		}
+		small, large := params.masks()
+		buffer := make([]byte, 0, 2*params.MaxSize)
+		var (
+			number, offset uint
+			eof            bool
+		)
+		for {
+			// Keep at least MaxSize bytes buffered until the source ends
+			for !eof && uint(len(buffer)) < params.MaxSize {
+				n, err := source.Read(buffer[len(buffer):cap(buffer)])
+				buffer = buffer[:len(buffer)+n]
+				if err == io.EOF {
+					eof = true
+				} else if err != nil {
+					errors <- fmt.Errorf("Unable to read data for chunk %d: %s", number, err)
+					return
+				}
+			}
+			if len(buffer) == 0 {
+				return
+			}
+			size := params.cutPoint(buffer, small, large)
+			sum := sha256.Sum256(buffer[:size])
+			chunks <- FileChunk{
+				Number:    number,
+				Offset:    offset,
+				Size:      uint(size),
+				Checksums: map[string]string{SHA256.Name: hex.EncodeToString(sum[:])},
+			}
+			number++
+			offset += uint(size)
+			buffer = buffer[:copy(buffer, buffer[size:])]
+		}
+	}()
+	return chunks
+}
+
+// ContentNamer names each chunk by the SHA-256 sum in its Checksums, such as
+// those from ContentDefinedChunks, by formatting it with nameFormat. Chunks
+// with the same data therefore have the same name. Chunks without a SHA-256
+// sum are reported on errors and not passed on.
+func ContentNamer(chunks <-chan FileChunk, errors chan<- error, nameFormat string) <-chan FileChunk {
+	return Map(chunks, errors, func(chunk FileChunk) (FileChunk, error) {
+		sum, ok := chunk.Checksums[SHA256.Name]
+		if !ok {
+			return chunk, &InvalidChunkError{Stage: "ContentNamer", Number: chunk.Number, Reason: "with no SHA-256 sum"}
+		}
+		chunk.Object = fmt.Sprintf(nameFormat, sum)
+		return chunk, nil
+	})
+}
+
+// Deduplicate sends the first chunk with each Object name on its first channel,
+// and any later chunk with the same name on its second channel, so that each
+// object is only uploaded once. Both channels must be read concurrently, and
+// the repeated chunks can be completed with Replicate once the first ones have
+// been uploaded.
+func Deduplicate(chunks <-chan FileChunk) (<-chan FileChunk, <-chan FileChunk) {
+	unique := make(chan FileChunk)
+	repeated := make(chan FileChunk)
+	go func() {
+		defer close(unique)
+		defer close(repeated)
+		seen := make(map[string]bool)
+		for chunk := range chunks {
+			if seen[chunk.Object] {
+				repeated <- chunk
+				continue
+			}
+			seen[chunk.Object] = true
+			unique <- chunk
+		}
+	}()
+	return unique, repeated
+}
+
+// Replicate passes on every chunk of its first channel, and each chunk of
+// repeated once a chunk with the same Object name has passed, with that
+// chunk's Hash, Size, SourceSize, and Checksums, since both refer to the same
+// object. Repeated chunks whose object never passes, because its upload
+// failed, are dropped.
+func Replicate(chunks <-chan FileChunk, repeated <-chan FileChunk) <-chan FileChunk {
+	out := make(chan FileChunk)
+	go func() {
+		defer close(out)
+		var (
+			passed  = make(map[string]FileChunk)
+			waiting = make(map[string][]FileChunk)
+		)
+		// copyFrom gives a repeated chunk the details of the uploaded one
+		copyFrom := func(chunk, original FileChunk) FileChunk {
+			chunk.Hash = original.Hash
+			chunk.Size = original.Size
+			chunk.SourceSize = original.SourceSize
+			chunk.Checksums = original.Checksums
+			return chunk
+		}
+		for chunks != nil || repeated != nil {
+			select {
+			case chunk, ok := <-chunks:
+				if !ok {
+					chunks = nil
+					continue
+				}
+				passed[chunk.Object] = chunk
+				out <- chunk
+				for _, repeat := range waiting[chunk.Object] {
+					out <- copyFrom(repeat, chunk)
+				}
+				delete(waiting, chunk.Object)
+			case repeat, ok := <-repeated:
+				if !ok {
+					repeated = nil
+					continue
+				}
+				if original, ok := passed[repeat.Object]; ok {
+					out <- copyFrom(repeat, original)
+				} else {
+					waiting[repeat.Object] = append(waiting[repeat.Object], repeat)
+				}
+			}
+		}
+	}()
+	return out
+}
@@ -0,0 +1,122 @@
+package pipeline_test
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"math/rand"
+
+	. "github.com/ibmjstart/swiftlygo/pipeline"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Content-defined chunking", func() {
+	var (
+		data   []byte
+		params ChunkingParams
+		errs   chan error
+	)
+
+	BeforeEach(func() {
+		data = make([]byte, 256*1024)
+		rand.New(rand.NewSource(1)).Read(data)
+		params = ChunkingParams{MinSize: 1024, AvgSize: 4096, MaxSize: 16384}
+		errs = make(chan error, 10)
+	})
+
+	// chunk splits data with params
+	chunk := func(data []byte) []FileChunk {
+		var chunks []FileChunk
+		for chunk := range ContentDefinedChunks(bytes.NewReader(data), params, errs) {
+			chunks = append(chunks, chunk)
+		}
+		Expect(errs).To(BeEmpty())
+		return chunks
+	}
+
+	It("Should split the data into numbered chunks within the size limits", func() {
+		chunks := chunk(data)
+		Expect(len(chunks)).To(BeNumerically(">", len(data)/int(params.MaxSize)))
+		var offset uint
+		for i, chunk := range chunks {
+			Expect(chunk.Number).To(Equal(uint(i)))
+			Expect(chunk.Offset).To(Equal(offset))
+			Expect(chunk.Size).To(BeNumerically("<=", params.MaxSize))
+			if i < len(chunks)-1 {
+				Expect(chunk.Size).To(BeNumerically(">=", params.MinSize))
+			}
+			sum := sha256.Sum256(data[chunk.Offset : chunk.Offset+chunk.Size])
+			Expect(chunk.Checksums).To(Equal(map[string]string{"sha256": hex.EncodeToString(sum[:])}))
+			offset += chunk.Size
+		}
+		Expect(offset).To(Equal(uint(len(data))))
+	})
+	It("Should only change the chunks around an insertion", func() {
+		before := make(map[string]bool)
+		for _, chunk := range chunk(data) {
+			before[chunk.Checksums["sha256"]] = true
+		}
+		after := chunk(append([]byte{42}, data...))
+		changed := 0
+		for _, chunk := range after {
+			if !before[chunk.Checksums["sha256"]] {
+				changed++
+			}
+		}
+		Expect(changed).To(BeNumerically("<=", 2))
+	})
+	It("Should reject sizes that are out of order", func() {
+		params.MinSize = params.AvgSize
+		for range ContentDefinedChunks(bytes.NewReader(data), params, errs) {
+			Fail("A chunk was found with invalid sizes")
+		}
+		Expect(errs).To(HaveLen(1))
+	})
+	It("Should name chunks by their SHA-256 sum", func() {
+		chunks := make(chan FileChunk, 2)
+		chunks <- FileChunk{Number: 0, Checksums: map[string]string{"sha256": "abc"}}
+		chunks <- FileChunk{Number: 1}
+		close(chunks)
+		var named []FileChunk
+		for chunk := range ContentNamer(chunks, errs, "sha256-%s") {
+			named = append(named, chunk)
+		}
+		Expect(named).To(HaveLen(1))
+		Expect(named[0].Object).To(Equal("sha256-abc"))
+		var invalid *InvalidChunkError
+		Expect(errors.As(<-errs, &invalid)).To(BeTrue())
+	})
+	It("Should upload repeated chunks once and complete them from the first", func() {
+		chunks := make(chan FileChunk, 3)
+		for i, name := range []string{"a", "b", "a"} {
+			chunks <- FileChunk{Number: uint(i), Object: name, Size: 10}
+		}
+		close(chunks)
+		unique, repeated := Deduplicate(chunks)
+		// Complete the unique chunks only after the repeated one is waiting
+		uploaded := make(chan FileChunk)
+		var names []string
+		go func() {
+			defer close(uploaded)
+			for chunk := range unique {
+				names = append(names, chunk.Object)
+				chunk.Hash = "hash-" + chunk.Object
+				chunk.SourceSize, chunk.Size = chunk.Size, 5
+				uploaded <- chunk
+			}
+		}()
+		var replicated []FileChunk
+		for chunk := range Replicate(uploaded, repeated) {
+			replicated = append(replicated, chunk)
+		}
+		Expect(names).To(Equal([]string{"a", "b"}))
+		Expect(replicated).To(HaveLen(3))
+		for _, chunk := range replicated {
+			Expect(chunk.Hash).To(Equal("hash-" + chunk.Object))
+			Expect(chunk.Size).To(Equal(uint(5)))
+			Expect(chunk.SourceSize).To(Equal(uint(10)))
+		}
+	})
+})
@@ -0,0 +1,152 @@
+package pipeline
+
+import (
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
+	"github.com/zeebo/blake3"
+	"hash"
+	"hash/crc32"
+	"io"
+	"strings"
+)
+
+// Checksum is a digest of a chunk's content that ReadHashAndUpload can compute
+// in addition to the MD5 sum that object storage uses as the Etag. Name is
+// the key of the digest in FileChunk.Checksums, and New creates the hash.
+type Checksum struct {
+	Name string
+	New  func() hash.Hash
+}
+
+// The built-in Checksums, which LookupChecksum finds by Name.
+var (
+	// SHA256 computes the SHA-256 digest of each chunk.
+	SHA256 = Checksum{Name: "sha256", New: sha256.New}
+	// BLAKE3 computes the 256-bit BLAKE3 digest of each chunk.
+	BLAKE3 = Checksum{Name: "blake3", New: func() hash.Hash { return blake3.New() }}
+	// CRC32C computes the CRC-32 of each chunk with the Castagnoli polynomial.
+	CRC32C = Checksum{Name: "crc32c", New: func() hash.Hash { return crc32.New(crc32.MakeTable(crc32.Castagnoli)) }}
+)
+
+// ChecksumMetadataPrefix begins the key of the object metadata that holds a
+// checksum, which is followed by the Name of the Checksum. The metadata is
+// sent in an X-Object-Meta-Checksum-<name> header.
+const ChecksumMetadataPrefix = "Checksum-"
+
+// LookupChecksum returns the built-in Checksum named name, such as "sha256".
+func LookupChecksum(name string) (Checksum, bool) {
+	for _, checksum := range []Checksum{SHA256, BLAKE3, CRC32C} {
+		if strings.EqualFold(checksum.Name, name) {
+			return checksum, true
+		}
+	}
+	return Checksum{}, false
+}
+
+// ComputeChecksums reads r until it ends and returns its hex-encoded
+// checksums by name.
+func ComputeChecksums(r io.Reader, checksums ...Checksum) (map[string]string, error) {
+	d := newDigests(checksums)
+	if _, err := io.Copy(d, r); err != nil {
+		return nil, err
+	}
+	return d.sums(), nil
+}
+
+// ChecksumMetadata returns the object metadata that stores sums, or nil if
+// there are none.
+func ChecksumMetadata(sums map[string]string) map[string]string {
+	if len(sums) == 0 {
+		return nil
+	}
+	metadata := make(map[string]string, len(sums))
+	for name, sum := range sums {
+		metadata[ChecksumMetadataPrefix+name] = sum
+	}
+	return metadata
+}
+
+// MetadataChecksums returns the checksums stored in object metadata by
+// ChecksumMetadata, by lower-case name. Keys are matched regardless of case,
+// because object storage may change it.
+func MetadataChecksums(metadata map[string]string) map[string]string {
+	prefix := strings.ToLower(ChecksumMetadataPrefix)
+	sums := make(map[string]string)
+	for key, value := range metadata {
+		if key = strings.ToLower(key); strings.HasPrefix(key, prefix) {
+			sums[strings.TrimPrefix(key, prefix)] = value
+		}
+	}
+	return sums
+}
+
+// digests computes the MD5 sum and the checksums of a chunk's content in a
+// single pass.
+type digests struct {
+	md5       hash.Hash
+	checksums []Checksum
+	hashes    []hash.Hash
+}
+
+func newDigests(checksums []Checksum) *digests {
+	d := &digests{md5: md5.New(), checksums: checksums}
+	for _, checksum := range checksums {
+		d.hashes = append(d.hashes, checksum.New())
+	}
+	return d
+}
+
+// Write adds p to every digest. It never returns an error.
+func (d *digests) Write(p []byte) (int, error) {
+	d.md5.Write(p)
+	for _, h := range d.hashes {
+		h.Write(p)
+	}
+	return len(p), nil
+}
+
+// etag returns the hex-encoded MD5 sum.
+func (d *digests) etag() string {
+	return hex.EncodeToString(d.md5.Sum(nil))
+}
+
+// sums returns the hex-encoded checksums by name, or nil if there are none.
+func (d *digests) sums() map[string]string {
+	if len(d.hashes) == 0 {
+		return nil
+	}
+	sums := make(map[string]string, len(d.hashes))
+	for i, h := range d.hashes {
+		sums[d.checksums[i].Name] = hex.EncodeToString(h.Sum(nil))
+	}
+	return sums
+}
+
+// normalizeEtag removes the quotes and capitals that some servers add to an
+// Etag so that it can be compared with an MD5 sum.
+func normalizeEtag(etag string) string {
+	return strings.ToLower(strings.Trim(etag, "\""))
+}
+
+// readChunk reads the data of chunk from source, using buffer, and writes it
+// to w.
+func readChunk(source io.ReaderAt, chunk FileChunk, buffer []byte, w io.Writer) error {
+	for read := uint(0); read < chunk.Size; {
+		n, err := source.ReadAt(buffer[:min(uint(len(buffer)), chunk.Size-read)], int64(chunk.Offset+read))
+		if n == 0 && err != nil {
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return err
+		}
+		if err != nil && err != io.EOF {
+			return err
+		}
+		if _, err = w.Write(buffer[:n]); err != nil {
+			return err
+		}
+		read += uint(n)
+	}
+	return nil
+}
@@ -0,0 +1,170 @@
+package pipeline_test
+
+import (
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"github.com/ibmjstart/swiftlygo/auth"
+	"github.com/ibmjstart/swiftlygo/auth/mock"
+	"github.com/mattetti/filebuffer"
+	"github.com/ncw/swift"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	. "github.com/ibmjstart/swiftlygo/pipeline"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+// etagUpload discards its data and reports etag as the Etag of the object.
+type etagUpload struct {
+	etag string
+}
+
+func (e etagUpload) Write(p []byte) (int, error) {
+	return len(p), nil
+}
+
+func (e etagUpload) Close() error {
+	return nil
+}
+
+func (e etagUpload) Headers() (swift.Headers, error) {
+	return swift.Headers{"Etag": e.etag}, nil
+}
+
+// etagDestination is a NullDestination that records the hashes that it is
+// asked to check, and reports etag as the Etag of every object.
+type etagDestination struct {
+	mock.NullDestination
+	sync.Mutex
+	etag   string
+	hashes []string
+}
+
+func (e *etagDestination) CreateFile(container, objectName string, checkHash bool, hash string) (auth.WriteCloseHeader, error) {
+	e.Lock()
+	defer e.Unlock()
+	e.hashes = append(e.hashes, hash)
+	return etagUpload{etag: e.etag}, nil
+}
+
+var _ = Describe("Checksums", func() {
+	var (
+		data   []byte
+		md5sum string
+		chunks chan FileChunk
+		errs   chan error
+	)
+
+	BeforeEach(func() {
+		data = []byte("0123456789")
+		sum := md5.Sum(data)
+		md5sum = hex.EncodeToString(sum[:])
+		chunks = make(chan FileChunk, 1)
+		chunks <- FileChunk{Number: 0, Size: uint(len(data)), Object: "object", Container: "container"}
+		close(chunks)
+		errs = make(chan error, 10)
+	})
+
+	Context("When object storage returns the right Etag", func() {
+		It("Should compute the MD5 sum and any other checksums", func() {
+			dest := &etagDestination{etag: "\"" + md5sum + "\""}
+			chunk := <-ReadHashAndUpload(chunks, errs, filebuffer.New(data), dest, WithChecksums(SHA256))
+			Expect(errs).To(BeEmpty())
+			Expect(chunk.Hash).To(Equal(md5sum))
+			sum := sha256.Sum256(data)
+			Expect(chunk.Checksums).To(Equal(map[string]string{"sha256": hex.EncodeToString(sum[:])}))
+			Expect(dest.hashes).To(Equal([]string{""}))
+		})
+		It("Should send the MD5 sum with the upload if it is precomputed", func() {
+			dest := &etagDestination{etag: md5sum}
+			chunk := <-ReadHashAndUpload(chunks, errs, filebuffer.New(data), dest, WithPrecomputedEtags())
+			Expect(errs).To(BeEmpty())
+			Expect(chunk.Hash).To(Equal(md5sum))
+			Expect(dest.hashes).To(Equal([]string{md5sum}))
+		})
+	})
+	Context("When Swift rejects data corrupted in transit", func() {
+		It("Should send the chunk again", func() {
+			var puts int32
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				body, _ := ioutil.ReadAll(r.Body)
+				if atomic.AddInt32(&puts, 1) == 1 {
+					w.WriteHeader(http.StatusUnprocessableEntity)
+					return
+				}
+				sum := md5.Sum(body)
+				w.Header().Set("Etag", hex.EncodeToString(sum[:]))
+				w.WriteHeader(http.StatusCreated)
+			}))
+			defer server.Close()
+			dest, err := auth.AuthenticateWithToken("token", server.URL)
+			Expect(err).ShouldNot(HaveOccurred())
+			chunk := <-ReadHashAndUpload(chunks, errs, filebuffer.New(data), dest,
+				WithPrecomputedEtags(), WithRetryPolicy(ExponentialBackoff{Attempts: 2}))
+			Expect(errs).To(BeEmpty())
+			Expect(chunk.Hash).To(Equal(md5sum))
+			Expect(atomic.LoadInt32(&puts)).To(Equal(int32(2)))
+		})
+	})
+	Context("When object storage returns a different Etag", func() {
+		It("Should fail the attempt with an EtagMismatchError", func() {
+			dest := &etagDestination{etag: "0123456789abcdef0123456789abcdef"}
+			deadLetters := make(chan FileChunk, 1)
+			for range ReadHashAndUpload(chunks, errs, filebuffer.New(data), dest,
+				WithRetryPolicy(ExponentialBackoff{Attempts: 2}), WithDeadLetters(deadLetters)) {
+				Fail("A corrupted chunk was passed on")
+			}
+			Expect(errs).To(HaveLen(1))
+			var mismatch *EtagMismatchError
+			Expect(errors.As(<-errs, &mismatch)).To(BeTrue())
+			Expect(mismatch.Expected).To(Equal(md5sum))
+			Expect(mismatch.Actual).To(Equal("0123456789abcdef0123456789abcdef"))
+			Expect(deadLetters).To(HaveLen(1))
+		})
+	})
+})
+
+var _ = Describe("Checksum metadata", func() {
+	It("Should find the built-in checksums by name", func() {
+		for _, checksum := range []Checksum{SHA256, BLAKE3, CRC32C} {
+			found, ok := LookupChecksum(strings.ToUpper(checksum.Name))
+			Expect(ok).To(BeTrue())
+			Expect(found.Name).To(Equal(checksum.Name))
+		}
+		_, ok := LookupChecksum("md4")
+		Expect(ok).To(BeFalse())
+	})
+	It("Should read back the checksums that it stores, whatever their case", func() {
+		metadata := ChecksumMetadata(map[string]string{"sha256": "abc"})
+		Expect(metadata).To(Equal(map[string]string{"Checksum-sha256": "abc"}))
+		Expect(MetadataChecksums(map[string]string{"checksum-sha256": "abc", "other": "value"})).To(Equal(map[string]string{"sha256": "abc"}))
+		Expect(ChecksumMetadata(nil)).To(BeNil())
+	})
+	It("Should compute checksums of a stream", func() {
+		sums, err := ComputeChecksums(strings.NewReader("abc"), CRC32C, BLAKE3)
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(sums).To(Equal(map[string]string{
+			"crc32c": "364b3fb7",
+			"blake3": "6437b3ac38465133ffb63b75273a8db548c558465d79db03fd359c6cd5bd9d85",
+		}))
+	})
+	It("Should store the checksums of each chunk in its metadata", func() {
+		data := []byte("0123456789")
+		chunks := make(chan FileChunk, 1)
+		chunks <- FileChunk{Number: 0, Size: uint(len(data)), Object: "object", Container: "container"}
+		close(chunks)
+		errs := make(chan error, 10)
+		dest := mock.NewBufferDestination()
+		chunk := <-ReadHashAndUpload(chunks, errs, filebuffer.New(data), dest, WithChecksums(SHA256))
+		Expect(errs).To(BeEmpty())
+		Expect(dest.Metadata["container/object"]).To(Equal(ChecksumMetadata(chunk.Checksums)))
+		Expect(dest.FileContent.Contents.Bytes()).To(Equal(data))
+	})
+})
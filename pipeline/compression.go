@@ -0,0 +1,314 @@
+package pipeline
+
+import (
+	"compress/gzip"
+	"crypto/md5"
+	"encoding/hex"
+	"fmt"
+	"github.com/klauspost/compress/zstd"
+	"hash"
+	"io"
+	"io/ioutil"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Compression is an algorithm with which ReadHashAndUpload can compress each
+// chunk. Compressing the same data must always produce the same output, since
+// chunks may be compressed twice to compute their Etag in advance.
+type Compression struct {
+	// Name is stored in the MetadataCompression metadata of each chunk.
+	Name string
+	// NewWriter returns a writer that compresses what is written to it into w
+	// until it is closed.
+	NewWriter func(w io.Writer) (io.WriteCloser, error)
+	// NewReader returns a reader of the decompressed data read from r.
+	NewReader func(r io.Reader) (io.ReadCloser, error)
+}
+
+// Gzip compresses chunks with gzip at the default level.
+var Gzip = Compression{
+	Name: "gzip",
+	NewWriter: func(w io.Writer) (io.WriteCloser, error) {
+		return gzip.NewWriter(w), nil
+	},
+	NewReader: func(r io.Reader) (io.ReadCloser, error) {
+		return gzip.NewReader(r)
+	},
+}
+
+// Zstd compresses chunks with Zstandard at the default level.
+var Zstd = Compression{
+	Name: "zstd",
+	NewWriter: func(w io.Writer) (io.WriteCloser, error) {
+		return zstd.NewWriter(w, zstd.WithEncoderConcurrency(1))
+	},
+	NewReader: func(r io.Reader) (io.ReadCloser, error) {
+		decoder, err := zstd.NewReader(r, zstd.WithDecoderConcurrency(1))
+		if err != nil {
+			return nil, err
+		}
+		return decoder.IOReadCloser(), nil
+	},
+}
+
+// The keys of the object metadata of compressed chunks. MetadataOriginalOffset
+// and MetadataOriginalSize locate the chunk's data in the source before it was
+// compressed.
+const (
+	MetadataCompression    = "Compress-Algorithm"
+	MetadataOriginalOffset = "Compress-Offset"
+	MetadataOriginalSize   = "Compress-Size"
+)
+
+// LookupCompression returns the built-in Compression with the given name,
+// ignoring case.
+func LookupCompression(name string) (Compression, bool) {
+	for _, compression := range []Compression{Gzip, Zstd} {
+		if strings.EqualFold(compression.Name, name) {
+			return compression, true
+		}
+	}
+	return Compression{}, false
+}
+
+// compressionMetadata returns the metadata of chunk once it is compressed with
+// compression.
+func compressionMetadata(compression *Compression, chunk FileChunk) map[string]string {
+	return map[string]string{
+		MetadataCompression:    compression.Name,
+		MetadataOriginalOffset: strconv.FormatUint(uint64(chunk.Offset), 10),
+		MetadataOriginalSize:   strconv.FormatUint(uint64(chunk.Size), 10),
+	}
+}
+
+// IsCompressed reports whether metadata describes an object that was
+// compressed by ReadHashAndUpload or a manifest of such objects.
+func IsCompressed(metadata map[string]string) bool {
+	return metadataValue(metadata, MetadataCompression) != ""
+}
+
+// MatchesTransforms reports whether metadata describes a chunk that was
+// compressed with compression and encrypted with a key of keys, as
+// ReadHashAndUpload would store it with WithCompression and WithEncryption. A
+// nil compression or keys means that the chunk must not be compressed or
+// encrypted.
+func MatchesTransforms(metadata map[string]string, compression *Compression, keys KeyProvider) bool {
+	if IsCompressed(metadata) != (compression != nil) || IsEncrypted(metadata) != (keys != nil) {
+		return false
+	}
+	if compression != nil && !strings.EqualFold(metadataValue(metadata, MetadataCompression), compression.Name) {
+		return false
+	}
+	if keys != nil {
+		if metadataValue(metadata, MetadataEncryption) != EncryptionAlgorithm {
+			return false
+		}
+		if _, err := keys.Key(metadataValue(metadata, MetadataKeyID)); err != nil {
+			return false
+		}
+	}
+	return true
+}
+
+// NewDecompressor returns a reader of the decompressed data of the compressed
+// chunk read from r, whose object metadata is metadata. Encrypted chunks must
+// be decrypted with NewDecrypter first. If the metadata does not describe a
+// compressed chunk, r is returned unchanged. The decompressor must be closed
+// to release its resources.
+func NewDecompressor(r io.Reader, metadata map[string]string) (io.ReadCloser, error) {
+	if !IsCompressed(metadata) {
+		return ioutil.NopCloser(r), nil
+	}
+	name := metadataValue(metadata, MetadataCompression)
+	compression, ok := LookupCompression(name)
+	if !ok {
+		return nil, fmt.Errorf("Unsupported compression %s", name)
+	}
+	return compression.NewReader(r)
+}
+
+// storedWriter turns the data of a chunk written to it into the data that is
+// stored, by compressing and then encrypting it as configured, and writes that
+// to out. It hashes and counts the stored data. It must be closed to flush the
+// compression and encryption, which does not close out.
+type storedWriter struct {
+	head       io.Writer
+	compressor io.WriteCloser
+	sealer     *encrypter
+	tail       *countingWriter
+}
+
+func newStoredWriter(out io.Writer, compression *Compression, encrypted *encryption) (*storedWriter, error) {
+	s := &storedWriter{tail: &countingWriter{w: out, md5: md5.New()}}
+	s.head = s.tail
+	if encrypted != nil {
+		s.sealer = encrypted.writer(s.head)
+		s.head = s.sealer
+	}
+	if compression != nil {
+		compressor, err := compression.NewWriter(s.head)
+		if err != nil {
+			return nil, err
+		}
+		s.compressor = compressor
+		s.head = compressor
+	}
+	return s, nil
+}
+
+func (s *storedWriter) Write(p []byte) (int, error) {
+	return s.head.Write(p)
+}
+
+// Close flushes the compressor and seals the final frame of encryption.
+func (s *storedWriter) Close() error {
+	if s.compressor != nil {
+		if err := s.compressor.Close(); err != nil {
+			return err
+		}
+	}
+	if s.sealer != nil {
+		return s.sealer.Close()
+	}
+	return nil
+}
+
+// etag returns the hex-encoded MD5 sum of the stored data.
+func (s *storedWriter) etag() string {
+	return hex.EncodeToString(s.tail.md5.Sum(nil))
+}
+
+// size returns the number of bytes of stored data.
+func (s *storedWriter) size() uint {
+	return s.tail.size
+}
+
+// countingWriter hashes and counts the data that it writes to w.
+type countingWriter struct {
+	w    io.Writer
+	md5  hash.Hash
+	size uint
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.md5.Write(p[:n])
+	c.size += uint(n)
+	return n, err
+}
+
+// SeekEntry locates the data of one chunk in the source file and in the large
+// object that was uploaded from it.
+type SeekEntry struct {
+	Container    string
+	Object       string
+	Offset       uint // Offset of the chunk in the source
+	Size         uint // Size of the chunk in the source
+	StoredOffset uint // Offset of the chunk's segment in the large object
+	StoredSize   uint // Size of the chunk's segment in object storage
+}
+
+// SeekIndex maps the offsets of a source file to the segments of the large
+// object uploaded from it, so that any part of the file can be read without
+// downloading the segments before it. Its entries are sorted by Offset.
+type SeekIndex []SeekEntry
+
+// NewSeekIndex builds the SeekIndex of the uploaded chunks of a file, such as
+// those that leave ReadHashAndUpload. The chunks may be in any order.
+func NewSeekIndex(chunks []FileChunk) SeekIndex {
+	sorted := append([]FileChunk(nil), chunks...)
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].Offset < sorted[j].Offset
+	})
+	index := make(SeekIndex, 0, len(sorted))
+	var stored uint
+	for _, chunk := range sorted {
+		size := chunk.Size
+		if chunk.SourceSize != 0 {
+			size = chunk.SourceSize
+		}
+		index = append(index, SeekEntry{
+			Container:    chunk.Container,
+			Object:       chunk.Object,
+			Offset:       chunk.Offset,
+			Size:         size,
+			StoredOffset: stored,
+			StoredSize:   chunk.Size,
+		})
+		stored += chunk.Size
+	}
+	return index
+}
+
+// Find returns the entry whose chunk contains the byte of the source at offset.
+func (s SeekIndex) Find(offset uint) (SeekEntry, bool) {
+	i := sort.Search(len(s), func(i int) bool {
+		return s[i].Offset+s[i].Size > offset
+	})
+	if i == len(s) || s[i].Offset > offset {
+		return SeekEntry{}, false
+	}
+	return s[i], true
+}
+
+// SegmentOpener opens the segment of entry for reading, returning its stored
+// data and its object metadata. Encrypted segments must be decrypted by the
+// SegmentOpener, for instance with NewDecrypter.
+type SegmentOpener func(entry SeekEntry) (body io.ReadCloser, metadata map[string]string, err error)
+
+// NewIndexedReader returns an io.ReaderAt of the source file described by
+// index. Each read opens the segments that hold the requested range with open
+// and decompresses them if needed, skipping the data before the range within
+// the first of them.
+func NewIndexedReader(index SeekIndex, open SegmentOpener) io.ReaderAt {
+	return &indexedReader{index: index, open: open}
+}
+
+type indexedReader struct {
+	index SeekIndex
+	open  SegmentOpener
+}
+
+func (r *indexedReader) ReadAt(p []byte, off int64) (int, error) {
+	if off < 0 {
+		return 0, fmt.Errorf("Negative offset %d", off)
+	}
+	read := 0
+	for read < len(p) {
+		offset := uint(off) + uint(read)
+		entry, ok := r.index.Find(offset)
+		if !ok {
+			return read, io.EOF
+		}
+		n, err := r.readEntry(entry, p[read:], offset-entry.Offset)
+		read += n
+		if err != nil {
+			return read, err
+		}
+	}
+	return read, nil
+}
+
+// readEntry reads the data of entry from skip bytes into its chunk into p, until
+// p is full or the chunk ends.
+func (r *indexedReader) readEntry(entry SeekEntry, p []byte, skip uint) (int, error) {
+	body, metadata, err := r.open(entry)
+	if err != nil {
+		return 0, err
+	}
+	defer body.Close()
+	data, err := NewDecompressor(body, metadata)
+	if err != nil {
+		return 0, err
+	}
+	defer data.Close()
+	if _, err = io.CopyN(ioutil.Discard, data, int64(skip)); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return 0, err
+	}
+	return io.ReadFull(data, p[:min(uint(len(p)), entry.Size-skip)])
+}
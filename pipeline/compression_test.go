@@ -0,0 +1,145 @@
+package pipeline_test
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/ibmjstart/swiftlygo/auth/mock"
+	"github.com/mattetti/filebuffer"
+	"io"
+	"io/ioutil"
+	"strconv"
+	"strings"
+
+	. "github.com/ibmjstart/swiftlygo/pipeline"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Compression", func() {
+	var (
+		data []byte
+		dest *mock.BufferDestination
+		errs chan error
+	)
+
+	BeforeEach(func() {
+		var lines strings.Builder
+		for i := 0; i < 2000; i++ {
+			fmt.Fprintf(&lines, "line %d of a log that compresses well\n", i)
+		}
+		data = []byte(lines.String())
+		dest = mock.NewBufferDestination()
+		errs = make(chan error, 10)
+	})
+
+	// upload sends the data in chunks of size bytes through one uploader, so
+	// that the destination holds the segments in order
+	upload := func(size uint, opts ...Option) []FileChunk {
+		count := (uint(len(data)) + size - 1) / size
+		chunks := make(chan FileChunk, count)
+		for i := uint(0); i < count; i++ {
+			chunk := FileChunk{Number: i, Offset: i * size, Size: size, Object: fmt.Sprintf("object-%d", i), Container: "container"}
+			if chunk.Offset+chunk.Size > uint(len(data)) {
+				chunk.Size = uint(len(data)) - chunk.Offset
+			}
+			chunks <- chunk
+		}
+		close(chunks)
+		var uploaded []FileChunk
+		for chunk := range ReadHashAndUpload(chunks, errs, filebuffer.New(data), dest, opts...) {
+			uploaded = append(uploaded, chunk)
+		}
+		Expect(errs).To(BeEmpty())
+		Expect(uploaded).To(HaveLen(int(count)))
+		return uploaded
+	}
+
+	// decompress reads back the data of the single chunk in the destination
+	decompress := func() []byte {
+		reader, err := NewDecompressor(bytes.NewReader(dest.FileContent.Contents.Bytes()), dest.Metadata["container/object-0"])
+		Expect(err).ShouldNot(HaveOccurred())
+		defer reader.Close()
+		decompressed, err := ioutil.ReadAll(reader)
+		Expect(err).ShouldNot(HaveOccurred())
+		return decompressed
+	}
+
+	for _, compression := range []Compression{Gzip, Zstd} {
+		compression := compression
+		Context("With "+compression.Name, func() {
+			It("Should store each chunk compressed with its original location", func() {
+				chunk := upload(uint(len(data)), WithCompression(compression))[0]
+				Expect(chunk.SourceSize).To(Equal(uint(len(data))))
+				Expect(chunk.Size).To(BeNumerically("<", len(data)/4))
+				Expect(dest.FileContent.Contents.Len()).To(Equal(int(chunk.Size)))
+				Expect(dest.Metadata["container/object-0"]).To(Equal(map[string]string{
+					MetadataCompression:    compression.Name,
+					MetadataOriginalOffset: "0",
+					MetadataOriginalSize:   strconv.Itoa(len(data)),
+				}))
+				Expect(decompress()).To(Equal(data))
+			})
+			It("Should send the Etag of the compressed data if it is precomputed", func() {
+				// The destination rejects data that does not match the Etag sent
+				upload(uint(len(data)), WithCompression(compression), WithPrecomputedEtags())
+				Expect(decompress()).To(Equal(data))
+			})
+		})
+	}
+
+	It("Should compress chunks before encrypting them", func() {
+		keys := NewStaticKey(bytes.Repeat([]byte{1}, 32))
+		chunk := upload(uint(len(data)), WithCompression(Zstd), WithEncryption(keys))[0]
+		Expect(chunk.Size).To(BeNumerically("<", len(data)/4))
+		metadata := dest.Metadata["container/object-0"]
+		plaintext, err := NewDecrypter(bytes.NewReader(dest.FileContent.Contents.Bytes()), metadata, keys)
+		Expect(err).ShouldNot(HaveOccurred())
+		reader, err := NewDecompressor(plaintext, metadata)
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(ioutil.ReadAll(reader)).To(Equal(data))
+	})
+	It("Should find and read any part of the data with a SeekIndex", func() {
+		chunks := upload(10000, WithCompression(Gzip))
+		index := NewSeekIndex(chunks)
+		Expect(index).To(HaveLen(len(chunks)))
+		entry, ok := index.Find(25000)
+		Expect(ok).To(BeTrue())
+		Expect(entry.Object).To(Equal("object-2"))
+		Expect(entry.Offset).To(Equal(uint(20000)))
+		_, ok = index.Find(uint(len(data)))
+		Expect(ok).To(BeFalse())
+
+		stored := dest.FileContent.Contents.Bytes()
+		opened := 0
+		reader := NewIndexedReader(index, func(entry SeekEntry) (io.ReadCloser, map[string]string, error) {
+			opened++
+			segment := stored[entry.StoredOffset : entry.StoredOffset+entry.StoredSize]
+			return ioutil.NopCloser(bytes.NewReader(segment)), dest.Metadata[entry.Container+"/"+entry.Object], nil
+		})
+		part := make([]byte, 15000)
+		n, err := reader.ReadAt(part, 19000)
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(n).To(Equal(len(part)))
+		Expect(part).To(Equal(data[19000:34000]))
+		Expect(opened).To(Equal(3))
+
+		n, err = reader.ReadAt(part, int64(len(data)-100))
+		Expect(err).To(Equal(io.EOF))
+		Expect(part[:n]).To(Equal(data[len(data)-100:]))
+	})
+	It("Should mark manifests as compressed", func() {
+		manifests := make(chan FileChunk, 1)
+		manifests <- FileChunk{Object: "manifest", Container: "container", Data: []byte("[]")}
+		close(manifests)
+		for range UploadManifests(manifests, errs, dest, WithCompression(Gzip)) {
+		}
+		Expect(dest.Metadata["container/manifest"]).To(Equal(map[string]string{MetadataCompression: "gzip"}))
+	})
+	It("Should find compression algorithms by name", func() {
+		compression, ok := LookupCompression("ZSTD")
+		Expect(ok).To(BeTrue())
+		Expect(compression.Name).To(Equal("zstd"))
+		_, ok = LookupCompression("lz4")
+		Expect(ok).To(BeFalse())
+	})
+})
@@ -0,0 +1,143 @@
+package pipeline
+
+import (
+	"sync"
+	"time"
+)
+
+// LatencySpikeFactor is how many times longer than the average successful
+// attempt an attempt must take for AdaptiveConcurrency to treat it as a sign
+// of congestion.
+var LatencySpikeFactor float64 = 3
+
+// AdaptiveConcurrency limits how many chunks upload at once, and adjusts the
+// limit with an additive-increase/multiplicative-decrease (AIMD) algorithm.
+// The limit starts at the minimum. Each time as many attempts succeed as the
+// limit allows, the throughput of those attempts is compared with that of the
+// previous set, and the limit rises by one if it improved. When an attempt
+// fails or takes LatencySpikeFactor times longer than average, the limit is
+// halved. Attempts that began before the last decrease do not cause another
+// one, so a burst of failures halves the limit only once.
+//
+// One AdaptiveConcurrency should be shared by all of the ReadHashAndUpload
+// stages of an upload. It is safe for concurrent use, and a nil
+// AdaptiveConcurrency imposes no limit.
+type AdaptiveConcurrency struct {
+	lock      sync.Mutex
+	available *sync.Cond
+	observers Observers
+	min, max  uint
+	limit     uint
+	active    uint
+	latency   time.Duration // moving average of successful attempts
+	decreased time.Time
+	// the attempts that have succeeded since the limit last changed
+	windowStarted  time.Time
+	windowBytes    uint
+	windowAttempts uint
+	throughput     float64 // of the previous window, in bytes per second
+}
+
+// NewAdaptiveConcurrency creates an AdaptiveConcurrency that keeps its limit
+// between min and max, which are raised to at least 1. Each time the limit
+// changes, a ConcurrencyChanged Event is sent to the observers.
+func NewAdaptiveConcurrency(min, max uint, observers ...Observer) *AdaptiveConcurrency {
+	if min < 1 {
+		min = 1
+	}
+	if max < min {
+		max = min
+	}
+	c := &AdaptiveConcurrency{
+		observers:     observers,
+		min:           min,
+		max:           max,
+		limit:         min,
+		windowStarted: time.Now(),
+	}
+	c.available = sync.NewCond(&c.lock)
+	return c
+}
+
+// Limit returns the number of attempts that may currently run at once.
+func (c *AdaptiveConcurrency) Limit() uint {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return c.limit
+}
+
+// Acquire blocks until another attempt may begin. Each call must be followed
+// by a call to Release.
+func (c *AdaptiveConcurrency) Acquire() {
+	if c == nil {
+		return
+	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	for c.active >= c.limit {
+		c.available.Wait()
+	}
+	c.active++
+}
+
+// Release ends an attempt that took duration and uploaded bytes if err is nil,
+// and adjusts the limit based upon its outcome.
+func (c *AdaptiveConcurrency) Release(bytes uint, duration time.Duration, err error) {
+	if c == nil {
+		return
+	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	defer c.available.Broadcast()
+	c.active--
+	now := time.Now()
+	spike := c.latency > 0 && float64(duration) > LatencySpikeFactor*float64(c.latency)
+	if err != nil || spike {
+		// Attempts that began before the last decrease ran at a higher limit
+		if now.Add(-duration).After(c.decreased) {
+			c.decreased = now
+			c.throughput = 0
+			c.setLimit(c.limit / 2)
+		}
+		return
+	}
+	if c.latency == 0 {
+		c.latency = duration
+	} else {
+		c.latency += (duration - c.latency) / 5
+	}
+	c.windowBytes += bytes
+	c.windowAttempts++
+	if c.windowAttempts < c.limit {
+		return
+	}
+	throughput := float64(c.windowBytes) / now.Sub(c.windowStarted).Seconds()
+	improved := throughput > c.throughput
+	c.throughput = throughput
+	if improved && c.limit < c.max {
+		c.setLimit(c.limit + 1)
+	} else {
+		c.resetWindow()
+	}
+}
+
+// setLimit changes the limit, within the bounds, and begins a new window. The
+// lock must be held.
+func (c *AdaptiveConcurrency) setLimit(limit uint) {
+	if limit < c.min {
+		limit = c.min
+	} else if limit > c.max {
+		limit = c.max
+	}
+	c.resetWindow()
+	if limit != c.limit {
+		c.limit = limit
+		c.observers.OnEvent(ConcurrencyChanged{Limit: limit})
+	}
+}
+
+// resetWindow begins measuring throughput again. The lock must be held.
+func (c *AdaptiveConcurrency) resetWindow() {
+	c.windowStarted = time.Now()
+	c.windowBytes, c.windowAttempts = 0, 0
+}
@@ -0,0 +1,130 @@
+package pipeline_test
+
+import (
+	"fmt"
+	"github.com/ibmjstart/swiftlygo/auth"
+	"github.com/ibmjstart/swiftlygo/auth/mock"
+	"github.com/mattetti/filebuffer"
+	"time"
+
+	. "github.com/ibmjstart/swiftlygo/pipeline"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("AdaptiveConcurrency", func() {
+	var (
+		recorder    *eventRecorder
+		concurrency *AdaptiveConcurrency
+	)
+
+	// succeed runs count attempts at once that each upload bytes in duration.
+	succeed := func(count, bytes uint, duration time.Duration) {
+		for i := uint(0); i < count; i++ {
+			concurrency.Acquire()
+		}
+		time.Sleep(duration)
+		for i := uint(0); i < count; i++ {
+			concurrency.Release(bytes, duration, nil)
+		}
+	}
+
+	BeforeEach(func() {
+		recorder = &eventRecorder{}
+		concurrency = NewAdaptiveConcurrency(1, 4, recorder)
+	})
+
+	Context("When it is created", func() {
+		It("Should start at the minimum", func() {
+			Expect(concurrency.Limit()).To(Equal(uint(1)))
+			Expect(NewAdaptiveConcurrency(0, 0).Limit()).To(Equal(uint(1)))
+		})
+		It("Should block attempts beyond the limit", func() {
+			concurrency.Acquire()
+			acquired := make(chan struct{})
+			go func() {
+				concurrency.Acquire()
+				close(acquired)
+			}()
+			Consistently(acquired, 50*time.Millisecond).ShouldNot(BeClosed())
+			concurrency.Release(0, time.Millisecond, fmt.Errorf("failed"))
+			Eventually(acquired).Should(BeClosed())
+		})
+	})
+	Context("When throughput improves", func() {
+		It("Should add one upload at a time up to the maximum", func() {
+			succeed(1, 1000, 10*time.Millisecond)
+			Expect(concurrency.Limit()).To(Equal(uint(2)))
+			succeed(2, 1000, 5*time.Millisecond)
+			Expect(concurrency.Limit()).To(Equal(uint(3)))
+			succeed(3, 2000, time.Millisecond)
+			succeed(4, 4000, time.Millisecond)
+			Expect(concurrency.Limit()).To(Equal(uint(4)))
+			Expect(recorder.events).To(Equal([]Event{
+				ConcurrencyChanged{Limit: 2},
+				ConcurrencyChanged{Limit: 3},
+				ConcurrencyChanged{Limit: 4},
+			}))
+		})
+	})
+	Context("When throughput does not improve", func() {
+		It("Should keep the limit", func() {
+			succeed(1, 1000, time.Millisecond)
+			Expect(concurrency.Limit()).To(Equal(uint(2)))
+			succeed(2, 1, 2*time.Millisecond)
+			Expect(concurrency.Limit()).To(Equal(uint(2)))
+		})
+	})
+	Context("When uploads fail", func() {
+		BeforeEach(func() {
+			succeed(1, 1000, 10*time.Millisecond)
+			succeed(2, 1000, 5*time.Millisecond)
+			succeed(3, 2000, time.Millisecond)
+			Expect(concurrency.Limit()).To(Equal(uint(4)))
+		})
+		It("Should halve the limit once for attempts that ran at the same time", func() {
+			for i := 0; i < 4; i++ {
+				concurrency.Acquire()
+			}
+			time.Sleep(10 * time.Millisecond)
+			for i := 0; i < 4; i++ {
+				concurrency.Release(0, 10*time.Millisecond, fmt.Errorf("503"))
+			}
+			Expect(concurrency.Limit()).To(Equal(uint(2)))
+			concurrency.Acquire()
+			concurrency.Release(0, 0, fmt.Errorf("503"))
+			Expect(concurrency.Limit()).To(Equal(uint(1)))
+			concurrency.Acquire()
+			concurrency.Release(0, 0, fmt.Errorf("503"))
+			Expect(concurrency.Limit()).To(Equal(uint(1)))
+		})
+		It("Should halve the limit when latency spikes", func() {
+			concurrency.Acquire()
+			time.Sleep(20 * time.Millisecond)
+			concurrency.Release(1000, time.Second, nil)
+			Expect(concurrency.Limit()).To(Equal(uint(2)))
+		})
+	})
+	Context("When uploading", func() {
+		It("Should learn from the outcome of each attempt", func() {
+			maxAttempts, baseWait := UploadMaxAttempts, UploadRetryBaseWait
+			UploadMaxAttempts, UploadRetryBaseWait = 0, 0
+			defer func() {
+				UploadMaxAttempts, UploadRetryBaseWait = maxAttempts, baseWait
+			}()
+			errs := make(chan error, 10)
+			source := filebuffer.New([]byte("0123456789"))
+			upload := func(dest auth.Destination) {
+				chunks := make(chan FileChunk, 1)
+				chunks <- FileChunk{Number: 0, Size: 10, Object: "object", Container: "container"}
+				close(chunks)
+				for range ReadHashAndUpload(chunks, errs, source, dest, WithAdaptiveConcurrency(concurrency)) {
+				}
+			}
+			upload(mock.NewBufferDestination())
+			Expect(concurrency.Limit()).To(Equal(uint(2)))
+			upload(mock.NewErrorDestination())
+			Expect(concurrency.Limit()).To(Equal(uint(1)))
+		})
+	})
+})
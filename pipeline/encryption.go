@@ -0,0 +1,306 @@
+package pipeline
+
+import (
+	"bufio"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// EncryptionFrameSize is the amount of a chunk that is sealed at a time when
+// chunks are encrypted, so that chunks can be encrypted and decrypted as they
+// stream. Each frame of ciphertext is EncryptionOverhead bytes longer than
+// its plaintext.
+const EncryptionFrameSize = 64 * 1024
+
+// EncryptionOverhead is the size of the authentication tag of each frame.
+const EncryptionOverhead = 16
+
+// EncryptionAlgorithm is the value of the MetadataEncryption metadata of
+// encrypted chunks.
+const EncryptionAlgorithm = "AES-256-GCM"
+
+// The keys of the object metadata of encrypted chunks.
+const (
+	MetadataEncryption = "Crypt-Algorithm"
+	MetadataKeyID      = "Crypt-Key-Id"
+	MetadataNonce      = "Crypt-Nonce"
+	MetadataFrameSize  = "Crypt-Frame-Size"
+)
+
+// KeyProvider supplies the 32-byte AES-256 keys that encrypt and decrypt
+// chunks. It must be safe for concurrent use.
+type KeyProvider interface {
+	// CurrentKey returns the key with which to encrypt new chunks and its ID,
+	// which is stored with each chunk.
+	CurrentKey() (id string, key []byte, err error)
+	// Key returns the key with the given ID, to decrypt chunks that were
+	// encrypted with it.
+	Key(id string) ([]byte, error)
+}
+
+// StaticKey is a KeyProvider with a single key.
+type StaticKey struct {
+	KeyID  string
+	Secret []byte
+}
+
+// NewStaticKey returns a StaticKey whose ID is derived from the SHA-256 digest
+// of secret, so that a wrong key is recognised before decryption is tried.
+func NewStaticKey(secret []byte) StaticKey {
+	sum := sha256.Sum256(secret)
+	return StaticKey{KeyID: hex.EncodeToString(sum[:8]), Secret: secret}
+}
+
+// CurrentKey returns the key and its ID.
+func (s StaticKey) CurrentKey() (string, []byte, error) {
+	return s.KeyID, s.Secret, nil
+}
+
+// Key returns the key if id is its ID.
+func (s StaticKey) Key(id string) ([]byte, error) {
+	if id != s.KeyID {
+		return nil, fmt.Errorf("Unknown encryption key %s", id)
+	}
+	return s.Secret, nil
+}
+
+// EncryptedSize returns the size of a chunk of size bytes once it is encrypted.
+func EncryptedSize(size uint) uint {
+	frames := (size + EncryptionFrameSize - 1) / EncryptionFrameSize
+	return size + frames*EncryptionOverhead
+}
+
+// encryption holds the key and nonce of one attempt to upload a chunk. Every
+// attempt uses a new random nonce, so that a nonce is never reused even if the
+// data changes between attempts.
+type encryption struct {
+	aead     cipher.AEAD
+	nonce    []byte
+	metadata map[string]string
+}
+
+func newEncryption(keys KeyProvider) (*encryption, error) {
+	id, key, err := keys.CurrentKey()
+	if err != nil {
+		return nil, err
+	}
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err = rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return &encryption{
+		aead:  aead,
+		nonce: nonce,
+		metadata: map[string]string{
+			MetadataEncryption: EncryptionAlgorithm,
+			MetadataKeyID:      id,
+			MetadataNonce:      hex.EncodeToString(nonce),
+			MetadataFrameSize:  strconv.Itoa(EncryptionFrameSize),
+		},
+	}, nil
+}
+
+// newAEAD returns AES-256-GCM with key.
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	if len(key) != 32 {
+		return nil, fmt.Errorf("Encryption key is %d bytes long, AES-256 needs 32", len(key))
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// frameNonce returns the nonce of a frame, which is the chunk's nonce with the
+// frame's number mixed into its last 8 bytes.
+func frameNonce(nonce []byte, frame uint64) []byte {
+	result := append([]byte(nil), nonce...)
+	tail := result[len(result)-8:]
+	binary.BigEndian.PutUint64(tail, binary.BigEndian.Uint64(tail)^frame)
+	return result
+}
+
+// frameData returns the additional data that authenticates the position of a
+// frame, so that frames cannot be reordered or the chunk truncated.
+func frameData(frame uint64, final bool) []byte {
+	data := make([]byte, 9)
+	binary.BigEndian.PutUint64(data, frame)
+	if final {
+		data[8] = 1
+	}
+	return data
+}
+
+// encrypter seals the data written to it a frame at a time and writes the
+// ciphertext to w. It must be closed to seal the final frame.
+type encrypter struct {
+	w      io.Writer
+	aead   cipher.AEAD
+	nonce  []byte
+	frame  []byte
+	sealed []byte
+	count  uint64
+}
+
+// writer returns an encrypter that writes to w.
+func (e *encryption) writer(w io.Writer) *encrypter {
+	return &encrypter{
+		w:      w,
+		aead:   e.aead,
+		nonce:  e.nonce,
+		frame:  make([]byte, 0, EncryptionFrameSize),
+		sealed: make([]byte, 0, EncryptionFrameSize+EncryptionOverhead),
+	}
+}
+
+// Write encrypts p. A full frame is only sealed once more data arrives, since
+// the final frame is sealed differently.
+func (e *encrypter) Write(p []byte) (int, error) {
+	written := 0
+	for len(p) > 0 {
+		if len(e.frame) == EncryptionFrameSize {
+			if err := e.seal(false); err != nil {
+				return written, err
+			}
+		}
+		n := copy(e.frame[len(e.frame):cap(e.frame)], p)
+		e.frame = e.frame[:len(e.frame)+n]
+		p = p[n:]
+		written += n
+	}
+	return written, nil
+}
+
+// Close seals the final frame. It does not close w.
+func (e *encrypter) Close() error {
+	return e.seal(true)
+}
+
+// seal encrypts the current frame and writes it.
+func (e *encrypter) seal(final bool) error {
+	e.sealed = e.aead.Seal(e.sealed[:0], frameNonce(e.nonce, e.count), e.frame, frameData(e.count, final))
+	e.count++
+	e.frame = e.frame[:0]
+	_, err := e.w.Write(e.sealed)
+	return err
+}
+
+// ErrDecryption is returned when an encrypted chunk cannot be decrypted because
+// it was altered or the key is wrong.
+var ErrDecryption = errors.New("Unable to decrypt: the data was altered or the key is wrong")
+
+// metadataValue looks up key in metadata regardless of case, since object
+// storage may change it.
+func metadataValue(metadata map[string]string, key string) string {
+	for k, v := range metadata {
+		if strings.EqualFold(k, key) {
+			return v
+		}
+	}
+	return ""
+}
+
+// IsEncrypted reports whether metadata describes a chunk that was encrypted by
+// ReadHashAndUpload.
+func IsEncrypted(metadata map[string]string) bool {
+	return metadataValue(metadata, MetadataEncryption) != ""
+}
+
+// NewDecrypter returns a reader of the plaintext of the encrypted chunk read
+// from r, whose object metadata is metadata. The key is found with keys. If the
+// metadata does not describe an encrypted chunk, r is returned unchanged.
+func NewDecrypter(r io.Reader, metadata map[string]string, keys KeyProvider) (io.Reader, error) {
+	if !IsEncrypted(metadata) {
+		return r, nil
+	}
+	if algorithm := metadataValue(metadata, MetadataEncryption); algorithm != EncryptionAlgorithm {
+		return nil, fmt.Errorf("Unsupported encryption %s", algorithm)
+	}
+	frameSize, err := strconv.Atoi(metadataValue(metadata, MetadataFrameSize))
+	if err != nil || frameSize < 1 {
+		return nil, fmt.Errorf("Invalid encryption frame size %q", metadataValue(metadata, MetadataFrameSize))
+	}
+	key, err := keys.Key(metadataValue(metadata, MetadataKeyID))
+	if err != nil {
+		return nil, err
+	}
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+	nonce, err := hex.DecodeString(metadataValue(metadata, MetadataNonce))
+	if err != nil || len(nonce) != aead.NonceSize() {
+		return nil, fmt.Errorf("Invalid encryption nonce %q", metadataValue(metadata, MetadataNonce))
+	}
+	return &decrypter{
+		r:      bufio.NewReader(r),
+		aead:   aead,
+		nonce:  nonce,
+		sealed: make([]byte, frameSize+EncryptionOverhead),
+	}, nil
+}
+
+// decrypter opens the frames read from r.
+type decrypter struct {
+	r      *bufio.Reader
+	aead   cipher.AEAD
+	nonce  []byte
+	sealed []byte
+	plain  []byte
+	count  uint64
+	done   bool
+	err    error
+}
+
+func (d *decrypter) Read(p []byte) (int, error) {
+	for len(d.plain) == 0 {
+		if d.err != nil {
+			return 0, d.err
+		}
+		if d.done {
+			return 0, io.EOF
+		}
+		d.err = d.open()
+	}
+	n := copy(p, d.plain)
+	d.plain = d.plain[n:]
+	return n, nil
+}
+
+// open reads and decrypts the next frame. A frame is final if it is shorter
+// than a full frame or nothing follows it.
+func (d *decrypter) open() error {
+	n, err := io.ReadFull(d.r, d.sealed)
+	final := err == io.ErrUnexpectedEOF
+	if err == nil {
+		_, peekErr := d.r.Peek(1)
+		final = peekErr == io.EOF
+	} else if err == io.EOF {
+		// The final frame was missing
+		return ErrDecryption
+	} else if !final {
+		return err
+	}
+	plain, err := d.aead.Open(d.sealed[:0], frameNonce(d.nonce, d.count), d.sealed[:n], frameData(d.count, final))
+	if err != nil {
+		return ErrDecryption
+	}
+	d.count++
+	d.plain = plain
+	d.done = final
+	return nil
+}
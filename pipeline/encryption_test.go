@@ -0,0 +1,102 @@
+package pipeline_test
+
+import (
+	"bytes"
+	"errors"
+	"github.com/ibmjstart/swiftlygo/auth/mock"
+	"github.com/mattetti/filebuffer"
+	"io/ioutil"
+	"math/rand"
+
+	. "github.com/ibmjstart/swiftlygo/pipeline"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Encryption", func() {
+	var (
+		data   []byte
+		keys   StaticKey
+		chunks chan FileChunk
+		errs   chan error
+	)
+
+	BeforeEach(func() {
+		// Two and a half frames, so that the final frame is short
+		data = make([]byte, EncryptionFrameSize*5/2)
+		rand.Read(data)
+		secret := make([]byte, 32)
+		rand.Read(secret)
+		keys = NewStaticKey(secret)
+		chunks = make(chan FileChunk, 1)
+		chunks <- FileChunk{Number: 0, Size: uint(len(data)), Object: "object", Container: "container"}
+		close(chunks)
+		errs = make(chan error, 10)
+	})
+
+	// upload encrypts the chunk into a BufferDestination
+	upload := func(opts ...Option) (FileChunk, *mock.BufferDestination) {
+		dest := mock.NewBufferDestination()
+		chunk := <-ReadHashAndUpload(chunks, errs, filebuffer.New(data), dest, append(opts, WithEncryption(keys))...)
+		Expect(errs).To(BeEmpty())
+		return chunk, dest
+	}
+
+	Context("When the destination stores metadata", func() {
+		It("Should store ciphertext that decrypts to the data", func() {
+			chunk, dest := upload()
+			ciphertext := dest.FileContent.Contents.Bytes()
+			Expect(chunk.Size).To(Equal(EncryptedSize(uint(len(data)))))
+			Expect(ciphertext).To(HaveLen(int(chunk.Size)))
+			Expect(bytes.Contains(ciphertext, data[:64])).To(BeFalse())
+
+			metadata := dest.Metadata["container/object"]
+			Expect(IsEncrypted(metadata)).To(BeTrue())
+			plaintext, err := NewDecrypter(bytes.NewReader(ciphertext), metadata, keys)
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(ioutil.ReadAll(plaintext)).To(Equal(data))
+		})
+		It("Should checksum the plaintext and send the Etag of the ciphertext", func() {
+			chunk, dest := upload(WithChecksums(SHA256), WithPrecomputedEtags())
+			metadata := dest.Metadata["container/object"]
+			Expect(IsEncrypted(metadata)).To(BeTrue())
+			sums, err := ComputeChecksums(bytes.NewReader(data), SHA256)
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(chunk.Checksums).To(Equal(sums))
+			Expect(MetadataChecksums(metadata)).To(Equal(sums))
+		})
+		It("Should detect altered or truncated ciphertext", func() {
+			_, dest := upload()
+			ciphertext := dest.FileContent.Contents.Bytes()
+			metadata := dest.Metadata["container/object"]
+			for _, altered := range [][]byte{
+				append(append([]byte(nil), ciphertext[:100]...), append([]byte{ciphertext[100] ^ 1}, ciphertext[101:]...)...),
+				ciphertext[:EncryptionFrameSize+EncryptionOverhead],
+			} {
+				plaintext, err := NewDecrypter(bytes.NewReader(altered), metadata, keys)
+				Expect(err).ShouldNot(HaveOccurred())
+				_, err = ioutil.ReadAll(plaintext)
+				Expect(err).To(Equal(ErrDecryption))
+			}
+		})
+		It("Should refuse to decrypt with a different key", func() {
+			_, dest := upload()
+			_, err := NewDecrypter(bytes.NewReader(dest.FileContent.Contents.Bytes()), dest.Metadata["container/object"], NewStaticKey(make([]byte, 32)))
+			Expect(err).Should(HaveOccurred())
+		})
+	})
+	Context("When the destination cannot store metadata", func() {
+		It("Should not upload the chunk", func() {
+			for range ReadHashAndUpload(chunks, errs, filebuffer.New(data), mock.NewNullDestination(), WithEncryption(keys)) {
+				Fail("A chunk was uploaded without encryption")
+			}
+			var invalid *InvalidChunkError
+			Expect(errors.As(<-errs, &invalid)).To(BeTrue())
+		})
+	})
+	It("Should pass through data that is not encrypted", func() {
+		plaintext, err := NewDecrypter(bytes.NewReader(data), nil, keys)
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(ioutil.ReadAll(plaintext)).To(Equal(data))
+	})
+})
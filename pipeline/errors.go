@@ -0,0 +1,64 @@
+package pipeline
+
+import (
+	"fmt"
+)
+
+// ChunkUploadError reports a chunk that could not be uploaded. Attempt is the
+// last attempt made, counting from 1, and Err is the reason that it failed. Use errors.As to find an *auth.HTTPStatusError within Err when deciding
+// whether a failure is worth retrying.
+type ChunkUploadError struct {
+	Number  uint
+	Object  string
+	Attempt uint
+	Err     error
+}
+
+func (e *ChunkUploadError) Error() string {
+	return fmt.Sprintf("Attempt %d to upload chunk %d (%s) failed: %s", e.Attempt, e.Number, e.Object, e.Err)
+}
+
+func (e *ChunkUploadError) Unwrap() error {
+	return e.Err
+}
+
+// InvalidChunkError reports that a stage received a chunk that lacks the
+// properties that it needs.
+type InvalidChunkError struct {
+	Stage  string
+	Number uint
+	Reason string
+}
+
+func (e *InvalidChunkError) Error() string {
+	return fmt.Sprintf("%s encountered chunk %d %s", e.Stage, e.Number, e.Reason)
+}
+
+// ManifestUploadError reports that uploading an SLO manifest failed.
+type ManifestUploadError struct {
+	Number uint
+	Object string
+	Err    error
+}
+
+func (e *ManifestUploadError) Error() string {
+	return fmt.Sprintf("Problem uploading manifest file %s: %s", e.Object, e.Err)
+}
+
+func (e *ManifestUploadError) Unwrap() error {
+	return e.Err
+}
+
+// EtagMismatchError reports that the Etag that object storage returned for a
+// chunk is not the MD5 sum of the data that was read for it, so the data was
+// corrupted in transit. When the Etag was sent with the upload, Expected is the
+// sum computed before the upload and Actual is the sum of the data sent.
+type EtagMismatchError struct {
+	Object   string
+	Expected string
+	Actual   string
+}
+
+func (e *EtagMismatchError) Error() string {
+	return fmt.Sprintf("Etag of %s is %s, expected %s", e.Object, e.Actual, e.Expected)
+}
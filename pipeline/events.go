@@ -0,0 +1,150 @@
+package pipeline
+
+import (
+	"time"
+)
+
+// Event is implemented by each of the notifications that an upload sends to
+// its Observers: UploadStarted, ChunkStarted, ChunkProgress, ChunkRetried,
+// ChunkFailed, ChunkCompleted, ChunkSkipped, ManifestUploaded, ConcurrencyChanged,
+// UploadFinished, and UploadFailed. Use a type switch to tell them apart.
+type Event interface {
+	event()
+}
+
+// UploadStarted is sent once, before any chunks are uploaded.
+type UploadStarted struct {
+	Container string
+	Object    string
+	Chunks    uint
+	Bytes     uint
+}
+
+// ChunkStarted is sent at the beginning of each attempt to upload a chunk.
+// Attempt counts from 1.
+type ChunkStarted struct {
+	Number  uint
+	Object  string
+	Attempt uint
+}
+
+// ChunkProgress is sent each time data is written to a chunk's upload. Bytes
+// is the total amount of data written by the current attempt so far, which is
+// at most UploadBufferSize bytes more than in the previous ChunkProgress.
+type ChunkProgress struct {
+	Number  uint
+	Object  string
+	Attempt uint
+	Bytes   uint
+}
+
+// ChunkRetried is sent when an attempt to upload a chunk fails and another
+// attempt will be made. Err is the reason for the failure.
+type ChunkRetried struct {
+	Number  uint
+	Object  string
+	Attempt uint
+	Err     error
+}
+
+// ChunkFailed is sent when the last attempt to upload a chunk fails. Bytes is
+// the size of the chunk and Err is the reason that the last attempt failed.
+type ChunkFailed struct {
+	Number   uint
+	Object   string
+	Attempts uint
+	Bytes    uint
+	Err      error
+}
+
+// ChunkCompleted is sent when a chunk has been uploaded. Duration covers only
+// the successful attempt.
+type ChunkCompleted struct {
+	Number   uint
+	Object   string
+	Attempt  uint
+	Etag     string
+	Bytes    uint
+	Duration time.Duration
+}
+
+// ChunkSkipped is sent for each chunk that is not uploaded because it is
+// already in object storage.
+type ChunkSkipped struct {
+	Number uint
+	Object string
+	Bytes  uint
+}
+
+// ManifestUploaded is sent when an SLO manifest has been uploaded. Bytes is the
+// size of the manifest itself, not of the data that it refers to.
+type ManifestUploaded struct {
+	Number   uint
+	Object   string
+	Bytes    uint
+	Duration time.Duration
+}
+
+// ConcurrencyChanged is sent when the number of chunks that may upload at once
+// changes. Limit is the new number.
+type ConcurrencyChanged struct {
+	Limit uint
+}
+
+// UploadFinished is sent once when every part of an upload succeeded.
+type UploadFinished struct {
+	Container string
+	Object    string
+	Bytes     uint
+	Duration  time.Duration
+}
+
+// UploadFailed is sent once instead of UploadFinished when any part of an
+// upload failed.
+type UploadFailed struct {
+	Container string
+	Object    string
+	Duration  time.Duration
+	Err       error
+}
+
+func (UploadStarted) event()      {}
+func (ChunkStarted) event()       {}
+func (ChunkProgress) event()      {}
+func (ChunkRetried) event()       {}
+func (ChunkFailed) event()        {}
+func (ChunkCompleted) event()     {}
+func (ChunkSkipped) event()       {}
+func (ManifestUploaded) event()   {}
+func (ConcurrencyChanged) event() {}
+func (UploadFinished) event()     {}
+func (UploadFailed) event()       {}
+
+// Observer receives the Events of an upload. Events are delivered
+// synchronously from the goroutines of the pipeline stages, so OnEvent must be
+// safe for concurrent use and should return quickly.
+type Observer interface {
+	OnEvent(event Event)
+}
+
+// ObserverFunc adapts a function to the Observer interface.
+type ObserverFunc func(event Event)
+
+// OnEvent calls f(event).
+func (f ObserverFunc) OnEvent(event Event) {
+	f(event)
+}
+
+// Observers delivers each Event to every Observer in the slice, in order.
+type Observers []Observer
+
+// OnEvent sends event to each of the Observers.
+func (o Observers) OnEvent(event Event) {
+	for _, observer := range o {
+		observer.OnEvent(event)
+	}
+}
+
+// Ensure that the observers satisfy the interface at compile-time
+var _ Observer = ObserverFunc(nil)
+var _ Observer = Observers{}
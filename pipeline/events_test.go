@@ -0,0 +1,130 @@
+package pipeline_test
+
+import (
+	"github.com/ibmjstart/swiftlygo/auth/mock"
+	"github.com/mattetti/filebuffer"
+	"sync"
+	"time"
+
+	. "github.com/ibmjstart/swiftlygo/pipeline"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+// eventRecorder is an Observer that remembers every Event that it receives.
+type eventRecorder struct {
+	sync.Mutex
+	events []Event
+}
+
+func (r *eventRecorder) OnEvent(event Event) {
+	r.Lock()
+	defer r.Unlock()
+	r.events = append(r.events, event)
+}
+
+var _ = Describe("Events", func() {
+	var (
+		maxAttempts uint
+		baseWait    time.Duration
+		chunks      chan FileChunk
+		errs        chan error
+		source      *filebuffer.Buffer
+		first       *eventRecorder
+		second      *eventRecorder
+	)
+
+	BeforeEach(func() {
+		maxAttempts, baseWait = UploadMaxAttempts, UploadRetryBaseWait
+		UploadMaxAttempts, UploadRetryBaseWait = 1, 0
+		chunks = make(chan FileChunk, 1)
+		errs = make(chan error, 10)
+		source = filebuffer.New([]byte("0123456789"))
+		first, second = &eventRecorder{}, &eventRecorder{}
+	})
+
+	AfterEach(func() {
+		UploadMaxAttempts, UploadRetryBaseWait = maxAttempts, baseWait
+	})
+
+	Context("When a chunk uploads", func() {
+		It("Should notify every observer that it started and completed", func() {
+			out := ReadHashAndUpload(chunks, errs, source, mock.NewBufferDestination(),
+				WithObserver(first), WithObserver(second))
+			chunks <- FileChunk{Number: 2, Size: 10, Object: "object", Container: "container"}
+			close(chunks)
+			var hash string
+			for chunk := range out {
+				hash = chunk.Hash
+			}
+			Expect(first.events).To(HaveLen(3))
+			Expect(first.events[0]).To(Equal(ChunkStarted{Number: 2, Object: "object", Attempt: 1}))
+			Expect(first.events[1]).To(Equal(ChunkProgress{Number: 2, Object: "object", Attempt: 1, Bytes: 10}))
+			completed, ok := first.events[2].(ChunkCompleted)
+			Expect(ok).To(BeTrue())
+			Expect(completed.Number).To(Equal(uint(2)))
+			Expect(completed.Bytes).To(Equal(uint(10)))
+			Expect(completed.Etag).To(Equal(hash))
+			Expect(second.events).To(Equal(first.events))
+		})
+	})
+	Context("When a chunk is larger than the upload buffer", func() {
+		var bufferSize uint
+		BeforeEach(func() {
+			bufferSize = UploadBufferSize
+			UploadBufferSize = 4
+		})
+		AfterEach(func() {
+			UploadBufferSize = bufferSize
+		})
+		It("Should report progress after each write", func() {
+			out := ReadHashAndUpload(chunks, errs, source, mock.NewBufferDestination(), WithObserver(first))
+			chunks <- FileChunk{Number: 0, Size: 10, Object: "object", Container: "container"}
+			close(chunks)
+			for range out {
+			}
+			var progress []uint
+			for _, event := range first.events {
+				if event, ok := event.(ChunkProgress); ok {
+					progress = append(progress, event.Bytes)
+				}
+			}
+			Expect(progress).To(Equal([]uint{4, 8, 10}))
+		})
+	})
+	Context("When a chunk fails", func() {
+		It("Should report retries and the final failure", func() {
+			out := ReadHashAndUpload(chunks, errs, source, mock.NewErrorDestination(), WithObserver(first))
+			chunks <- FileChunk{Number: 2, Size: 10, Object: "object", Container: "container"}
+			close(chunks)
+			for range out {
+			}
+			Expect(first.events).To(HaveLen(4))
+			Expect(first.events[0]).To(Equal(ChunkStarted{Number: 2, Object: "object", Attempt: 1}))
+			retried, ok := first.events[1].(ChunkRetried)
+			Expect(ok).To(BeTrue())
+			Expect(retried.Attempt).To(Equal(uint(1)))
+			Expect(retried.Err).To(HaveOccurred())
+			Expect(first.events[2]).To(Equal(ChunkStarted{Number: 2, Object: "object", Attempt: 2}))
+			failed, ok := first.events[3].(ChunkFailed)
+			Expect(ok).To(BeTrue())
+			Expect(failed.Attempts).To(Equal(uint(2)))
+			Expect(failed.Bytes).To(Equal(uint(10)))
+			Expect(failed.Err).To(HaveOccurred())
+		})
+	})
+	Context("When a manifest uploads", func() {
+		It("Should send ManifestUploaded", func() {
+			manifests := make(chan FileChunk, 1)
+			manifests <- FileChunk{Number: 1, Object: "manifest", Container: "container", Data: []byte("[]")}
+			close(manifests)
+			for range UploadManifests(manifests, errs, mock.NewNullDestination(), WithObserver(ObserverFunc(first.OnEvent))) {
+			}
+			Expect(first.events).To(HaveLen(1))
+			uploaded, ok := first.events[0].(ManifestUploaded)
+			Expect(ok).To(BeTrue())
+			Expect(uploaded.Object).To(Equal("manifest"))
+			Expect(uploaded.Bytes).To(Equal(uint(2)))
+		})
+	})
+})
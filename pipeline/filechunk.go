@@ -1,6 +1,9 @@
 package pipeline
 
-import "fmt"
+import (
+	"context"
+	"fmt"
+)
 
 // FileChunk represents a single region of a file.
 //
@@ -8,18 +11,24 @@ import "fmt"
 // Object is the name that this FileChunk will bear within object storage
 // Container is the object storage Container that this chunk will be uploaded into
 // Hash is the md5 sum of this FileChunk
+// Checksums holds any other digests of this FileChunk, by the Name of their Checksum
 // Data is a slice of the original file of length Size
 // Size is the length of the Data slice if the FileChunk represents a normal file chunk
 // 	or it could be the apparent size of the manifest, if it represents a manifest file
 // Offset is the index of the first byte in the file that is included in Data
+// SourceSize is the length of the chunk in the file if it was compressed or encrypted, and Size the length stored
+// Context is the parent of the trace spans for this chunk, and may be nil
 type FileChunk struct {
-	Number    uint
-	Object    string
-	Container string
-	Hash      string
-	Data      []byte
-	Size      uint
-	Offset    uint
+	Number     uint
+	Object     string
+	Container  string
+	Hash       string
+	Checksums  map[string]string
+	Data       []byte
+	Size       uint
+	Offset     uint
+	SourceSize uint
+	Context    context.Context
 }
 
 // MarshalJSON defines the transformation from a FileChunk to an SLO manifest entry
@@ -0,0 +1,102 @@
+package pipeline
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+)
+
+// Logger receives structured log messages from pipeline stages. Each message
+// is followed by alternating keys and values, such as "chunk", 3, "object",
+// "name". A *log/slog.Logger satisfies this interface.
+type Logger interface {
+	Debug(msg string, args ...interface{})
+	Info(msg string, args ...interface{})
+	Warn(msg string, args ...interface{})
+	Error(msg string, args ...interface{})
+}
+
+// Level is the severity of a log message. The values match those of
+// log/slog.Level.
+type Level int
+
+const (
+	LevelDebug Level = -4
+	LevelInfo  Level = 0
+	LevelWarn  Level = 4
+	LevelError Level = 8
+)
+
+func (l Level) String() string {
+	switch l {
+	case LevelDebug:
+		return "DEBUG"
+	case LevelInfo:
+		return "INFO"
+	case LevelWarn:
+		return "WARN"
+	case LevelError:
+		return "ERROR"
+	}
+	return fmt.Sprintf("LEVEL(%d)", int(l))
+}
+
+// writerLogger formats messages as lines of text for an io.Writer.
+type writerLogger struct {
+	sync.Mutex
+	output  io.Writer
+	minimum Level
+}
+
+// NewWriterLogger returns a Logger that writes each message of at least the
+// given level to output as a single line of the form
+//
+//	LEVEL message key=value key=value
+//
+// It is safe for concurrent use. Errors writing to output are ignored, so a
+// full disk or a closed pipe does not interrupt an upload.
+func NewWriterLogger(output io.Writer, minimum Level) Logger {
+	return &writerLogger{output: output, minimum: minimum}
+}
+
+func (w *writerLogger) log(level Level, msg string, args []interface{}) {
+	if level < w.minimum {
+		return
+	}
+	line := new(strings.Builder)
+	fmt.Fprintf(line, "%s %s", level, msg)
+	for i := 0; i < len(args); i += 2 {
+		if i+1 < len(args) {
+			fmt.Fprintf(line, " %v=%v", args[i], args[i+1])
+		} else {
+			fmt.Fprintf(line, " !BADKEY=%v", args[i])
+		}
+	}
+	line.WriteString("\n")
+	w.Lock()
+	defer w.Unlock()
+	_, _ = io.WriteString(w.output, line.String())
+}
+
+func (w *writerLogger) Debug(msg string, args ...interface{}) { w.log(LevelDebug, msg, args) }
+func (w *writerLogger) Info(msg string, args ...interface{})  { w.log(LevelInfo, msg, args) }
+func (w *writerLogger) Warn(msg string, args ...interface{})  { w.log(LevelWarn, msg, args) }
+func (w *writerLogger) Error(msg string, args ...interface{}) { w.log(LevelError, msg, args) }
+
+// nopLogger discards every message.
+type nopLogger struct{}
+
+// NopLogger returns a Logger that discards every message.
+func NopLogger() Logger {
+	return nopLogger{}
+}
+
+func (nopLogger) Debug(msg string, args ...interface{}) {}
+func (nopLogger) Info(msg string, args ...interface{})  {}
+func (nopLogger) Warn(msg string, args ...interface{})  {}
+func (nopLogger) Error(msg string, args ...interface{}) {}
+
+// Ensure that the loggers satisfy the interface at compile-time
+var _ Logger = &writerLogger{}
+var _ Logger = nopLogger{}
@@ -0,0 +1,110 @@
+package pipeline_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/ibmjstart/swiftlygo/auth/mock"
+	"github.com/mattetti/filebuffer"
+	"log/slog"
+	"strings"
+	"time"
+
+	. "github.com/ibmjstart/swiftlygo/pipeline"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Logger", func() {
+	var output *bytes.Buffer
+
+	BeforeEach(func() {
+		output = new(bytes.Buffer)
+	})
+
+	Describe("NewWriterLogger", func() {
+		It("Should write one line per message with its level and fields", func() {
+			logger := NewWriterLogger(output, LevelDebug)
+			logger.Info("Uploaded chunk", "chunk", 3, "object", "name")
+			logger.Error("Odd", "key")
+			Expect(output.String()).To(Equal("INFO Uploaded chunk chunk=3 object=name\nERROR Odd !BADKEY=key\n"))
+		})
+		It("Should discard messages below its minimum level", func() {
+			logger := NewWriterLogger(output, LevelWarn)
+			logger.Debug("debug")
+			logger.Info("info")
+			logger.Warn("warn")
+			Expect(output.String()).To(Equal("WARN warn\n"))
+		})
+	})
+
+	Describe("WithLogger", func() {
+		var (
+			maxAttempts uint
+			baseWait    time.Duration
+			chunks      chan FileChunk
+			errs        chan error
+			source      *filebuffer.Buffer
+		)
+		BeforeEach(func() {
+			maxAttempts, baseWait = UploadMaxAttempts, UploadRetryBaseWait
+			UploadMaxAttempts, UploadRetryBaseWait = 1, 0
+			chunks = make(chan FileChunk, 1)
+			errs = make(chan error, 10)
+			source = filebuffer.New([]byte("0123456789"))
+		})
+		AfterEach(func() {
+			UploadMaxAttempts, UploadRetryBaseWait = maxAttempts, baseWait
+		})
+
+		// records decodes each line of JSON that a slog.Logger wrote to output.
+		records := func() []map[string]interface{} {
+			var result []map[string]interface{}
+			for _, line := range strings.Split(strings.TrimSpace(output.String()), "\n") {
+				record := make(map[string]interface{})
+				Expect(json.Unmarshal([]byte(line), &record)).To(Succeed())
+				result = append(result, record)
+			}
+			return result
+		}
+
+		It("Should log uploaded chunks with their fields to a slog.Logger", func() {
+			logger := slog.New(slog.NewJSONHandler(output, nil))
+			out := ReadHashAndUpload(chunks, errs, source, mock.NewBufferDestination(), WithLogger(logger))
+			chunks <- FileChunk{Number: 2, Size: 10, Object: "object", Container: "container"}
+			close(chunks)
+			for range out {
+			}
+			Expect(records()).To(ConsistOf(And(
+				HaveKeyWithValue("level", "INFO"),
+				HaveKeyWithValue("msg", "Uploaded chunk"),
+				HaveKeyWithValue("chunk", BeNumerically("==", 2)),
+				HaveKeyWithValue("object", "object"),
+				HaveKeyWithValue("attempt", BeNumerically("==", 1)),
+				HaveKeyWithValue("bytes", BeNumerically("==", 10)),
+				HaveKey("duration"),
+			)))
+		})
+		It("Should log failed attempts as warnings", func() {
+			logger := slog.New(slog.NewJSONHandler(output, nil))
+			out := ReadHashAndUpload(chunks, errs, source, mock.NewErrorDestination(), WithLogger(logger))
+			chunks <- FileChunk{Number: 2, Size: 10, Object: "object", Container: "container"}
+			close(chunks)
+			for range out {
+			}
+			logged := records()
+			Expect(logged).To(HaveLen(3))
+			Expect(logged[0]).To(HaveKeyWithValue("level", "WARN"))
+			Expect(logged[0]).To(HaveKeyWithValue("attempt", BeNumerically("==", 1)))
+			Expect(logged[1]).To(HaveKeyWithValue("attempt", BeNumerically("==", 2)))
+			Expect(logged[2]).To(HaveKeyWithValue("level", "ERROR"))
+		})
+		It("Should log manifest uploads", func() {
+			manifests := make(chan FileChunk, 1)
+			manifests <- FileChunk{Number: 0, Object: "manifest", Container: "container", Data: []byte("[]")}
+			close(manifests)
+			for range UploadManifests(manifests, errs, mock.NewNullDestination(), WithLogger(NewWriterLogger(output, LevelInfo))) {
+			}
+			Expect(output.String()).To(Equal("INFO Uploading manifest manifest=0 object=manifest\n"))
+		})
+	})
+})
@@ -0,0 +1,153 @@
+package pipeline
+
+import (
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// settings holds the configuration that Options apply to a stage.
+type settings struct {
+	logger      Logger
+	observers   Observers
+	tracer      trace.Tracer
+	limiter     *RateLimiter
+	adaptive    *AdaptiveConcurrency
+	retry       RetryPolicy
+	deadLetters chan<- FileChunk
+	checksums   []Checksum
+	precompute  bool
+	keys        KeyProvider
+	compression *Compression
+}
+
+// Option configures optional behavior of a pipeline stage.
+type Option func(*settings)
+
+// WithLogger makes a stage report its progress to logger. Stages log nothing
+// by default.
+func WithLogger(logger Logger) Option {
+	return func(s *settings) {
+		if logger != nil {
+			s.logger = logger
+		}
+	}
+}
+
+// WithObserver makes a stage send its Events to observer. It may be given more
+// than once, in which case every observer receives each Event.
+func WithObserver(observer Observer) Option {
+	return func(s *settings) {
+		if observer != nil {
+			s.observers = append(s.observers, observer)
+		}
+	}
+}
+
+// WithRateLimiter makes a stage wait for limiter before each write of data, so
+// that the stage, and any others sharing limiter, stay within its rate. The
+// rate applies to the data sent, after any compression and encryption. Stages
+// are not rate limited by default.
+func WithRateLimiter(limiter *RateLimiter) Option {
+	return func(s *settings) {
+		s.limiter = limiter
+	}
+}
+
+// WithAdaptiveConcurrency makes ReadHashAndUpload wait for concurrency before
+// each attempt to upload a chunk, and report the outcome of the attempt to it.
+// Stages that share concurrency upload no more chunks at once than its limit.
+func WithAdaptiveConcurrency(concurrency *AdaptiveConcurrency) Option {
+	return func(s *settings) {
+		s.adaptive = concurrency
+	}
+}
+
+// WithRetryPolicy makes the network stages retry failed requests according to
+// policy instead of DefaultRetryPolicy.
+func WithRetryPolicy(policy RetryPolicy) Option {
+	return func(s *settings) {
+		if policy != nil {
+			s.retry = policy
+		}
+	}
+}
+
+// WithDeadLetters makes ReadHashAndUpload send the chunks that it could not
+// upload to deadLetters. Each send must be received, or the stage blocks. By
+// default, failed chunks are only reported on the errors channel and to
+// Observers.
+func WithDeadLetters(deadLetters chan<- FileChunk) Option {
+	return func(s *settings) {
+		s.deadLetters = deadLetters
+	}
+}
+
+// WithChecksums makes ReadHashAndUpload compute checksums of each chunk while
+// it uploads, in addition to the MD5 sum, and store them in the chunk's
+// Checksums. If the destination is an auth.MetadataDestination, the checksums
+// are also stored as metadata of each chunk, which requires reading each chunk
+// twice because the metadata is sent before the data.
+func WithChecksums(checksums ...Checksum) Option {
+	return func(s *settings) {
+		s.checksums = append(s.checksums, checksums...)
+	}
+}
+
+// WithPrecomputedEtags makes ReadHashAndUpload read each chunk twice: once to
+// compute its MD5 sum, and again to upload it with the sum as the expected
+// Etag, so that object storage rejects a body that was corrupted in transit
+// rather than storing it.
+func WithPrecomputedEtags() Option {
+	return func(s *settings) {
+		s.precompute = true
+	}
+}
+
+// WithEncryption makes ReadHashAndUpload encrypt each chunk with AES-256-GCM
+// using the current key of keys before uploading it. The key's ID and a random
+// nonce are stored in the chunk's metadata, so the destination must be an
+// auth.MetadataDestination. Checksums and the chunk's Checksums describe the
+// plaintext, while its Hash and Size describe the ciphertext stored. Read
+// encrypted chunks back with NewDecrypter.
+func WithEncryption(keys KeyProvider) Option {
+	return func(s *settings) {
+		s.keys = keys
+	}
+}
+
+// WithCompression makes ReadHashAndUpload compress each chunk independently
+// with compression, before encrypting it if WithEncryption is also given. The
+// algorithm and the chunk's original Offset and Size are stored in its
+// metadata, so the destination must be an auth.MetadataDestination. It makes
+// UploadManifests mark manifests as compressed unless chunks are also
+// encrypted, since the data of such manifests is a series of compressed
+// streams that decompresses as one. Read compressed chunks back with
+// NewDecompressor or NewIndexedReader.
+func WithCompression(compression Compression) Option {
+	return func(s *settings) {
+		s.compression = &compression
+	}
+}
+
+// WithTracerProvider makes a stage create OpenTelemetry spans with a tracer
+// from provider. By default, stages use the global TracerProvider, which does
+// nothing unless the application configures one.
+func WithTracerProvider(provider trace.TracerProvider) Option {
+	return func(s *settings) {
+		if provider != nil {
+			s.tracer = provider.Tracer(TracerName)
+		}
+	}
+}
+
+func newSettings(opts []Option) settings {
+	s := settings{
+		logger: nopLogger{},
+		tracer: otel.GetTracerProvider().Tracer(TracerName),
+		retry:  DefaultRetryPolicy(),
+	}
+	for _, opt := range opts {
+		opt(&s)
+	}
+	return s
+}
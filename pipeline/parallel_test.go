@@ -0,0 +1,130 @@
+package pipeline_test
+
+import (
+	"fmt"
+	"github.com/ibmjstart/swiftlygo/auth"
+	"github.com/ibmjstart/swiftlygo/auth/mock"
+	"github.com/mattetti/filebuffer"
+	"strings"
+	"testing"
+	"time"
+
+	. "github.com/ibmjstart/swiftlygo/pipeline"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+// everyTenthChunk delays the upload of every tenth chunk by slow and of the
+// others by fast.
+func everyTenthChunk(slow, fast time.Duration) func(container, objectName string) time.Duration {
+	return func(container, objectName string) time.Duration {
+		if strings.HasSuffix(objectName, "0") {
+			return slow
+		}
+		return fast
+	}
+}
+
+// numberedChunks sends count chunks of size bytes, named by their number, on
+// a buffered channel.
+func numberedChunks(count, size uint) <-chan FileChunk {
+	chunks := make(chan FileChunk, count)
+	for i := uint(0); i < count; i++ {
+		chunks <- FileChunk{
+			Number:    i,
+			Size:      size,
+			Offset:    i * size,
+			Object:    fmt.Sprintf("object-%d", i),
+			Container: "container",
+		}
+	}
+	close(chunks)
+	return chunks
+}
+
+var _ = Describe("Parallel", func() {
+	var (
+		errs   chan error
+		source *filebuffer.Buffer
+	)
+
+	BeforeEach(func() {
+		errs = make(chan error, 10)
+		source = filebuffer.New(make([]byte, 80))
+	})
+
+	upload := func(dest auth.Destination) Stage {
+		return func(chunks <-chan FileChunk, errors chan<- error) <-chan FileChunk {
+			return ReadHashAndUpload(chunks, errors, source, dest)
+		}
+	}
+
+	Context("When every copy of the stage is fast", func() {
+		It("Should pass every chunk through once", func() {
+			seen := make(map[uint]bool)
+			for chunk := range Parallel(numberedChunks(8, 10), errs, 3, upload(mock.NewNullDestination())) {
+				Expect(seen).NotTo(HaveKey(chunk.Number))
+				seen[chunk.Number] = true
+			}
+			Expect(seen).To(HaveLen(8))
+			Expect(errs).To(BeEmpty())
+		})
+		It("Should run at least one copy", func() {
+			var count int
+			for range Parallel(numberedChunks(2, 10), errs, 0, upload(mock.NewNullDestination())) {
+				count++
+			}
+			Expect(count).To(Equal(2))
+		})
+	})
+	Context("When one copy of the stage is slow", func() {
+		It("Should give the other chunks to the idle copies", func() {
+			dest := mock.NewLatencyDestination(mock.NewNullDestination(), everyTenthChunk(100*time.Millisecond, 0))
+			var order []uint
+			for chunk := range Parallel(numberedChunks(8, 10), errs, 2, upload(dest)) {
+				order = append(order, chunk.Number)
+			}
+			Expect(order).To(HaveLen(8))
+			Expect(order[len(order)-1]).To(Equal(uint(0)))
+		})
+	})
+})
+
+// benchmarkUploads uploads 32 chunks with 4 uploaders through dispatch, where
+// every tenth chunk is slow, and reports the time taken per upload.
+func benchmarkUploads(b *testing.B, dispatch func(chunks <-chan FileChunk, errors chan<- error, stage Stage) <-chan FileChunk) {
+	source := filebuffer.New(make([]byte, 32*1024))
+	dest := mock.NewLatencyDestination(mock.NewNullDestination(), everyTenthChunk(10*time.Millisecond, time.Millisecond))
+	stage := func(chunks <-chan FileChunk, errors chan<- error) <-chan FileChunk {
+		return ReadHashAndUpload(chunks, errors, source, dest)
+	}
+	errs := make(chan error)
+	go func() {
+		for err := range errs {
+			b.Error(err)
+		}
+	}()
+	defer close(errs)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for range dispatch(numberedChunks(32, 1024), errs, stage) {
+		}
+	}
+}
+
+func BenchmarkDivide(b *testing.B) {
+	benchmarkUploads(b, func(chunks <-chan FileChunk, errors chan<- error, stage Stage) <-chan FileChunk {
+		streams := Divide(chunks, 4)
+		outputs := make([]<-chan FileChunk, len(streams))
+		for i, stream := range streams {
+			outputs[i] = stage(stream, errors)
+		}
+		return Join(outputs...)
+	})
+}
+
+func BenchmarkParallel(b *testing.B) {
+	benchmarkUploads(b, func(chunks <-chan FileChunk, errors chan<- error, stage Stage) <-chan FileChunk {
+		return Parallel(chunks, errors, 4, stage)
+	})
+}
@@ -0,0 +1,76 @@
+package pipeline
+
+import (
+	"io"
+	"sync"
+	"time"
+)
+
+// RateLimiter limits the rate at which data is uploaded. One RateLimiter may be
+// shared by any number of goroutines, including those of different uploads, to
+// limit their combined rate. It is safe for concurrent use.
+//
+// Each call to Wait reserves the time that its data takes to send at the
+// current rate, so data is spread evenly over time instead of being sent in
+// bursts.
+type RateLimiter struct {
+	lock sync.Mutex
+	rate uint
+	next time.Time // the time at which the next reservation begins
+}
+
+// NewRateLimiter creates a RateLimiter that allows bytesPerSecond bytes to be
+// sent each second. A rate of 0 means no limit.
+func NewRateLimiter(bytesPerSecond uint) *RateLimiter {
+	return &RateLimiter{rate: bytesPerSecond}
+}
+
+// Rate returns the current limit in bytes per second, or 0 if there is none.
+func (r *RateLimiter) Rate() uint {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return r.rate
+}
+
+// SetRate changes the limit to bytesPerSecond, or removes it if bytesPerSecond
+// is 0. The new rate applies to every subsequent call to Wait, so it can be
+// changed while uploads are running, for instance on a schedule.
+func (r *RateLimiter) SetRate(bytesPerSecond uint) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.rate = bytesPerSecond
+}
+
+// Wait blocks until bytes more bytes may be sent without exceeding the rate.
+// A nil RateLimiter never blocks.
+func (r *RateLimiter) Wait(bytes uint) {
+	if r == nil {
+		return
+	}
+	r.lock.Lock()
+	if r.rate == 0 {
+		r.lock.Unlock()
+		return
+	}
+	now := time.Now()
+	if r.next.Before(now) {
+		r.next = now
+	}
+	start := r.next
+	r.next = r.next.Add(time.Duration(float64(bytes) / float64(r.rate) * float64(time.Second)))
+	r.lock.Unlock()
+	time.Sleep(start.Sub(now))
+}
+
+// limitedWriter waits for limiter before each write to w. It wraps the body of
+// an upload after any compression and encryption, so that the rate applies to
+// the data that is actually sent.
+type limitedWriter struct {
+	w       io.Writer
+	limiter *RateLimiter
+}
+
+func (l limitedWriter) Write(p []byte) (int, error) {
+	l.limiter.Wait(uint(len(p)))
+	return l.w.Write(p)
+}
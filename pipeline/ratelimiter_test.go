@@ -0,0 +1,86 @@
+package pipeline_test
+
+import (
+	"github.com/ibmjstart/swiftlygo/auth/mock"
+	"github.com/mattetti/filebuffer"
+	"sync"
+	"time"
+
+	. "github.com/ibmjstart/swiftlygo/pipeline"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("RateLimiter", func() {
+	Context("With no limit", func() {
+		It("Should not block", func() {
+			started := time.Now()
+			NewRateLimiter(0).Wait(1 << 30)
+			var limiter *RateLimiter
+			limiter.Wait(1 << 30)
+			Expect(time.Since(started)).To(BeNumerically("<", 50*time.Millisecond))
+		})
+	})
+	Context("With a limit", func() {
+		It("Should spread the data of every caller over time", func() {
+			limiter := NewRateLimiter(1000)
+			Expect(limiter.Rate()).To(Equal(uint(1000)))
+			started := time.Now()
+			var wg sync.WaitGroup
+			for i := 0; i < 2; i++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					for j := 0; j < 3; j++ {
+						limiter.Wait(50)
+					}
+				}()
+			}
+			wg.Wait()
+			// The first 50 bytes are sent immediately and the other 250 take a
+			// quarter of a second
+			Expect(time.Since(started)).To(BeNumerically("~", 250*time.Millisecond, 100*time.Millisecond))
+		})
+		It("Should apply a new rate to later calls", func() {
+			limiter := NewRateLimiter(100)
+			limiter.Wait(10)
+			limiter.SetRate(0)
+			started := time.Now()
+			limiter.Wait(1000)
+			Expect(time.Since(started)).To(BeNumerically("<", 50*time.Millisecond))
+			Expect(limiter.Rate()).To(BeZero())
+		})
+	})
+	Context("When uploading", func() {
+		It("Should limit the rate at which data is written", func() {
+			chunks := make(chan FileChunk, 1)
+			errs := make(chan error, 10)
+			size := 4 * UploadBufferSize
+			out := ReadHashAndUpload(chunks, errs, filebuffer.New(make([]byte, size)), mock.NewBufferDestination(),
+				WithRateLimiter(NewRateLimiter(size*5)))
+			started := time.Now()
+			chunks <- FileChunk{Number: 0, Size: size, Object: "object", Container: "container"}
+			close(chunks)
+			for range out {
+			}
+			Expect(errs).To(BeEmpty())
+			// Three of the four writes wait for a twentieth of a second each
+			Expect(time.Since(started)).To(BeNumerically(">=", 140*time.Millisecond))
+		})
+		It("Should limit the rate at which compressed data is sent rather than read", func() {
+			chunks := make(chan FileChunk, 1)
+			errs := make(chan error, 10)
+			size := 4 * UploadBufferSize
+			out := ReadHashAndUpload(chunks, errs, filebuffer.New(make([]byte, size)), mock.NewBufferDestination(),
+				WithRateLimiter(NewRateLimiter(size*5)), WithCompression(Gzip))
+			started := time.Now()
+			chunks <- FileChunk{Number: 0, Size: size, Object: "object", Container: "container"}
+			close(chunks)
+			for range out {
+			}
+			Expect(errs).To(BeEmpty())
+			// The zeros compress to far less than a twentieth of a second of data
+			Expect(time.Since(started)).To(BeNumerically("<", 100*time.Millisecond))
+		})
+	})
+})
@@ -0,0 +1,109 @@
+package pipeline
+
+import (
+	"errors"
+	"github.com/ibmjstart/swiftlygo/auth"
+	"math/rand"
+	"net/http"
+	"time"
+)
+
+// UploadRetryMaxWait is the longest time that the default RetryPolicy waits
+// between attempts, unless object storage asks for a longer wait with a
+// Retry-After header.
+var UploadRetryMaxWait time.Duration = time.Minute
+
+// RetryPolicy decides whether and when the network stages retry a request
+// that failed.
+type RetryPolicy interface {
+	// MaxAttempts is the greatest number of times that a request is made,
+	// including the first. At least one attempt is always made.
+	MaxAttempts() uint
+	// Delay is how long to wait before making retry number retry (counting
+	// from 1) of a request that failed with err.
+	Delay(retry uint, err error) time.Duration
+	// IsRetryable reports whether a request that failed with err may succeed
+	// if it is made again.
+	IsRetryable(err error) bool
+}
+
+// ExponentialBackoff is a RetryPolicy that waits a random time between zero
+// and BaseDelay << retry, up to MaxDelay, before each retry. This "full jitter"
+// keeps many clients that failed at once from retrying at once. If object
+// storage answers with a Retry-After header, it waits at least that long even
+// if that is longer than MaxDelay. A MaxDelay of 0 means no maximum. Errors are
+// classified with IsRetryable.
+type ExponentialBackoff struct {
+	Attempts  uint
+	BaseDelay time.Duration
+	MaxDelay  time.Duration
+}
+
+// MaxAttempts returns e.Attempts.
+func (e ExponentialBackoff) MaxAttempts() uint {
+	return e.Attempts
+}
+
+// Delay returns a random delay for the retry, or the delay that object storage
+// asked for in err if that is longer.
+func (e ExponentialBackoff) Delay(retry uint, err error) time.Duration {
+	ceiling := e.BaseDelay << retry
+	if ceiling < e.BaseDelay || (e.MaxDelay > 0 && ceiling > e.MaxDelay) {
+		// Cap the delay, including when the shift overflowed
+		ceiling = e.MaxDelay
+	}
+	var delay time.Duration
+	if ceiling > 0 {
+		delay = time.Duration(rand.Int63n(int64(ceiling)))
+	}
+	var statusErr *auth.HTTPStatusError
+	if errors.As(err, &statusErr) && statusErr.RetryAfter > delay {
+		delay = statusErr.RetryAfter
+	}
+	return delay
+}
+
+// IsRetryable returns IsRetryable(err).
+func (e ExponentialBackoff) IsRetryable(err error) bool {
+	return IsRetryable(err)
+}
+
+// IsRetryable reports whether a request that failed with err may succeed if it
+// is retried. Client errors (HTTP 4xx statuses) are not retryable because the
+// request itself was wrong, except for 401 Unauthorized, which may succeed with
+// a new token, 408 Request Timeout, 429 Too Many Requests, and 422 Unprocessable
+// Entity, which OpenStack Swift returns when the data that it received does not
+// match the Etag sent with it, as when the data was corrupted in transit. Every
+// other error, including server errors and network problems, is retryable.
+func IsRetryable(err error) bool {
+	var statusErr *auth.HTTPStatusError
+	if !errors.As(err, &statusErr) || statusErr.Code < 400 || statusErr.Code >= 500 {
+		return true
+	}
+	switch statusErr.Code {
+	case http.StatusUnauthorized, http.StatusRequestTimeout, http.StatusUnprocessableEntity, http.StatusTooManyRequests:
+		return true
+	}
+	return false
+}
+
+// DefaultRetryPolicy returns the RetryPolicy that the stages use unless
+// another is given with WithRetryPolicy. It makes UploadMaxAttempts retries
+// after the first attempt, and backs off exponentially from UploadRetryBaseWait
+// to at most UploadRetryMaxWait.
+func DefaultRetryPolicy() RetryPolicy {
+	return ExponentialBackoff{
+		Attempts:  UploadMaxAttempts + 1,
+		BaseDelay: UploadRetryBaseWait,
+		MaxDelay:  UploadRetryMaxWait,
+	}
+}
+
+// willRetry reports whether policy allows another attempt after attempt
+// (counting from 1) failed with err.
+func willRetry(policy RetryPolicy, attempt uint, err error) bool {
+	return attempt < policy.MaxAttempts() && policy.IsRetryable(err)
+}
+
+// Ensure that ExponentialBackoff satisfies the interface at compile-time
+var _ RetryPolicy = ExponentialBackoff{}
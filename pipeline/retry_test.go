@@ -0,0 +1,207 @@
+package pipeline_test
+
+import (
+	"fmt"
+	"github.com/ibmjstart/swiftlygo/auth"
+	"github.com/ibmjstart/swiftlygo/auth/mock"
+	"github.com/mattetti/filebuffer"
+	"github.com/ncw/swift"
+	"net/http"
+	"sync"
+	"time"
+
+	. "github.com/ibmjstart/swiftlygo/pipeline"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+// flakyDestination fails the first failures requests to create files and SLOs
+// with err.
+type flakyDestination struct {
+	mock.NullDestination
+	sync.Mutex
+	failures int
+	requests int
+	err      error
+}
+
+func (f *flakyDestination) fail() error {
+	f.Lock()
+	defer f.Unlock()
+	f.requests++
+	if f.requests <= f.failures {
+		return f.err
+	}
+	return nil
+}
+
+func (f *flakyDestination) CreateFile(container, objectName string, checkHash bool, hash string) (auth.WriteCloseHeader, error) {
+	if err := f.fail(); err != nil {
+		return nil, err
+	}
+	return f.NullDestination.CreateFile(container, objectName, checkHash, hash)
+}
+
+func (f *flakyDestination) CreateSLO(containerName, manifestName, manifestEtag string, sloManifestJSON []byte) error {
+	return f.fail()
+}
+
+// brokenUpload fails every write, and records whether it was aborted.
+type brokenUpload struct {
+	aborted bool
+}
+
+func (b *brokenUpload) Write(data []byte) (int, error) {
+	return 0, fmt.Errorf("connection reset")
+}
+
+func (b *brokenUpload) Close() error {
+	return nil
+}
+
+func (b *brokenUpload) Headers() (swift.Headers, error) {
+	return nil, fmt.Errorf("The upload did not finish")
+}
+
+func (b *brokenUpload) CloseWithError(err error) error {
+	b.aborted = true
+	return nil
+}
+
+// brokenDestination hands out brokenUploads and keeps them for inspection.
+type brokenDestination struct {
+	mock.NullDestination
+	uploads []*brokenUpload
+}
+
+func (b *brokenDestination) CreateFile(container, objectName string, checkHash bool, hash string) (auth.WriteCloseHeader, error) {
+	upload := &brokenUpload{}
+	b.uploads = append(b.uploads, upload)
+	return upload, nil
+}
+
+var _ = Describe("RetryPolicy", func() {
+	Describe("IsRetryable", func() {
+		It("Should retry everything but client errors", func() {
+			Expect(IsRetryable(fmt.Errorf("connection reset"))).To(BeTrue())
+			for _, code := range []int{500, 503, 401, 408, 422, 429} {
+				Expect(IsRetryable(fmt.Errorf("Wrapped: %w", &auth.HTTPStatusError{Code: code}))).To(BeTrue(), "status %d", code)
+			}
+			for _, code := range []int{400, 403, 404, 411} {
+				Expect(IsRetryable(&auth.HTTPStatusError{Code: code})).To(BeFalse(), "status %d", code)
+			}
+		})
+	})
+	Describe("ExponentialBackoff", func() {
+		policy := ExponentialBackoff{Attempts: 3, BaseDelay: 10 * time.Millisecond, MaxDelay: 50 * time.Millisecond}
+		It("Should wait a random time up to the exponential backoff", func() {
+			delays := make(map[time.Duration]bool)
+			for i := 0; i < 20; i++ {
+				delay := policy.Delay(1, fmt.Errorf("failed"))
+				Expect(delay).To(BeNumerically(">=", 0))
+				Expect(delay).To(BeNumerically("<", 20*time.Millisecond))
+				delays[delay] = true
+			}
+			Expect(len(delays)).To(BeNumerically(">", 1))
+		})
+		It("Should not wait longer than the maximum", func() {
+			for _, retry := range []uint{3, 10, 100} {
+				Expect(policy.Delay(retry, fmt.Errorf("failed"))).To(BeNumerically("<", 50*time.Millisecond))
+			}
+		})
+		It("Should honor Retry-After", func() {
+			err := fmt.Errorf("Wrapped: %w", &auth.HTTPStatusError{Code: http.StatusTooManyRequests, RetryAfter: time.Minute})
+			Expect(policy.Delay(1, err)).To(Equal(time.Minute))
+		})
+		It("Should not wait without a base delay", func() {
+			Expect(ExponentialBackoff{Attempts: 2}.Delay(5, fmt.Errorf("failed"))).To(BeZero())
+		})
+	})
+	Describe("Network stages", func() {
+		var (
+			errs   chan error
+			policy RetryPolicy
+		)
+		BeforeEach(func() {
+			errs = make(chan error, 10)
+			policy = ExponentialBackoff{Attempts: 3}
+		})
+		Context("When a chunk upload fails with a client error", func() {
+			It("Should not retry it", func() {
+				dest := &flakyDestination{failures: 3, err: &auth.HTTPStatusError{Code: http.StatusForbidden}}
+				recorder := &eventRecorder{}
+				chunks := make(chan FileChunk, 1)
+				chunks <- FileChunk{Number: 0, Size: 10, Object: "object", Container: "container"}
+				close(chunks)
+				for range ReadHashAndUpload(chunks, errs, filebuffer.New(make([]byte, 10)), dest,
+					WithRetryPolicy(policy), WithObserver(recorder)) {
+				}
+				Expect(dest.requests).To(Equal(1))
+				Expect(errs).To(HaveLen(1))
+				Expect(recorder.events).To(ContainElement(BeAssignableToTypeOf(ChunkFailed{})))
+				Expect(recorder.events).NotTo(ContainElement(BeAssignableToTypeOf(ChunkRetried{})))
+			})
+		})
+		Context("When a chunk upload fails with a server error", func() {
+			It("Should retry up to the policy's maximum", func() {
+				dest := &flakyDestination{failures: 5, err: &auth.HTTPStatusError{Code: http.StatusServiceUnavailable}}
+				chunks := make(chan FileChunk, 1)
+				chunks <- FileChunk{Number: 0, Size: 10, Object: "object", Container: "container"}
+				close(chunks)
+				recorder := &eventRecorder{}
+				for range ReadHashAndUpload(chunks, errs, filebuffer.New(make([]byte, 10)), dest,
+					WithRetryPolicy(policy), WithObserver(recorder)) {
+				}
+				Expect(dest.requests).To(Equal(3))
+				Expect(recorder.events).To(ContainElement(ChunkFailed{
+					Number:   0,
+					Object:   "object",
+					Attempts: 3,
+					Bytes:    10,
+					Err:      fmt.Errorf("Error initializing upload: %w", dest.err),
+				}))
+			})
+		})
+		Context("When writing a chunk fails", func() {
+			It("Should abort the upload of every failed attempt", func() {
+				dest := &brokenDestination{}
+				chunks := make(chan FileChunk, 1)
+				chunks <- FileChunk{Number: 0, Size: 10, Object: "object", Container: "container"}
+				close(chunks)
+				for range ReadHashAndUpload(chunks, errs, filebuffer.New(make([]byte, 10)), dest, WithRetryPolicy(policy)) {
+				}
+				Expect(dest.uploads).To(HaveLen(3))
+				for _, upload := range dest.uploads {
+					Expect(upload.aborted).To(BeTrue())
+				}
+			})
+		})
+		Context("When a manifest upload fails", func() {
+			It("Should retry it", func() {
+				dest := &flakyDestination{failures: 2, err: &auth.HTTPStatusError{Code: http.StatusServiceUnavailable}}
+				manifests := make(chan FileChunk, 1)
+				manifests <- FileChunk{Number: 0, Object: "manifest", Container: "container", Data: []byte("[]")}
+				close(manifests)
+				var count int
+				for range UploadManifests(manifests, errs, dest, WithRetryPolicy(policy)) {
+					count++
+				}
+				Expect(count).To(Equal(1))
+				Expect(dest.requests).To(Equal(3))
+				Expect(errs).To(BeEmpty())
+			})
+		})
+		Context("When data uploads fail", func() {
+			It("Should follow the retry policy", func() {
+				dest := &flakyDestination{failures: 5, err: &auth.HTTPStatusError{Code: http.StatusNotFound}}
+				chunks := make(chan FileChunk, 1)
+				chunks <- FileChunk{Number: 0, Size: 2, Data: []byte("ab"), Hash: "hash", Object: "object", Container: "container"}
+				close(chunks)
+				for range UploadData(chunks, errs, dest, 0, WithRetryPolicy(policy)) {
+				}
+				Expect(dest.requests).To(Equal(1))
+				Expect(errs).To(HaveLen(2))
+			})
+		})
+	})
+})
@@ -1,6 +1,9 @@
 package pipeline_test
 
 import (
+	"crypto/md5"
+	"encoding/hex"
+	"errors"
 	"fmt"
 	"github.com/ibmjstart/swiftlygo/auth"
 	"github.com/ibmjstart/swiftlygo/auth/mock"
@@ -242,7 +245,7 @@ var _ = Describe("Pipeline", func() {
 			bufferLen = numChunks * chunkSize
 			data = make([]byte, 0)
 			chunkChan = make(chan FileChunk, numChunks)
-			errorChan = make(chan error, numChunks*6) //generates an error for each retry
+			errorChan = make(chan error, numChunks*6)
 			for i = 0; i < bufferLen; i++ {
 				data = append(data, byte(i))
 			}
@@ -252,11 +255,12 @@ var _ = Describe("Pipeline", func() {
 				dest = mock.NewBufferDestination()
 				outChan = UploadData(chunkChan, errorChan, dest, time.Duration(0))
 				for i = 0; i < numChunks; i++ {
+					sum := md5.Sum(data[i*chunkSize : (i+1)*chunkSize])
 					chunkChan <- FileChunk{
 						Size:      chunkSize,
 						Object:    "Object",
 						Container: "Container",
-						Hash:      "somehexstring",
+						Hash:      hex.EncodeToString(sum[:]),
 						Number:    i,
 						Offset:    i * chunkSize,
 						Data:      data[i*chunkSize : (i+1)*chunkSize],
@@ -391,7 +395,7 @@ var _ = Describe("Pipeline", func() {
 			errCount = 0
 			data = make([]byte, 0)
 			chunkChan = make(chan FileChunk, numChunks)
-			errorChan = make(chan error, numChunks*6) //generates an error for each retry
+			errorChan = make(chan error, numChunks*6)
 			for i = 0; i < bufferLen; i++ {
 				data = append(data, byte(i))
 			}
@@ -458,5 +462,102 @@ var _ = Describe("Pipeline", func() {
 				Expect(data).To(Equal(dest.FileContent.Contents.Bytes()))
 			})
 		})
+		Context("When uploads fail", func() {
+			var maxAttempts uint
+			var baseWait time.Duration
+			BeforeEach(func() {
+				maxAttempts, baseWait = UploadMaxAttempts, UploadRetryBaseWait
+				UploadMaxAttempts, UploadRetryBaseWait = 2, 0
+			})
+			AfterEach(func() {
+				UploadMaxAttempts, UploadRetryBaseWait = maxAttempts, baseWait
+			})
+			It("Reports a chunk that failed every attempt as a single ChunkUploadError", func() {
+				outChan = ReadHashAndUpload(chunkChan, errorChan, dataSource, mock.NewErrorDestination())
+				chunkChan <- FileChunk{Size: chunkSize, Object: "Object-3", Container: "Container", Number: 3}
+				close(chunkChan)
+				for range outChan {
+				}
+				close(errorChan)
+				var attempts []uint
+				for e := range errorChan {
+					var uploadErr *ChunkUploadError
+					Expect(errors.As(e, &uploadErr)).To(BeTrue())
+					Expect(uploadErr.Number).To(Equal(uint(3)))
+					Expect(uploadErr.Object).To(Equal("Object-3"))
+					Expect(uploadErr.Err).To(HaveOccurred())
+					attempts = append(attempts, uploadErr.Attempt)
+				}
+				Expect(attempts).To(Equal([]uint{3}))
+			})
+			It("Sends chunks that failed every attempt to the dead letters instead of passing them on", func() {
+				deadLetters := make(chan FileChunk, 1)
+				outChan = ReadHashAndUpload(chunkChan, errorChan, dataSource, mock.NewErrorDestination(), WithDeadLetters(deadLetters))
+				chunkChan <- FileChunk{Size: chunkSize, Object: "Object-3", Container: "Container", Number: 3}
+				close(chunkChan)
+				for range outChan {
+					count++
+				}
+				Expect(count).To(BeZero())
+				Expect((<-deadLetters).Number).To(Equal(uint(3)))
+			})
+			It("Reports invalid chunks as InvalidChunkErrors", func() {
+				outChan = ReadHashAndUpload(chunkChan, errorChan, dataSource, mock.NewNullDestination())
+				chunkChan <- FileChunk{Size: chunkSize, Container: "Container", Number: 1}
+				close(chunkChan)
+				for range outChan {
+				}
+				close(errorChan)
+				var invalidErr *InvalidChunkError
+				Expect(errors.As(<-errorChan, &invalidErr)).To(BeTrue())
+				Expect(invalidErr.Number).To(Equal(uint(1)))
+			})
+		})
+	})
+	Describe("UploadManifests", func() {
+		It("Reports failures as ManifestUploadErrors", func() {
+			manifests := make(chan FileChunk, 1)
+			errorChan := make(chan error, 1)
+			manifests <- FileChunk{Object: "manifest", Container: "Container", Number: 2}
+			close(manifests)
+			for range UploadManifests(manifests, errorChan, mock.NewErrorDestination(), WithRetryPolicy(ExponentialBackoff{Attempts: 2})) {
+			}
+			var manifestErr *ManifestUploadError
+			Expect(errors.As(<-errorChan, &manifestErr)).To(BeTrue())
+			Expect(manifestErr.Object).To(Equal("manifest"))
+			Expect(manifestErr.Number).To(Equal(uint(2)))
+		})
+	})
+	Describe("Gate", func() {
+		var (
+			chunks   chan FileChunk
+			failures chan FileChunk
+		)
+		BeforeEach(func() {
+			chunks = make(chan FileChunk)
+			failures = make(chan FileChunk)
+		})
+		It("Passes every chunk on once the input closes if none failed", func() {
+			passed, missing := Gate(chunks, failures)
+			chunks <- FileChunk{Number: 0}
+			chunks <- FileChunk{Number: 1}
+			Consistently(passed, 50*time.Millisecond).ShouldNot(Receive())
+			close(chunks)
+			var numbers []uint
+			for chunk := range passed {
+				numbers = append(numbers, chunk.Number)
+			}
+			Expect(numbers).To(Equal([]uint{0, 1}))
+			Expect(<-missing).To(BeEmpty())
+		})
+		It("Holds back every chunk and lists the failures if any chunk failed", func() {
+			passed, missing := Gate(chunks, failures)
+			chunks <- FileChunk{Number: 0}
+			failures <- FileChunk{Number: 3}
+			failures <- FileChunk{Number: 1}
+			close(chunks)
+			Expect(<-missing).To(Equal([]FileChunk{{Number: 1}, {Number: 3}}))
+			Eventually(passed).Should(BeClosed())
+		})
 	})
 })
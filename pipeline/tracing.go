@@ -0,0 +1,82 @@
+package pipeline
+
+import (
+	"context"
+	"errors"
+	"github.com/ibmjstart/swiftlygo/auth"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// TracerName is the name of the tracer that pipeline stages create spans with.
+const TracerName = "github.com/ibmjstart/swiftlygo/pipeline"
+
+// Attribute keys of the spans that pipeline stages create.
+const (
+	AttributeContainer  = attribute.Key("swiftlygo.container")
+	AttributeObject     = attribute.Key("swiftlygo.object")
+	AttributeNumber     = attribute.Key("swiftlygo.chunk.number")
+	AttributeSize       = attribute.Key("swiftlygo.chunk.size")
+	AttributeAttempt    = attribute.Key("swiftlygo.chunk.attempt")
+	AttributeEtag       = attribute.Key("swiftlygo.etag")
+	AttributeReadTime   = attribute.Key("swiftlygo.read.seconds")
+	AttributeWriteTime  = attribute.Key("swiftlygo.write.seconds")
+	AttributeStatusCode = attribute.Key("http.response.status_code")
+)
+
+// chunkContext returns the context of a chunk, which is the parent of the spans
+// for that chunk.
+func chunkContext(chunk FileChunk) context.Context {
+	if chunk.Context != nil {
+		return chunk.Context
+	}
+	return context.Background()
+}
+
+// createFile calls dest.CreateFileContext if dest supports it so that the
+// trace context of ctx is sent to object storage. If hash is not empty, it is
+// sent as the expected Etag of the object, and metadata is stored with the
+// object if dest supports it.
+func createFile(ctx context.Context, dest auth.Destination, container, object, hash string, metadata map[string]string) (auth.WriteCloseHeader, error) {
+	if metadataDest, ok := dest.(auth.MetadataDestination); ok && len(metadata) > 0 {
+		return metadataDest.CreateFileMetadata(ctx, container, object, true, hash, metadata)
+	}
+	if contextDest, ok := dest.(auth.ContextDestination); ok {
+		return contextDest.CreateFileContext(ctx, container, object, true, hash)
+	}
+	return dest.CreateFile(container, object, true, hash)
+}
+
+// createSLO calls dest.CreateSLOContext if dest supports it so that the trace
+// context of ctx is sent to object storage. The Checksums of the manifest are
+// stored as its metadata, along with metadata, if dest supports it.
+func createSLO(ctx context.Context, dest auth.Destination, manifest FileChunk, metadata map[string]string) error {
+	if metadataDest, ok := dest.(auth.MetadataDestination); ok && (len(manifest.Checksums) > 0 || len(metadata) > 0) {
+		all := ChecksumMetadata(manifest.Checksums)
+		if all == nil {
+			all = make(map[string]string)
+		}
+		for key, value := range metadata {
+			all[key] = value
+		}
+		return metadataDest.CreateSLOMetadata(ctx, manifest.Container, manifest.Object, manifest.Hash, manifest.Data, all)
+	}
+	if contextDest, ok := dest.(auth.ContextDestination); ok {
+		return contextDest.CreateSLOContext(ctx, manifest.Container, manifest.Object, manifest.Hash, manifest.Data)
+	}
+	return dest.CreateSLO(manifest.Container, manifest.Object, manifest.Hash, manifest.Data)
+}
+
+// endSpan records the outcome of an operation on its span and ends the span.
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		var statusErr *auth.HTTPStatusError
+		if errors.As(err, &statusErr) {
+			span.SetAttributes(AttributeStatusCode.Int(statusErr.Code))
+		}
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
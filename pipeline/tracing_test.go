@@ -0,0 +1,114 @@
+package pipeline_test
+
+import (
+	"context"
+	"github.com/ibmjstart/swiftlygo/auth/mock"
+	"github.com/mattetti/filebuffer"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+	"time"
+
+	. "github.com/ibmjstart/swiftlygo/pipeline"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+// attributes converts the attributes of a span into a map.
+func attributes(span sdktrace.ReadOnlySpan) map[attribute.Key]attribute.Value {
+	result := make(map[attribute.Key]attribute.Value)
+	for _, kv := range span.Attributes() {
+		result[kv.Key] = kv.Value
+	}
+	return result
+}
+
+var _ = Describe("Tracing", func() {
+	var (
+		maxAttempts uint
+		baseWait    time.Duration
+		recorder    *tracetest.SpanRecorder
+		provider    *sdktrace.TracerProvider
+		parent      context.Context
+		chunks      chan FileChunk
+		errs        chan error
+		source      *filebuffer.Buffer
+	)
+
+	BeforeEach(func() {
+		maxAttempts, baseWait = UploadMaxAttempts, UploadRetryBaseWait
+		UploadMaxAttempts, UploadRetryBaseWait = 1, 0
+		recorder = tracetest.NewSpanRecorder()
+		provider = sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+		parent, _ = provider.Tracer("test").Start(context.Background(), "parent")
+		chunks = make(chan FileChunk, 1)
+		errs = make(chan error, 10)
+		source = filebuffer.New([]byte("0123456789"))
+	})
+
+	AfterEach(func() {
+		UploadMaxAttempts, UploadRetryBaseWait = maxAttempts, baseWait
+	})
+
+	Context("When a chunk uploads", func() {
+		It("Should create a span for the attempt within the chunk's context", func() {
+			out := ReadHashAndUpload(chunks, errs, source, mock.NewBufferDestination(), WithTracerProvider(provider))
+			chunks <- FileChunk{Number: 4, Size: 10, Object: "object", Container: "container", Context: parent}
+			close(chunks)
+			chunk := <-out
+			spans := recorder.Ended()
+			Expect(spans).To(HaveLen(1))
+			Expect(spans[0].Name()).To(Equal("UploadChunk"))
+			Expect(spans[0].Parent().SpanID()).To(Equal(trace.SpanContextFromContext(parent).SpanID()))
+			Expect(attributes(spans[0])).To(And(
+				HaveKeyWithValue(AttributeNumber, attribute.Int64Value(4)),
+				HaveKeyWithValue(AttributeSize, attribute.Int64Value(10)),
+				HaveKeyWithValue(AttributeAttempt, attribute.Int64Value(1)),
+				HaveKeyWithValue(AttributeEtag, attribute.StringValue(chunk.Hash)),
+				HaveKey(AttributeReadTime),
+				HaveKey(AttributeWriteTime),
+			))
+			Expect(spans[0].Status().Code).To(Equal(codes.Unset))
+		})
+	})
+	Context("When a chunk fails", func() {
+		It("Should end each attempt's span with an error", func() {
+			out := ReadHashAndUpload(chunks, errs, source, mock.NewErrorDestination(), WithTracerProvider(provider))
+			chunks <- FileChunk{Number: 4, Size: 10, Object: "object", Container: "container", Context: parent}
+			close(chunks)
+			for range out {
+			}
+			spans := recorder.Ended()
+			Expect(spans).To(HaveLen(2))
+			for i, span := range spans {
+				Expect(attributes(span)).To(HaveKeyWithValue(AttributeAttempt, attribute.Int64Value(int64(i+1))))
+				Expect(span.Status().Code).To(Equal(codes.Error))
+				Expect(span.Events()).NotTo(BeEmpty())
+			}
+		})
+	})
+	Context("When a manifest uploads", func() {
+		It("Should create a span for the manifest", func() {
+			manifests := make(chan FileChunk, 1)
+			manifests <- FileChunk{Number: 0, Object: "manifest", Container: "container", Hash: "etag", Data: []byte("[]"), Context: parent}
+			close(manifests)
+			for range UploadManifests(manifests, errs, mock.NewNullDestination(), WithTracerProvider(provider)) {
+			}
+			spans := recorder.Ended()
+			Expect(spans).To(HaveLen(1))
+			Expect(spans[0].Name()).To(Equal("UploadManifest"))
+			Expect(spans[0].Parent().SpanID()).To(Equal(trace.SpanContextFromContext(parent).SpanID()))
+			Expect(attributes(spans[0])).To(HaveKeyWithValue(AttributeEtag, attribute.StringValue("etag")))
+		})
+	})
+	Context("When manifests are built", func() {
+		It("Should keep the context of their chunks", func() {
+			chunks <- FileChunk{Number: 0, Size: 10, Object: "object", Container: "container", Context: parent}
+			close(chunks)
+			manifest := <-ManifestBuilder(chunks, errs)
+			Expect(manifest.Context).To(Equal(parent))
+		})
+	})
+})
@@ -1,12 +1,15 @@
 package pipeline
 
 import (
+	"context"
 	"crypto/md5"
 	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"github.com/ibmjstart/swiftlygo/auth"
+	"go.opentelemetry.io/otel/trace"
 	"io"
+	"io/ioutil"
 	"strings"
 	"time"
 )
@@ -61,7 +64,7 @@ func ReadData(chunks <-chan FileChunk, errors chan<- error, dataSource io.Reader
 	var dataBuffer []byte
 	return Map(chunks, errors, func(chunk FileChunk) (FileChunk, error) {
 		if chunk.Size < 1 {
-			return chunk, fmt.Errorf("ReadData needs chunks with the Size and Number properties set. Encountered chunk %d with no size", chunk.Number)
+			return chunk, &InvalidChunkError{Stage: "ReadData", Number: chunk.Number, Reason: "with no size"}
 		}
 		dataBuffer = make([]byte, chunk.Size)
 		bytesRead, err := dataSource.ReadAt(dataBuffer, int64(chunk.Offset))
@@ -103,7 +106,7 @@ func Containerizer(chunks <-chan FileChunk, errors chan<- error, container strin
 func HashData(chunks <-chan FileChunk, errors chan<- error) <-chan FileChunk {
 	return Map(chunks, errors, func(chunk FileChunk) (FileChunk, error) {
 		if len(chunk.Data) < 1 {
-			return chunk, fmt.Errorf("Chunks should have data before being hashed, chunk %d lacks data", chunk.Number)
+			return chunk, &InvalidChunkError{Stage: "HashData", Number: chunk.Number, Reason: "with no data"}
 		}
 		sum := md5.Sum(chunk.Data)
 		chunk.Hash = hex.EncodeToString(sum[:])
@@ -115,48 +118,55 @@ func HashData(chunks <-chan FileChunk, errors chan<- error) <-chan FileChunk {
 // the objects in their Container with their Object name and checks the md5 of the upload,
 // retrying on failure. It requires all fields of the FileChunk to be filled out before
 // attempting an upload, and will send errors if it encountes FileChunks with missing
-// fields. The retry wait is the base wait before a retry is attempted.
+// fields. Unless a RetryPolicy is given with WithRetryPolicy, it makes up to 5 attempts
+// and the retry wait is the base wait before a retry is attempted.
 //
 // Deprecated: This consumes unnecessary memory. Use ReadHashAndUpload instead.
-func UploadData(chunks <-chan FileChunk, errors chan<- error, dest auth.Destination, retryWait time.Duration) <-chan FileChunk {
-	const maxAttempts = 5
+func UploadData(chunks <-chan FileChunk, errors chan<- error, dest auth.Destination, retryWait time.Duration, opts ...Option) <-chan FileChunk {
+	opts = append([]Option{WithRetryPolicy(ExponentialBackoff{
+		Attempts:  5,
+		BaseDelay: retryWait,
+		MaxDelay:  UploadRetryMaxWait,
+	})}, opts...)
+	settings := newSettings(opts)
 	dataChunks := make(chan FileChunk)
 	// attempt makes a single pass at uploading the data from a chunk and returns an error
 	// if it fails.
 	attempt := func(chunk *FileChunk) error {
 		upload, err := dest.CreateFile(chunk.Container, chunk.Object, true, chunk.Hash)
 		if err != nil {
-			return fmt.Errorf("Err creating upload for chunk %d: %s", chunk.Number, err)
+			return fmt.Errorf("Err creating upload: %w", err)
 		}
 		written, err := upload.Write(chunk.Data)
 		if err != nil {
-			return fmt.Errorf("Err uploading data for chunk %d: %s", chunk.Number, err)
+			return fmt.Errorf("Err uploading data: %w", err)
 		}
 		if uint(written) != chunk.Size {
-			return fmt.Errorf("Problem uploading chunk %d, uploaded %d bytes but chunk is %d bytes long", chunk.Number, written, chunk.Size)
+			return fmt.Errorf("Uploaded %d bytes but chunk is %d bytes long", written, chunk.Size)
 		}
 		err = upload.Close()
 		if err != nil {
-			return fmt.Errorf("Err closing upload for chunk %d: %s", chunk.Number, err)
+			return fmt.Errorf("Err closing upload: %w", err)
 		}
 		return nil
 	}
-	// retry reattempts uploads on an exponential backoff and aggregates the
-	// errors that occur. If all upload attempts fail, all errors are concatenated
-	// together and sent. If the retryWait parameter of UploadData is set to zero,
-	// there is no wait between retries (this is useful for testing).
+	// retry reattempts uploads according to the retry policy and sends the
+	// errors that occur. If the upload is not retried after a failure, it also
+	// sends an error saying that the final attempt failed. If the retryWait
+	// parameter of UploadData is set to zero, there is no wait between retries
+	// (this is useful for testing).
 	retry := func(chunk *FileChunk) {
 		defer func() {
 			chunk.Data = nil // Garbage-collect the data
 		}()
 		var sleep uint = 1
 		for err := attempt(chunk); err != nil; sleep++ { // retry
-			errors <- err
-			if sleep >= maxAttempts {
+			errors <- &ChunkUploadError{Number: chunk.Number, Object: chunk.Object, Attempt: sleep, Err: err}
+			if !willRetry(settings.retry, sleep, err) {
 				errors <- fmt.Errorf("Final upload attempt for chunk %d failed after %d retries ", chunk.Number, sleep)
 				return
 			}
-			time.Sleep(retryWait * (1 << sleep))
+			time.Sleep(settings.retry.Delay(sleep, err))
 			err = attempt(chunk)
 		}
 	}
@@ -166,7 +176,7 @@ func UploadData(chunks <-chan FileChunk, errors chan<- error, dest auth.Destinat
 			if chunk.Size < 1 || uint(len(chunk.Data)) != chunk.Size ||
 				chunk.Object == "" || chunk.Container == "" || chunk.Hash == "" {
 
-				errors <- fmt.Errorf("Chunk %d is missing required data", chunk.Number)
+				errors <- &InvalidChunkError{Stage: "UploadData", Number: chunk.Number, Reason: "with missing required data"}
 				continue
 			}
 			retry(&chunk)
@@ -206,9 +216,13 @@ func ManifestBuilder(chunks <-chan FileChunk, errors chan<- error) <-chan FileCh
 			} else {
 				data = masterManifest[i*1000 : (i+1)*1000]
 			}
+			var ctx context.Context
 			for _, chunk := range data {
 				etags += chunk.Hash
 				apparentSize += chunk.Size
+				if ctx == nil {
+					ctx = chunk.Context
+				}
 			}
 			sum := md5.Sum([]byte(etags))
 			json, err := json.Marshal(data)
@@ -217,10 +231,11 @@ func ManifestBuilder(chunks <-chan FileChunk, errors chan<- error) <-chan FileCh
 				continue
 			}
 			manifestOut <- FileChunk{
-				Hash:   hex.EncodeToString(sum[:]),
-				Number: uint(i),
-				Data:   json,
-				Size:   apparentSize,
+				Hash:    hex.EncodeToString(sum[:]),
+				Number:  uint(i),
+				Data:    json,
+				Size:    apparentSize,
+				Context: ctx,
 			}
 		}
 	}()
@@ -228,13 +243,53 @@ func ManifestBuilder(chunks <-chan FileChunk, errors chan<- error) <-chan FileCh
 }
 
 // UploadManifests treats the incoming FileChunks as manifests and uploads them with the special
-// SLO manifest headers.
-func UploadManifests(manifests <-chan FileChunk, errors chan<- error, dest auth.Destination) <-chan FileChunk {
+// SLO manifest headers. With WithCompression and without WithEncryption, manifests are marked as
+// compressed, since their data decompresses as a single stream.
+func UploadManifests(manifests <-chan FileChunk, errors chan<- error, dest auth.Destination, opts ...Option) <-chan FileChunk {
+	settings := newSettings(opts)
+	log := settings.logger
+	var metadata map[string]string
+	if settings.compression != nil && settings.keys == nil {
+		metadata = map[string]string{MetadataCompression: settings.compression.Name}
+	}
 	return Map(manifests, errors, func(manifest FileChunk) (FileChunk, error) {
-		err := dest.CreateSLO(manifest.Container, manifest.Object, manifest.Hash, manifest.Data)
+		log.Info("Uploading manifest", "manifest", manifest.Number, "object", manifest.Object)
+		var (
+			started time.Time
+			err     error
+		)
+		for attempt := uint(1); true; attempt++ {
+			started = time.Now()
+			ctx, span := settings.tracer.Start(chunkContext(manifest), "UploadManifest", trace.WithAttributes(
+				AttributeContainer.String(manifest.Container),
+				AttributeObject.String(manifest.Object),
+				AttributeNumber.Int64(int64(manifest.Number)),
+				AttributeSize.Int64(int64(len(manifest.Data))),
+				AttributeAttempt.Int64(int64(attempt)),
+				AttributeEtag.String(manifest.Hash),
+			))
+			err = createSLO(ctx, dest, manifest, metadata)
+			endSpan(span, err)
+			if err == nil || !willRetry(settings.retry, attempt, err) {
+				break
+			}
+			log.Warn("Manifest upload attempt failed", "manifest", manifest.Number, "object", manifest.Object,
+				"attempt", attempt, "error", err)
+			time.Sleep(settings.retry.Delay(attempt, err))
+		}
 		if err != nil {
-			return manifest, fmt.Errorf("Problem uploading manifest file: %s", err)
+			log.Error("Manifest upload failed", "manifest", manifest.Number, "object", manifest.Object, "error", err)
+			return manifest, &ManifestUploadError{Number: manifest.Number, Object: manifest.Object, Err: err}
 		}
+		duration := time.Since(started)
+		log.Debug("Uploaded manifest", "manifest", manifest.Number, "object", manifest.Object,
+			"bytes", len(manifest.Data), "duration", duration)
+		settings.observers.OnEvent(ManifestUploaded{
+			Number:   manifest.Number,
+			Object:   manifest.Object,
+			Bytes:    uint(len(manifest.Data)),
+			Duration: duration,
+		})
 		return manifest, nil
 	})
 }
@@ -288,69 +343,195 @@ func Counter(chunks <-chan FileChunk) (<-chan FileChunk, <-chan Count) {
 // some experimentation may be needed to find an optimal value.
 var UploadBufferSize uint = 1024 * 4
 
-// UploadMaxAttempts is the number of times that each ReadHashAndUpload goroutine will
-// retry a failing upload before moving on to the next one.
+// UploadMaxAttempts is the number of times that the default RetryPolicy will retry a
+// failing upload before moving on to the next one.
 var UploadMaxAttempts uint = 5
 
-// UploadRetryBaseWait is the shortest time unit that each ReadHashAndUpload goroutine will
-// wait between upload attempts.
+// UploadRetryBaseWait is the time unit from which the default RetryPolicy backs off
+// between upload attempts.
 var UploadRetryBaseWait time.Duration = time.Second
 
+// abortUpload stops an upload that will not be finished, so that its request
+// and connection are released. Uploads that cannot be aborted are closed.
+func abortUpload(upload auth.WriteCloseHeader, cause error) {
+	if aborter, ok := upload.(interface{ CloseWithError(error) error }); ok {
+		_ = aborter.CloseWithError(cause)
+		return
+	}
+	_ = upload.Close()
+}
+
 // ReadHashAndUpload reads the data, performs the hash, and uploads it. Its monolithic design isn't very
 // modular, but it reads the file and discards the data within a single function, which saves a lot of
 // memory. Use this if memory footprint is a major concern.
 // ReadHashAndUpload requires that incoming chunks have the Size, Number, Offset, Object, and Container
-// properties already set.
-func ReadHashAndUpload(chunks <-chan FileChunk, errors chan<- error, dataSource io.ReaderAt, dest auth.Destination) <-chan FileChunk {
+// properties already set. It computes the MD5 sum of each chunk as it sends it, and retries the chunk
+// with an EtagMismatchError if object storage returns a different Etag. Chunks that fail every
+// attempt allowed by the RetryPolicy are not passed on; they are reported as a ChunkUploadError and
+// sent to the dead-letter channel given with WithDeadLetters, if any. Attempts that are retried are
+// only logged and reported to observers as ChunkRetried events. Chunks compressed with WithCompression or encrypted with WithEncryption
+// leave with the Size of the data stored, and their original Size in SourceSize.
+func ReadHashAndUpload(chunks <-chan FileChunk, errors chan<- error, dataSource io.ReaderAt, dest auth.Destination, opts ...Option) <-chan FileChunk {
+	settings := newSettings(opts)
+	log := settings.logger
 	// Pre-allocate variables to reduce memory overhead
 	var (
 		dataBuffer = make([]byte, UploadBufferSize)
 		upload     auth.WriteCloseHeader
 		err        error
 	)
-	return Map(chunks, errors, func(chunk FileChunk) (FileChunk, error) {
+	_, storesMetadata := dest.(auth.MetadataDestination)
+	storeChecksums := len(settings.checksums) > 0 && storesMetadata
+	// Whether chunks are stored differently from how they are read
+	transforms := settings.compression != nil || settings.keys != nil
+	// uploadChunk uploads a chunk and reports whether it succeeded
+	uploadChunk := func(chunk FileChunk) (FileChunk, bool, error) {
+		var (
+			started             time.Time
+			span                trace.Span
+			readTime, writeTime time.Duration
+			attempts            uint
+			retrying            bool
+			expected            string            // the Etag sent with the upload, if any
+			metadata            map[string]string // the checksums, compression and encryption sent with the upload, if any
+			encrypted           *encryption
+			pending             auth.WriteCloseHeader // the upload of the current attempt, until it is closed
+		)
+		// failed records and reports a failed upload attempt. Attempts that will be
+		// retried are only logged and observed, since they may yet succeed
+		failed := func(attempt uint, format string, cause error) {
+			err = fmt.Errorf(format, cause)
+			retrying = willRetry(settings.retry, attempt+1, err)
+			settings.adaptive.Release(0, time.Since(started), err)
+			span.SetAttributes(AttributeReadTime.Float64(readTime.Seconds()), AttributeWriteTime.Float64(writeTime.Seconds()))
+			endSpan(span, err)
+			if pending != nil {
+				abortUpload(pending, err)
+				pending = nil
+			}
+			log.Warn("Chunk upload attempt failed", "chunk", chunk.Number, "object", chunk.Object,
+				"attempt", attempt+1, "duration", time.Since(started), "error", err)
+			if retrying {
+				settings.observers.OnEvent(ChunkRetried{Number: chunk.Number, Object: chunk.Object, Attempt: attempt + 1, Err: err})
+			}
+		}
 		// Reject invalid chunks
 		switch {
 		case chunk.Size < 1:
-			return chunk, fmt.Errorf("ReadHashAndUpload needs chunks with the Size and Number properties set. Encountered chunk %d with no size", chunk.Number)
+			return chunk, false, &InvalidChunkError{Stage: "ReadHashAndUpload", Number: chunk.Number, Reason: "with no size"}
 		case chunk.Object == "":
-			return chunk, fmt.Errorf("ReadHashAndUpload encountered chunk %d with no Object Name", chunk.Number)
+			return chunk, false, &InvalidChunkError{Stage: "ReadHashAndUpload", Number: chunk.Number, Reason: "with no Object Name"}
 		case chunk.Container == "":
-			return chunk, fmt.Errorf("ReadHashAndUpload encountered chunk %d with no Container Name", chunk.Number)
+			return chunk, false, &InvalidChunkError{Stage: "ReadHashAndUpload", Number: chunk.Number, Reason: "with no Container Name"}
+		case transforms && !storesMetadata:
+			// Encrypted and compressed chunks need metadata to describe how to read them
+			return chunk, false, &InvalidChunkError{Stage: "ReadHashAndUpload", Number: chunk.Number, Reason: "that cannot be compressed or encrypted because the destination cannot store metadata"}
 		}
 
-		// Loop until an upload succeeds
+		// Loop until an upload succeeds or the retry policy gives up
 	RetryLoop:
-		for attempts := uint(0); true; attempts++ {
-			// Exit loop if we retry the max times or if we succeed
-			if attempts > UploadMaxAttempts {
-				break RetryLoop
-			} else if attempts > 0 {
-				if err != nil {
-					time.Sleep(UploadRetryBaseWait << attempts)
-				} else {
+		for attempts = 0; true; attempts++ {
+			if attempts > 0 {
+				if !retrying {
 					break RetryLoop
 				}
+				time.Sleep(settings.retry.Delay(attempts, err))
 			}
+			retrying = false
 
 			// Track how many bytes that we've read for the current chunk
 			var bytesReadTotal int64
+			settings.adaptive.Acquire()
+			started = time.Now()
+			readTime, writeTime = 0, 0
+			var ctx context.Context
+			ctx, span = settings.tracer.Start(chunkContext(chunk), "UploadChunk", trace.WithAttributes(
+				AttributeContainer.String(chunk.Container),
+				AttributeObject.String(chunk.Object),
+				AttributeNumber.Int64(int64(chunk.Number)),
+				AttributeSize.Int64(int64(chunk.Size)),
+				AttributeAttempt.Int64(int64(attempts+1)),
+			))
+			log.Debug("Uploading chunk", "chunk", chunk.Number, "object", chunk.Object, "attempt", attempts+1)
+			settings.observers.OnEvent(ChunkStarted{Number: chunk.Number, Object: chunk.Object, Attempt: attempts + 1})
+
+			// Encrypt every attempt with a new nonce
+			expected, metadata = "", make(map[string]string)
+			if settings.keys != nil {
+				encrypted, err = newEncryption(settings.keys)
+				if err != nil {
+					failed(attempts, "Error preparing encryption: %w", err)
+					continue RetryLoop
+				}
+				for key, value := range encrypted.metadata {
+					metadata[key] = value
+				}
+			}
+			if settings.compression != nil {
+				for key, value := range compressionMetadata(settings.compression, chunk) {
+					metadata[key] = value
+				}
+			}
+
+			// Object storage takes the expected Etag and metadata before the data,
+			// so hash the chunk in a first pass if either is to be sent
+			if settings.precompute || storeChecksums {
+				first := newDigests(settings.checksums)
+				var w io.Writer = first
+				var stored *storedWriter
+				if transforms {
+					if stored, err = newStoredWriter(ioutil.Discard, settings.compression, encrypted); err != nil {
+						failed(attempts, "Error preparing compression: %w", err)
+						continue RetryLoop
+					}
+					w = io.MultiWriter(first, stored)
+				}
+				if readErr := readChunk(dataSource, chunk, dataBuffer, w); readErr != nil {
+					failed(attempts, "Error reading data: %w", readErr)
+					continue RetryLoop
+				}
+				expected = first.etag()
+				if stored != nil {
+					if err = stored.Close(); err != nil {
+						failed(attempts, "Error compressing data: %w", err)
+						continue RetryLoop
+					}
+					expected = stored.etag()
+				}
+				for key, value := range ChecksumMetadata(first.sums()) {
+					metadata[key] = value
+				}
+			}
 
 			// Create the upload for this chunk. Ask the uploader to check the MD5 sum
-			// itself. We will also compute it because we have no way to access the
-			// one that the upload computes internally, and we need it to generate
-			// the manifest file
-			upload, err = dest.CreateFile(chunk.Container, chunk.Object, true, "")
+			// itself. We also compute it while streaming so that we can check the
+			// Etag that object storage returns, and we need it to generate the
+			// manifest file
+			upload, err = createFile(ctx, dest, chunk.Container, chunk.Object, expected, metadata)
 			if err != nil {
-				errors <- fmt.Errorf("ReadHashAndUpload encountered an error trying to initialize the upload for chunk %d: %s", chunk.Number, err)
+				failed(attempts, "Error initializing upload: %w", err)
 				continue RetryLoop
 			}
+			pending = upload
+			// The checksums describe the data read, and the Etag the data stored
+			sums := newDigests(settings.checksums)
+			var body io.Writer = limitedWriter{w: upload, limiter: settings.limiter}
+			var stored *storedWriter
+			if transforms {
+				if stored, err = newStoredWriter(body, settings.compression, encrypted); err != nil {
+					failed(attempts, "Error preparing compression: %w", err)
+					continue RetryLoop
+				}
+				body = stored
+			}
 
 			// Loop until we've read all of the bytes for this chunk
 			for uint(bytesReadTotal) < chunk.Size {
-				bytesRead, err := dataSource.ReadAt(dataBuffer, int64(chunk.Offset)+bytesReadTotal)
-				if err != nil && err != io.EOF {
-					errors <- fmt.Errorf("Error reading chunk %d: %s", chunk.Number, err)
+				readStarted := time.Now()
+				bytesRead, readErr := dataSource.ReadAt(dataBuffer, int64(chunk.Offset)+bytesReadTotal)
+				readTime += time.Since(readStarted)
+				if readErr != nil && readErr != io.EOF {
+					failed(attempts, "Error reading data: %w", readErr)
 					continue RetryLoop
 				}
 				chunkEndDepth := int64(bytesRead)
@@ -360,29 +541,114 @@ func ReadHashAndUpload(chunks <-chan FileChunk, errors chan<- error, dataSource
 					chunkEndDepth = bytesRemaining
 				}
 
-				_, err = upload.Write(dataBuffer[:chunkEndDepth]) // Add data to running upload
+				writeStarted := time.Now()
+				sums.Write(dataBuffer[:chunkEndDepth])
+				_, err = body.Write(dataBuffer[:chunkEndDepth]) // Add data to running upload
+				writeTime += time.Since(writeStarted)
 				if err != nil {
-					errors <- fmt.Errorf("Error uploading chunk %d: %s", chunk.Number, err)
+					failed(attempts, "Error uploading data: %w", err)
 					continue RetryLoop
 				}
 
 				// Update the total bytes read
 				bytesReadTotal += int64(bytesRead)
+				settings.observers.OnEvent(ChunkProgress{
+					Number:  chunk.Number,
+					Object:  chunk.Object,
+					Attempt: attempts + 1,
+					Bytes:   min(uint(bytesReadTotal), chunk.Size),
+				})
 			}
 			// Finalize upload
+			writeStarted := time.Now()
+			if stored != nil {
+				if err = stored.Close(); err != nil {
+					failed(attempts, "Error uploading data: %w", err)
+					continue RetryLoop
+				}
+			}
+			pending = nil
 			err = upload.Close()
+			writeTime += time.Since(writeStarted)
 			if err != nil {
-				errors <- fmt.Errorf("Error closing upload for chunk %d: %s", chunk.Number, err)
+				failed(attempts, "Error closing upload: %w", err)
 				continue RetryLoop
 			}
 			// Get final hash for data
-			headers, err := upload.Headers()
-			if err != nil {
-				errors <- fmt.Errorf("Unable to get object headers, can't get hash for chunk %d: %s", chunk.Number, err)
+			headers, headersErr := upload.Headers()
+			if headersErr != nil {
+				failed(attempts, "Unable to get object headers, can't get hash: %w", headersErr)
 				continue RetryLoop
 			}
-			chunk.Hash = headers["Etag"]
+			etag := sums.etag()
+			if stored != nil {
+				etag = stored.etag()
+			}
+			if expected != "" && etag != expected {
+				failed(attempts, "Data changed during upload: %w", &EtagMismatchError{Object: chunk.Object, Expected: expected, Actual: etag})
+				continue RetryLoop
+			}
+			if serverEtag := normalizeEtag(headers["Etag"]); serverEtag != "" && serverEtag != etag {
+				failed(attempts, "Upload was corrupted: %w", &EtagMismatchError{Object: chunk.Object, Expected: etag, Actual: serverEtag})
+				continue RetryLoop
+			}
+			chunk.Hash = etag
+			chunk.Checksums = sums.sums()
+			span.SetAttributes(
+				AttributeEtag.String(chunk.Hash),
+				AttributeReadTime.Float64(readTime.Seconds()),
+				AttributeWriteTime.Float64(writeTime.Seconds()),
+			)
+			endSpan(span, nil)
+			duration := time.Since(started)
+			settings.adaptive.Release(chunk.Size, duration, nil)
+			log.Info("Uploaded chunk", "chunk", chunk.Number, "object", chunk.Object, "attempt", attempts+1,
+				"bytes", chunk.Size, "duration", duration)
+			settings.observers.OnEvent(ChunkCompleted{
+				Number:   chunk.Number,
+				Object:   chunk.Object,
+				Attempt:  attempts + 1,
+				Etag:     chunk.Hash,
+				Bytes:    chunk.Size,
+				Duration: duration,
+			})
+			if stored != nil {
+				// The manifest must refer to the size of the data stored
+				chunk.SourceSize, chunk.Size = chunk.Size, stored.size()
+			}
 		}
-		return chunk, nil
-	})
+		if err != nil {
+			log.Error("Giving up on chunk", "chunk", chunk.Number, "object", chunk.Object, "error", err)
+			settings.observers.OnEvent(ChunkFailed{
+				Number:   chunk.Number,
+				Object:   chunk.Object,
+				Attempts: attempts,
+				Bytes:    chunk.Size,
+				Err:      err,
+			})
+			errors <- &ChunkUploadError{
+				Number:  chunk.Number,
+				Object:  chunk.Object,
+				Attempt: attempts,
+				Err:     err,
+			}
+			return chunk, false, nil
+		}
+		return chunk, true, nil
+	}
+	uploaded := make(chan FileChunk)
+	go func() {
+		defer close(uploaded)
+		for chunk := range chunks {
+			chunk, ok, err := uploadChunk(chunk)
+			if err != nil {
+				errors <- err
+			} else if ok {
+				uploaded <- chunk
+			} else if settings.deadLetters != nil {
+				settings.deadLetters <- chunk
+			}
+		}
+	}()
+	return uploaded
 }
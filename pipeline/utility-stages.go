@@ -1,6 +1,9 @@
 package pipeline
 
-import "sync"
+import (
+	"sort"
+	"sync"
+)
 
 // Map applies the provided operation to each chunk that passes through it. It sends errors from
 // the operation to the errors channel, and will not send on a FileChunk that caused an error in
@@ -59,6 +62,51 @@ func Separate(chunks <-chan FileChunk, errors chan<- error, condition func(FileC
 	return a, b
 }
 
+// Gate holds back every chunk from its input until the input closes, and then
+// passes them all on only if no chunk arrived on failures in the meantime. The
+// second output receives the failed chunks, sorted by Number, or nil if there
+// were none, once the input has closed. Gate protects stages like
+// ManifestBuilder from building on an incomplete set of chunks.
+//
+// Every send on failures must happen before the input closes, as it does when
+// failures is the dead-letter channel of a ReadHashAndUpload stage upstream.
+func Gate(chunks <-chan FileChunk, failures <-chan FileChunk) (<-chan FileChunk, <-chan []FileChunk) {
+	passed := make(chan FileChunk)
+	failed := make(chan []FileChunk, 1)
+	go func() {
+		defer close(passed)
+		defer close(failed)
+		var held, missing []FileChunk
+		for chunks != nil {
+			select {
+			case chunk, ok := <-chunks:
+				if !ok {
+					chunks = nil
+					break
+				}
+				held = append(held, chunk)
+			case chunk, ok := <-failures:
+				if !ok {
+					failures = nil
+					break
+				}
+				missing = append(missing, chunk)
+			}
+		}
+		sort.Slice(missing, func(i, j int) bool {
+			return missing[i].Number < missing[j].Number
+		})
+		failed <- missing
+		if len(missing) > 0 {
+			return
+		}
+		for _, chunk := range held {
+			passed <- chunk
+		}
+	}()
+	return passed, failed
+}
+
 // Fork copies the input to two output channels, allowing a pipeline to
 // diverge.
 func Fork(chunks <-chan FileChunk) (<-chan FileChunk, <-chan FileChunk) {
@@ -76,7 +124,9 @@ func Fork(chunks <-chan FileChunk) (<-chan FileChunk, <-chan FileChunk) {
 }
 
 // Divide distributes the input channel across divisor new channels, which
-// are returned in a slice.
+// are returned in a slice. Chunks are assigned in turn, so a slow consumer of
+// one channel delays every chunk assigned to it. Use Parallel to process
+// chunks with whichever consumer is idle.
 func Divide(chunks <-chan FileChunk, divisor uint) []chan FileChunk {
 	chans := make([]chan FileChunk, divisor)
 	for i := range chans {
@@ -97,6 +147,25 @@ func Divide(chunks <-chan FileChunk, divisor uint) []chan FileChunk {
 	return chans
 }
 
+// Stage is the signature of a pipeline stage that is configured apart from its
+// input and errors, such as a closure around ReadHashAndUpload.
+type Stage func(chunks <-chan FileChunk, errors chan<- error) <-chan FileChunk
+
+// Parallel runs n copies of stage that all receive from chunks, so that each
+// chunk is taken by the next copy to become idle rather than waiting behind a
+// slow one, and joins their output. Chunks may leave in a different order than
+// they arrived.
+func Parallel(chunks <-chan FileChunk, errors chan<- error, n uint, stage Stage) <-chan FileChunk {
+	if n < 1 {
+		n = 1
+	}
+	outputs := make([]<-chan FileChunk, n)
+	for i := range outputs {
+		outputs[i] = stage(chunks, errors)
+	}
+	return Join(outputs...)
+}
+
 // Join performs a fan-in on the many input channels to combine their
 // data into output channel.
 func Join(chans ...<-chan FileChunk) <-chan FileChunk {
@@ -0,0 +1,199 @@
+package swiftlygo
+
+import (
+	"github.com/ibmjstart/swiftlygo/pipeline"
+	"sort"
+	"sync"
+	"time"
+)
+
+// ChunkReport describes how one chunk of the source file was uploaded to the
+// segment named Name in Container. Etag is empty if the chunk failed to upload,
+// and Checksums holds any checksums given with WithChecksums. StoredSize is the
+// size of the chunk's segment if it differs from Size because the chunk was
+// compressed or encrypted. Attempts and Duration are zero for chunks that were
+// skipped because they were already in object storage, and Duration covers only
+// the successful attempt.
+type ChunkReport struct {
+	Number     uint              `json:"number"`
+	Container  string            `json:"container"`
+	Name       string            `json:"name"`
+	Offset     uint              `json:"offset"`
+	Size       uint              `json:"size"`
+	StoredSize uint              `json:"stored_size,omitempty"`
+	Etag       string            `json:"etag"`
+	Checksums  map[string]string `json:"checksums,omitempty"`
+	Attempts   uint              `json:"attempts"`
+	Duration   time.Duration     `json:"duration_ns"`
+	Skipped    bool              `json:"skipped"`
+}
+
+// ManifestReport describes an uploaded SLO manifest, named Name in Container.
+// Size is the amount of data that the manifest refers to, not the size of the
+// manifest itself. The top-level manifest has the Checksums of the whole file.
+type ManifestReport struct {
+	Container string            `json:"container"`
+	Name      string            `json:"name"`
+	Etag      string            `json:"etag"`
+	Size      uint              `json:"size"`
+	Checksums map[string]string `json:"checksums,omitempty"`
+}
+
+// UploadReport is a machine-readable summary of a finished upload, returned by
+// SloUploader.Report. It contains enough information to verify the uploaded
+// object or to assemble it again from its chunks. Chunks are sorted by number,
+// and the top-level manifest is the last of the Manifests. UploadedBytes
+// excludes skipped chunks, and BytesPerSecond is the rate at which they were
+// uploaded over the WallTime of the upload.
+type UploadReport struct {
+	Container      string           `json:"container"`
+	Object         string           `json:"object"`
+	Chunks         []ChunkReport    `json:"chunks"`
+	Manifests      []ManifestReport `json:"manifests"`
+	SkippedChunks  []string         `json:"skipped_chunks"`
+	TotalBytes     uint             `json:"total_bytes"`
+	UploadedBytes  uint             `json:"uploaded_bytes"`
+	Started        time.Time        `json:"started"`
+	WallTime       time.Duration    `json:"wall_time_ns"`
+	BytesPerSecond float64          `json:"bytes_per_second"`
+	Errors         []string         `json:"errors,omitempty"`
+}
+
+// Index returns the pipeline.SeekIndex of the chunks that were uploaded or
+// skipped, for reading parts of a compressed upload with
+// pipeline.NewIndexedReader.
+func (r *UploadReport) Index() pipeline.SeekIndex {
+	var chunks []pipeline.FileChunk
+	for _, chunk := range r.Chunks {
+		if chunk.Etag == "" {
+			continue
+		}
+		// Reports written before chunks recorded their container kept them
+		// with the object
+		container := chunk.Container
+		if container == "" {
+			container = r.Container
+		}
+		uploaded := pipeline.FileChunk{Container: container, Object: chunk.Name, Offset: chunk.Offset, Size: chunk.Size}
+		if chunk.StoredSize != 0 {
+			uploaded.SourceSize, uploaded.Size = chunk.Size, chunk.StoredSize
+		}
+		chunks = append(chunks, uploaded)
+	}
+	return pipeline.NewSeekIndex(chunks)
+}
+
+// reporter collects the UploadReport of an upload from the chunks and manifests
+// that pass through the pipeline and from the upload's events.
+type reporter struct {
+	lock      sync.Mutex
+	chunks    map[uint]*ChunkReport
+	manifests []ManifestReport
+}
+
+func newReporter() *reporter {
+	return &reporter{chunks: make(map[uint]*ChunkReport)}
+}
+
+// chunk returns the report for the chunk with the given number. The lock must
+// be held.
+func (r *reporter) chunk(number uint) *ChunkReport {
+	report, ok := r.chunks[number]
+	if !ok {
+		report = &ChunkReport{Number: number}
+		r.chunks[number] = report
+	}
+	return report
+}
+
+// recordChunk is a pipeline operation that records the name and location of
+// chunks, and their etag if they have one.
+func (r *reporter) recordChunk(chunk pipeline.FileChunk) (pipeline.FileChunk, error) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	report := r.chunk(chunk.Number)
+	report.Container = chunk.Container
+	report.Name = chunk.Object
+	report.Offset = chunk.Offset
+	report.Size = chunk.Size
+	if chunk.SourceSize != 0 {
+		report.Size, report.StoredSize = chunk.SourceSize, chunk.Size
+	}
+	if chunk.Hash != "" {
+		report.Etag = chunk.Hash
+	}
+	if chunk.Checksums != nil {
+		report.Checksums = chunk.Checksums
+	}
+	return chunk, nil
+}
+
+// recordManifest is a pipeline operation that records uploaded manifests.
+func (r *reporter) recordManifest(manifest pipeline.FileChunk) (pipeline.FileChunk, error) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.manifests = append(r.manifests, ManifestReport{
+		Container: manifest.Container,
+		Name:      manifest.Object,
+		Etag:      manifest.Hash,
+		Size:      manifest.Size,
+		Checksums: manifest.Checksums,
+	})
+	return manifest, nil
+}
+
+// OnEvent records the attempts and durations of chunk uploads.
+func (r *reporter) OnEvent(event pipeline.Event) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	switch event := event.(type) {
+	case pipeline.ChunkStarted:
+		r.chunk(event.Number).Attempts = event.Attempt
+	case pipeline.ChunkCompleted:
+		r.chunk(event.Number).Duration = event.Duration
+	case pipeline.ChunkFailed:
+		r.chunk(event.Number).Attempts = event.Attempts
+	case pipeline.ChunkSkipped:
+		r.chunk(event.Number).Skipped = true
+	}
+}
+
+// report builds the UploadReport of an upload that began at started and
+// encountered failures.
+func (r *reporter) report(container, object string, size uint, started time.Time, failures []error) *UploadReport {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	report := &UploadReport{
+		Container:     container,
+		Object:        object,
+		Chunks:        make([]ChunkReport, 0, len(r.chunks)),
+		Manifests:     append([]ManifestReport{}, r.manifests...),
+		SkippedChunks: []string{},
+		TotalBytes:    size,
+		Started:       started,
+		WallTime:      time.Since(started),
+	}
+	for _, chunk := range r.chunks {
+		report.Chunks = append(report.Chunks, *chunk)
+	}
+	sort.Slice(report.Chunks, func(i, j int) bool {
+		return report.Chunks[i].Number < report.Chunks[j].Number
+	})
+	for _, chunk := range report.Chunks {
+		if chunk.Skipped {
+			report.SkippedChunks = append(report.SkippedChunks, chunk.Name)
+		} else if chunk.Etag != "" {
+			report.UploadedBytes += chunk.Size
+		}
+	}
+	if report.WallTime > 0 {
+		report.BytesPerSecond = float64(report.UploadedBytes) / report.WallTime.Seconds()
+	}
+	for _, failure := range failures {
+		report.Errors = append(report.Errors, failure.Error())
+	}
+	return report
+}
+
+// Ensure that reporter satisfies the interface at compile-time
+var _ pipeline.Observer = &reporter{}
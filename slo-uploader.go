@@ -1,35 +1,49 @@
 package swiftlygo
 
 import (
+	"context"
 	"fmt"
 	"github.com/ibmjstart/swiftlygo/auth"
-	. "github.com/ibmjstart/swiftlygo/pipeline"
+	"github.com/ibmjstart/swiftlygo/pipeline"
 	"github.com/ncw/swift"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
 	"io"
 	"os"
 	"time"
 )
 
-// maxFileChunks is the maximum number of chunks that OpenStack Object
-// storage allows within an SLO.
-const maxFileChunks uint = 1000
+// tracerName is the name of the tracer that uploaders create spans with.
+const tracerName = "github.com/ibmjstart/swiftlygo"
 
-// maxChunkSize is the largest allowable size for a single chunk in
-// OpenStack object storage.
-const maxChunkSize uint = 1000 * 1000 * 1000 * 5
+// statusInterval is how often an upload logs its status while it waits for
+// chunks to finish.
+const statusInterval = 60 * time.Second
 
 // SloUploader uploads a file to object storage
 type SloUploader struct {
-	outputChannel  chan string
+	logger         pipeline.Logger
 	Status         *Status
 	source         io.ReaderAt
 	connection     auth.Destination
-	pipelineSource <-chan FileChunk
-	pipelineOut    <-chan FileChunk
-	pipeline       chan FileChunk
-	uploadCounts   <-chan Count
+	pipelineSource <-chan pipeline.FileChunk
+	pipelineOut    <-chan pipeline.FileChunk
+	pipeline       chan pipeline.FileChunk
+	uploadCounts   <-chan pipeline.Count
+	missing        <-chan []pipeline.FileChunk
+	checksums      []pipeline.Checksum
+	fileChecksums  chan<- map[string]string
 	errors         chan error
 	maxUploaders   uint
+	observers      pipeline.Observers
+	reporter       *reporter
+	limiter        *pipeline.RateLimiter
+	concurrency    *pipeline.AdaptiveConcurrency
+	report         *UploadReport
+	tracer         trace.Tracer
+	container      string
+	object         string
+	size           uint
 }
 
 func getSize(file *os.File) (uint, error) {
@@ -40,153 +54,405 @@ func getSize(file *os.File) (uint, error) {
 	return uint(dataStats.Size()), nil
 }
 
+// checkChunkSize ensures that splitting a file of fileSize bytes into chunks of
+// chunkSize bytes satisfies the limits of the destination.
+func checkChunkSize(connection auth.Destination, chunkSize, fileSize uint) error {
+	limits := auth.SwiftLimits
+	if limited, ok := connection.(auth.LimitedDestination); ok {
+		limits = limited.Limits()
+	}
+	if chunkSize > limits.MaxChunkSize || chunkSize < 1 {
+		return fmt.Errorf("Chunk size must be between 1byte and %d bytes", limits.MaxChunkSize)
+	}
+	// The minimum only matters if there will be a chunk other than the last one
+	if chunkSize < limits.MinChunkSize && chunkSize < fileSize {
+		return fmt.Errorf("Chunk size must be at least %d bytes for this destination", limits.MinChunkSize)
+	}
+	numberChunks := fileSize / chunkSize
+	if fileSize%chunkSize != 0 {
+		numberChunks++
+	}
+	if numberChunks > limits.MaxChunks {
+		return fmt.Errorf("File would be split into %d chunks, but at most %d are allowed. Use a larger chunk size", numberChunks, limits.MaxChunks)
+	}
+	return nil
+}
+
 // NewUploader prepares an upload for an SLO by constructing a data pipeline that will
 // read the provided file, split it into pieces of chunkSize bytes, and upload it into
 // the provided destination in the provided container with the given object name.
+// The chunks and intermediate manifests are stored in the same container unless
+// WithSegmentContainer or WithManifestContainer is given, and if the destination
+// is an auth.ContainerDestination, any of these containers that do not exist are
+// created before the upload begins. Progress is logged as lines of text to
+// outputFile, which may be nil, unless a Logger is provided with WithLogger.
 func NewSloUploader(connection auth.Destination, chunkSize uint, container string,
-	object string, source *os.File, maxUploads uint, onlyMissing bool, outputFile io.Writer) (*SloUploader, error) {
+	object string, source *os.File, maxUploads uint, onlyMissing bool, outputFile io.Writer, opts ...Option) (*SloUploader, error) {
 	var (
 		serversideChunks []swift.Object
 		err              error
 	)
-	if source == nil {
-		return nil, fmt.Errorf("Unable to upload nil file")
+	settings := newSettings(outputFile, opts)
+	log := settings.logger
+	if err = checkUpload(connection, settings, container, object, source, maxUploads); err != nil {
+		return nil, err
 	}
 
-	if maxUploads < 1 {
-		return nil, fmt.Errorf("Unable to upload with %d uploaders (minimum 1 required)", maxUploads)
+	fileSize, err := getSize(source)
+	if err != nil {
+		return nil, err
 	}
-	outputChannel := make(chan string, 10)
-
-	if container == "" {
-		return nil, fmt.Errorf("Container name cannot be the empty string")
-	} else if object == "" {
-		return nil, fmt.Errorf("Object name cannot be the empty string")
+	if err = checkChunkSize(connection, chunkSize, fileSize); err != nil {
+		return nil, err
 	}
-
-	if chunkSize > maxChunkSize || chunkSize < 1 {
-		return nil, fmt.Errorf("Chunk size must be between 1byte and 5GB")
+	if concurrent, ok := connection.(auth.ConcurrentDestination); ok {
+		concurrent.SetConcurrency(maxUploads)
 	}
-
-	// Define a function that prints manifest names when the pass through
-	printManifest := func(chunk FileChunk) (FileChunk, error) {
-		outputChannel <- fmt.Sprintf("Uploading manifest: %s\n", chunk.Path())
-		return chunk, nil
+	segmentContainer := container
+	if settings.segments != "" {
+		segmentContainer = settings.segments
+	}
+	// S3 only completes a multipart upload out of parts in the object's bucket
+	if _, ok := connection.(*auth.S3Destination); ok && segmentContainer != container {
+		return nil, fmt.Errorf("Unable to store the chunks of an S3 object in bucket %s instead of %s", segmentContainer, container)
+	}
+	if err = ensureContainers(connection, container, settings.segments, settings.manifests); err != nil {
+		return nil, err
 	}
 
 	// set up the list of missing chunks
 	if onlyMissing {
-		serversideChunks, err = connection.Objects(container)
+		serversideChunks, err = connection.Objects(segmentContainer)
 		if err != nil {
-			outputChannel <- fmt.Sprintf("Problem getting existing chunks names from object storage: %s\n", err)
+			log.Warn("Problem getting existing chunk names from object storage", "container", segmentContainer, "error", err)
 		}
 	} else {
 		serversideChunks = make([]swift.Object, 0)
 	}
 
-	// Define a function to associate hashes with chunks that have already
-	// been uploaded
-	hashAssociate := func(chunk FileChunk) (FileChunk, error) {
-		for _, serverObject := range serversideChunks {
-			if serverObject.Name == chunk.Object {
-				chunk.Hash = serverObject.Hash
-				return chunk, nil
-			}
-		}
-		return chunk, nil
+	// construct pipeline data source
+	fromSource, numberChunks := pipeline.BuildChunks(uint(fileSize), chunkSize)
+
+	return newUploader(connection, settings, uploadPlan{
+		container: container,
+		object:    object,
+		source:    source,
+		size:      fileSize,
+		chunks:    fromSource,
+		count:     numberChunks,
+		chunkSize: chunkSize,
+		existing:  serversideChunks,
+		name: func(chunks <-chan pipeline.FileChunk, errors chan<- error) <-chan pipeline.FileChunk {
+			chunks = pipeline.ObjectNamer(chunks, errors, object+"-chunk-%04[1]d-size-%[2]d")
+			return pipeline.Containerizer(chunks, errors, segmentContainer)
+		},
+	}, maxUploads)
+}
+
+// checkUpload validates the arguments that every uploader takes.
+func checkUpload(connection auth.Destination, settings settings, container, object string, source *os.File, maxUploads uint) error {
+	if source == nil {
+		return fmt.Errorf("Unable to upload nil file")
+	}
+	if maxUploads < 1 {
+		return fmt.Errorf("Unable to upload with %d uploaders (minimum 1 required)", maxUploads)
+	}
+	if container == "" {
+		return fmt.Errorf("Container name cannot be the empty string")
+	} else if object == "" {
+		return fmt.Errorf("Object name cannot be the empty string")
+	}
+	// Compressed and encrypted chunks are described by their metadata
+	if _, ok := connection.(auth.MetadataDestination); (settings.keys != nil || settings.compression != nil) && !ok {
+		return fmt.Errorf("Unable to compress or encrypt chunks for a destination that cannot store metadata")
 	}
+	return nil
+}
 
-	// Asynchronously print everything that comes in on this channel
-	go func(output io.Writer, incoming chan string) {
-		for message := range incoming {
-			_, err := fmt.Fprintln(output, message)
-			if err != nil {
-				fmt.Fprintf(os.Stderr, "Error writing to output log: %s\n", err)
-			}
+// ensureContainers creates each of the named containers that does not exist yet,
+// if the destination is able to. Empty names are ignored. Destinations treat
+// containers that the user may not look up as existing, so that users who may
+// only write objects can still upload into the containers that they were given.
+func ensureContainers(connection auth.Destination, containers ...string) error {
+	creator, ok := connection.(auth.ContainerDestination)
+	if !ok {
+		return nil
+	}
+	created := make(map[string]bool)
+	for _, container := range containers {
+		if container == "" || created[container] {
+			continue
+		}
+		if err := creator.EnsureContainer(container); err != nil {
+			return fmt.Errorf("Unable to create container %s: %w", container, err)
 		}
-	}(outputFile, outputChannel)
+		created[container] = true
+	}
+	return nil
+}
 
-	fileSize, err := getSize(source)
+// reusable reports whether the existing copy of chunk in object storage can be
+// referred to instead of uploading chunk again, which it cannot if it was
+// compressed or encrypted differently than this upload would store it.
+// Destinations that do not store metadata cannot hold compressed or encrypted
+// copies.
+func reusable(connection auth.Destination, settings settings, chunk pipeline.FileChunk) bool {
+	described, ok := connection.(auth.MetadataDestination)
+	if !ok {
+		return true
+	}
+	metadata, err := described.ObjectMetadata(chunk.Container, chunk.Object)
 	if err != nil {
-		return nil, err
+		settings.logger.Warn("Problem getting the metadata of an existing chunk", "container", chunk.Container, "object", chunk.Object, "error", err)
+		return false
+	}
+	return pipeline.MatchesTransforms(metadata, settings.compression, settings.keys)
+}
+
+// uploadPlan describes the chunks of an upload and where they go.
+type uploadPlan struct {
+	container string
+	object    string
+	source    *os.File
+	size      uint
+	chunks    <-chan pipeline.FileChunk // the chunks of source, in order
+	count     uint                      // the number of chunks
+	chunkSize uint                      // the usual size of a chunk
+	existing  []swift.Object            // chunks in object storage, which are not uploaded again
+	// name assigns each chunk its Object and Container
+	name func(chunks <-chan pipeline.FileChunk, errors chan<- error) <-chan pipeline.FileChunk
+	// deduplicate uploads chunks with the same name only once
+	deduplicate bool
+}
+
+// newUploader constructs the pipeline that uploads the chunks of plan and the
+// manifests that refer to them.
+func newUploader(connection auth.Destination, settings settings, plan uploadPlan, maxUploads uint) (*SloUploader, error) {
+	log := settings.logger
+	container, object, source := plan.container, plan.object, plan.source
+	transforms := settings.keys != nil || settings.compression != nil
+	manifestContainer := container
+	if settings.manifests != "" {
+		manifestContainer = settings.manifests
 	}
-	// construct pipeline data source
-	fromSource, numberChunks := BuildChunks(uint(fileSize), chunkSize)
 
 	// start status
-	status := NewStatus(numberChunks, chunkSize, outputChannel)
-	// Asynchronously print status every 5 seconds
-	go func(status *Status, intervalSeconds uint) {
-		for {
-			time.Sleep(time.Duration(intervalSeconds) * time.Second)
-			status.Print()
+	status := NewLoggingStatus(plan.count, plan.chunkSize, log)
+	reporter := newReporter()
+	// The status and the report track progress through the upload's events
+	observers := append(pipeline.Observers{status, reporter}, settings.observers...)
+
+	// Index the existing objects by name, since a shared segment container
+	// may hold many more objects than the upload has chunks
+	existing := make(map[string]swift.Object, len(plan.existing))
+	for _, serverObject := range plan.existing {
+		existing[serverObject.Name] = serverObject
+	}
+	// Define a function to associate hashes with chunks that have already
+	// been uploaded
+	hashAssociate := func(chunk pipeline.FileChunk) (pipeline.FileChunk, error) {
+		serverObject, exists := existing[chunk.Object]
+		if !exists {
+			return chunk, nil
+		}
+		chunk.Hash = serverObject.Hash
+		observers.OnEvent(pipeline.ChunkSkipped{Number: chunk.Number, Object: chunk.Object, Bytes: chunk.Size})
+		if transforms {
+			// The manifest must refer to the size of the data stored
+			chunk.SourceSize, chunk.Size = chunk.Size, uint(serverObject.Bytes)
 		}
-	}(status, 60)
+		return chunk, nil
+	}
 
 	// Initialize pipeline, but don't pass in data
-	intoPipeline := make(chan FileChunk)
+	intoPipeline := make(chan pipeline.FileChunk)
 	errors := make(chan error)
-	chunks := ObjectNamer(intoPipeline, errors, object+"-chunk-%04[1]d-size-%[2]d")
-	chunks = Containerizer(chunks, errors, container)
+	chunks := plan.name(intoPipeline, errors)
+	chunks = pipeline.Map(chunks, errors, reporter.recordChunk)
+	// Chunks with the same data as an earlier one are only uploaded once
+	var repeated <-chan pipeline.FileChunk
+	if plan.deduplicate {
+		chunks, repeated = pipeline.Deduplicate(chunks)
+		repeated = pipeline.Map(repeated, errors, func(chunk pipeline.FileChunk) (pipeline.FileChunk, error) {
+			observers.OnEvent(pipeline.ChunkSkipped{Number: chunk.Number, Object: chunk.Object, Bytes: chunk.Size})
+			return chunk, nil
+		})
+	}
 	// Separate out chunks that should not be uploaded
-	noupload, chunks := Separate(chunks, errors, func(chunk FileChunk) (bool, error) {
-		for _, serverObject := range serversideChunks {
-			if serverObject.Name == chunk.Object {
-				return true, nil
-			}
+	noupload, chunks := pipeline.Separate(chunks, errors, func(chunk pipeline.FileChunk) (bool, error) {
+		if _, exists := existing[chunk.Object]; !exists {
+			return false, nil
 		}
-		return false, nil
+		// The shared chunks of a deduplicated upload are checked before it begins
+		return plan.deduplicate || reusable(connection, settings, chunk), nil
+	})
+	noupload = pipeline.Map(noupload, errors, hashAssociate)
+	// Without adaptive concurrency, every uploader may upload at once
+	var concurrency *pipeline.AdaptiveConcurrency
+	if settings.adaptive {
+		concurrency = pipeline.NewAdaptiveConcurrency(settings.minimum, maxUploads, observers)
+	}
+	stageOptions := []pipeline.Option{
+		pipeline.WithLogger(log),
+		pipeline.WithObserver(observers),
+		pipeline.WithTracerProvider(settings.provider),
+		pipeline.WithRateLimiter(settings.limiter),
+		pipeline.WithAdaptiveConcurrency(concurrency),
+		pipeline.WithRetryPolicy(settings.retry),
+	}
+	// The manifest stages use these to decide whether the manifests can be
+	// decompressed as a whole
+	if settings.compression != nil {
+		stageOptions = append(stageOptions, pipeline.WithCompression(*settings.compression))
+	}
+	if settings.keys != nil {
+		stageOptions = append(stageOptions, pipeline.WithEncryption(settings.keys))
+	}
+	// Perform upload. Each uploader takes the next chunk when it becomes idle,
+	// and sends the chunks that it gives up on to deadLetters
+	deadLetters := make(chan pipeline.FileChunk)
+	uploadOptions := append(stageOptions, pipeline.WithDeadLetters(deadLetters), pipeline.WithChecksums(settings.checksums...))
+	if settings.etags {
+		uploadOptions = append(uploadOptions, pipeline.WithPrecomputedEtags())
+	}
+	chunks = pipeline.Parallel(chunks, errors, maxUploads, func(chunks <-chan pipeline.FileChunk, errors chan<- error) <-chan pipeline.FileChunk {
+		return pipeline.ReadHashAndUpload(chunks, errors, source, connection, uploadOptions...)
 	})
-	noupload = Map(noupload, errors, hashAssociate)
-	// Perform upload
-	uploadStreams := Divide(chunks, maxUploads)
-	doneStreams := make([]<-chan FileChunk, maxUploads)
-	for index, stream := range uploadStreams {
-		doneStreams[index] = ReadHashAndUpload(stream, errors, source, connection)
-	}
-	// Join stream of chunks back together
-	chunks = Join(doneStreams...)
-	chunks, uploadCounts := Counter(chunks)
-	chunks = Join(noupload, chunks)
+	chunks, uploadCounts := pipeline.Counter(chunks)
+	chunks = pipeline.Join(noupload, chunks)
+	if repeated != nil {
+		chunks = pipeline.Replicate(chunks, repeated)
+	}
+	chunks = pipeline.Map(chunks, errors, reporter.recordChunk)
+	// Hold back the manifests if any chunk failed, since they would refer to
+	// segments that do not exist
+	chunks, missing := pipeline.Gate(chunks, deadLetters)
 
 	// Build manifest layer 1
-	manifests := ManifestBuilder(chunks, errors)
-	manifests = ObjectNamer(manifests, errors, object+"-manifest-%04[1]d")
-	manifests = Containerizer(manifests, errors, container)
+	manifests := pipeline.ManifestBuilder(chunks, errors)
+	manifests = pipeline.ObjectNamer(manifests, errors, object+"-manifest-%04[1]d")
+	manifests = pipeline.Containerizer(manifests, errors, manifestContainer)
 	// Upload manifest layer 1
-	manifests = Map(manifests, errors, printManifest)
-	manifests = UploadManifests(manifests, errors, connection)
+	manifests = pipeline.UploadManifests(manifests, errors, connection, stageOptions...)
+	manifests = pipeline.Map(manifests, errors, reporter.recordManifest)
 	// Build top-level manifest out of layer 1
-	topManifests := ManifestBuilder(manifests, errors)
-	topManifests = ObjectNamer(topManifests, errors, object)
-	topManifests = Containerizer(topManifests, errors, container)
+	topManifests := pipeline.ManifestBuilder(manifests, errors)
+	topManifests = pipeline.ObjectNamer(topManifests, errors, object)
+	topManifests = pipeline.Containerizer(topManifests, errors, container)
+	// The top-level manifest carries the checksums of the whole file, which
+	// UploadContext computes while the chunks upload
+	var fileChecksums chan map[string]string
+	if len(settings.checksums) > 0 {
+		fileChecksums = make(chan map[string]string, 1)
+		topManifests = pipeline.Map(topManifests, errors, func(manifest pipeline.FileChunk) (pipeline.FileChunk, error) {
+			manifest.Checksums = <-fileChecksums
+			if manifest.Checksums == nil {
+				return manifest, fmt.Errorf("Unable to compute the checksums of %s", object)
+			}
+			return manifest, nil
+		})
+	}
 	// Upload top-level manifest
-	topManifests = Map(topManifests, errors, printManifest)
-	topManifests = UploadManifests(topManifests, errors, connection)
+	topManifests = pipeline.UploadManifests(topManifests, errors, connection, stageOptions...)
+	topManifests = pipeline.Map(topManifests, errors, reporter.recordManifest)
 
 	return &SloUploader{
-		outputChannel:  outputChannel,
+		logger:         log,
 		Status:         status,
 		connection:     connection,
 		source:         source,
 		pipeline:       intoPipeline,
 		pipelineOut:    topManifests,
-		pipelineSource: fromSource,
+		pipelineSource: plan.chunks,
 		uploadCounts:   uploadCounts,
+		missing:        missing,
+		checksums:      settings.checksums,
+		fileChecksums:  fileChecksums,
 		errors:         errors,
 		maxUploaders:   maxUploads,
+		observers:      observers,
+		reporter:       reporter,
+		limiter:        settings.limiter,
+		concurrency:    concurrency,
+		tracer:         settings.provider.Tracer(tracerName),
+		container:      container,
+		object:         object,
+		size:           plan.size,
 	}, nil
 }
 
-// Upload uploads the sloUploader's source file to object storage
+// SetRateLimit changes the rate, in bytes per second, at which the uploader
+// sends data, or removes the limit if bytesPerSecond is 0. It may be called at
+// any time, including during an upload. If the uploader shares a RateLimiter
+// given with WithRateLimiter, the change applies to everything sharing it.
+func (u *SloUploader) SetRateLimit(bytesPerSecond uint) {
+	u.limiter.SetRate(bytesPerSecond)
+}
+
+// Report returns a summary of every chunk and manifest of the upload, which
+// can be encoded as JSON. It returns nil until Upload has returned, and
+// describes the parts of the upload that succeeded if Upload failed.
+func (u *SloUploader) Report() *UploadReport {
+	return u.report
+}
+
+// Upload uploads the sloUploader's source file to object storage. If anything goes
+// wrong, it returns an *UploadError listing each failure.
 func (u *SloUploader) Upload() error {
-	var errCount uint
+	return u.UploadContext(context.Background())
+}
+
+// UploadContext is like Upload, but the trace spans of the upload are children
+// of the span in ctx, if any.
+func (u *SloUploader) UploadContext(ctx context.Context) (err error) {
+	var failures []error
+	ctx, span := u.tracer.Start(ctx, "Upload", trace.WithAttributes(
+		pipeline.AttributeContainer.String(u.container),
+		pipeline.AttributeObject.String(u.object),
+		pipeline.AttributeSize.Int64(int64(u.size)),
+	))
+	defer func() {
+		if err != nil {
+			span.SetStatus(codes.Error, err.Error())
+		}
+		span.End()
+	}()
+	started := time.Now()
+	u.observers.OnEvent(pipeline.UploadStarted{
+		Container: u.container,
+		Object:    u.object,
+		Chunks:    u.Status.TotalUploads(),
+		Bytes:     u.size,
+	})
+	concurrency := u.maxUploaders
+	if u.concurrency != nil {
+		concurrency = u.concurrency.Limit()
+	}
+	u.observers.OnEvent(pipeline.ConcurrencyChanged{Limit: concurrency})
 	u.Status.Start()
+	// Every event has reached the Status by the time that the upload returns
+	defer u.Status.Close()
+	// Periodically log the status in case chunks take a long time to upload
+	ticker := time.NewTicker(statusInterval)
+	defer ticker.Stop()
+	finished := make(chan struct{})
+	defer close(finished)
+	go func() {
+		for {
+			select {
+			case <-ticker.C:
+				u.Status.Print()
+			case <-finished:
+				return
+			}
+		}
+	}()
 	// drain the upload counts
+	counted := make(chan struct{})
 	go func() {
+		defer close(counted)
 		defer u.Status.Stop()
 		for range u.uploadCounts {
-			u.Status.UploadComplete()
 			u.Status.Print()
 		}
 	}()
@@ -199,18 +465,54 @@ func (u *SloUploader) Upload() error {
 		fmt.Print()
 	}()
 
+	// checksum the whole file for the top-level manifest
+	if u.fileChecksums != nil {
+		go func() {
+			sums, err := pipeline.ComputeChecksums(io.NewSectionReader(u.source, 0, int64(u.size)), u.checksums...)
+			if err != nil {
+				u.logger.Error("Unable to compute the checksums of the file", "error", err)
+			}
+			u.fileChecksums <- sums
+		}()
+	}
 	// start sending chunks through the pipeline.
 	for chunk := range u.pipelineSource {
+		chunk.Context = ctx
 		u.pipeline <- chunk
 	}
 	close(u.pipeline)
 	// Drain the errors channel, this will block until the errors channel is closed above.
 	for e := range u.errors {
-		errCount++
-		u.outputChannel <- e.Error()
+		failures = append(failures, e)
+	}
+	<-counted
+	if missing := <-u.missing; len(missing) > 0 {
+		failures = append(failures, &MissingChunksError{Chunks: missing})
 	}
-	if errCount == 0 {
+	u.report = u.reporter.report(u.container, u.object, u.size, started, failures)
+	if len(failures) == 0 {
+		u.Status.Print()
+		u.observers.OnEvent(pipeline.UploadFinished{
+			Container: u.container,
+			Object:    u.object,
+			Bytes:     u.size,
+			Duration:  time.Since(started),
+		})
 		return nil
 	}
-	return fmt.Errorf("Encountered %d errors, check log output.", errCount)
+	u.logger.Error("Upload finished with errors", "errors", len(failures))
+	// S3 keeps the parts of an upload that was not completed until it is aborted
+	if s3, ok := u.connection.(*auth.S3Destination); ok {
+		if err := s3.Abort(u.container, u.object); err != nil {
+			u.logger.Warn("Problem aborting the multipart upload", "error", err)
+		}
+	}
+	uploadErr := &UploadError{Errors: failures}
+	u.observers.OnEvent(pipeline.UploadFailed{
+		Container: u.container,
+		Object:    u.object,
+		Duration:  time.Since(started),
+		Err:       uploadErr,
+	})
+	return uploadErr
 }
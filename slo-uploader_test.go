@@ -2,16 +2,100 @@ package swiftlygo_test
 
 import (
 	. "github.com/ibmjstart/swiftlygo"
+	"github.com/ibmjstart/swiftlygo/auth"
 	"github.com/ibmjstart/swiftlygo/auth/mock"
+	"github.com/ibmjstart/swiftlygo/pipeline"
+	"github.com/ncw/swift"
 
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
 	"fmt"
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+	"io"
 	"io/ioutil"
+	"log/slog"
 	"math/rand"
+	"net/http"
+	"net/http/httptest"
 	"os"
+	"sync"
+	"sync/atomic"
+	"time"
 )
 
+// limitedDestination is a BufferDestination with custom chunk limits.
+type limitedDestination struct {
+	*mock.BufferDestination
+	limits auth.Limits
+}
+
+func (l limitedDestination) Limits() auth.Limits {
+	return l.limits
+}
+
+// failingDestination is a NullDestination that cannot create the object named
+// failing, and counts the manifests that it is asked to create.
+type failingDestination struct {
+	mock.NullDestination
+	failing   string
+	manifests int32
+}
+
+func (f *failingDestination) CreateFile(container, objectName string, checkHash bool, hash string) (auth.WriteCloseHeader, error) {
+	if objectName == f.failing {
+		return nil, fmt.Errorf("Failed to create %s", objectName)
+	}
+	return f.NullDestination.CreateFile(container, objectName, checkHash, hash)
+}
+
+func (f *failingDestination) CreateSLO(containerName, manifestName, manifestEtag string, sloManifestJSON []byte) error {
+	atomic.AddInt32(&f.manifests, 1)
+	return nil
+}
+
+// flakyDestination is a NullDestination that fails to create the first object
+// that it is asked to create, as an overloaded object store would.
+type flakyDestination struct {
+	mock.NullDestination
+	failed int32
+}
+
+func (f *flakyDestination) CreateFile(container, objectName string, checkHash bool, hash string) (auth.WriteCloseHeader, error) {
+	if atomic.CompareAndSwapInt32(&f.failed, 0, 1) {
+		return nil, &auth.HTTPStatusError{Code: http.StatusServiceUnavailable, Body: "Try again"}
+	}
+	return f.NullDestination.CreateFile(container, objectName, checkHash, hash)
+}
+
+// resumedDestination is a BufferDestination that lists objects as if they had
+// been uploaded already.
+type resumedDestination struct {
+	*mock.BufferDestination
+	objects []swift.Object
+}
+
+func (r resumedDestination) Objects(container string) ([]swift.Object, error) {
+	return r.objects, nil
+}
+
+// containerlessDestination is a BufferDestination that is not allowed to
+// create containers.
+type containerlessDestination struct {
+	*mock.BufferDestination
+}
+
+func (c containerlessDestination) EnsureContainer(container string) error {
+	return fmt.Errorf("Not allowed to create %s", container)
+}
+
 var _ = Describe("Uploader", func() {
 	var (
 		tempfile    *os.File
@@ -81,6 +165,27 @@ var _ = Describe("Uploader", func() {
 				Expect(err).Should(HaveOccurred())
 			})
 		})
+		Context("With a chunk size below the destination's minimum", func() {
+			It("Should return an error", func() {
+				limited := limitedDestination{destination, auth.Limits{MinChunkSize: 100, MaxChunkSize: 1000, MaxChunks: 1000}}
+				_, err = NewSloUploader(limited, 10, "container", "object", tempfile, 1, false, ioutil.Discard)
+				Expect(err).Should(HaveOccurred())
+			})
+		})
+		Context("With a chunk size below the destination's minimum that fits the whole file", func() {
+			It("Should not return an error", func() {
+				limited := limitedDestination{destination, auth.Limits{MinChunkSize: 2048, MaxChunkSize: 4096, MaxChunks: 1000}}
+				_, err = NewSloUploader(limited, uint(fileSize), "container", "object", tempfile, 1, false, ioutil.Discard)
+				Expect(err).ShouldNot(HaveOccurred())
+			})
+		})
+		Context("With more chunks than the destination allows", func() {
+			It("Should return an error", func() {
+				limited := limitedDestination{destination, auth.Limits{MinChunkSize: 1, MaxChunkSize: 1000, MaxChunks: 10}}
+				_, err = NewSloUploader(limited, 10, "container", "object", tempfile, 1, false, ioutil.Discard)
+				Expect(err).Should(HaveOccurred())
+			})
+		})
 	})
 	Describe("Performing an upload", func() {
 		Context("With valid constructor input", func() {
@@ -91,6 +196,16 @@ var _ = Describe("Uploader", func() {
 				Expect(err).ShouldNot(HaveOccurred())
 			})
 		})
+		Context("With a short final chunk", func() {
+			It("Should report the actual number of bytes uploaded", func() {
+				uploader, err := NewSloUploader(destination, 1000, "container", "object", tempfile, 1, false, nil)
+				Expect(err).ShouldNot(HaveOccurred())
+				Expect(uploader.Upload()).To(Succeed())
+				Expect(uploader.Status.TotalBytes()).To(Equal(uint(fileSize)))
+				Expect(uploader.Status.BytesUploaded()).To(Equal(uint(fileSize)))
+				Expect(uploader.Status.PercentComplete()).To(Equal(100.0))
+			})
+		})
 		Context("Uploading test data", func() {
 			It("Should upload the same data that was in the file", func() {
 				uploader, err := NewSloUploader(destination, 10, "container", "object", tempfile, 1, false, ioutil.Discard)
@@ -148,6 +263,554 @@ var _ = Describe("Uploader", func() {
 				bytesWrittenToDestination, _ := destination.FileContent.Contents.Read(dataWrittenBuffer)
 				// Check that a single chunk was not written
 				Expect(bytesWrittenToDestination + chunkSize).To(Equal(bytesReadFromTempFile))
+				Expect(uploader.Status.ChunksSkipped()).To(Equal(uint(1)))
+				Expect(uploader.Status.BytesSkipped()).To(Equal(uint(chunkSize)))
+				Expect(uploader.Status.PercentComplete()).To(Equal(100.0))
+			})
+		})
+		Context("When the destination fails", func() {
+			It("Should return an UploadError listing each failure", func() {
+				maxAttempts, baseWait := pipeline.UploadMaxAttempts, pipeline.UploadRetryBaseWait
+				pipeline.UploadMaxAttempts, pipeline.UploadRetryBaseWait = 0, 0
+				defer func() {
+					pipeline.UploadMaxAttempts, pipeline.UploadRetryBaseWait = maxAttempts, baseWait
+				}()
+				uploader, err := NewSloUploader(mock.NewErrorDestination(), 512, "container", "object", tempfile, 1, false, ioutil.Discard)
+				Expect(err).ShouldNot(HaveOccurred())
+				err = uploader.Upload()
+				var uploadErr *UploadError
+				Expect(errors.As(err, &uploadErr)).To(BeTrue())
+				var chunkErrors int
+				for _, failure := range uploadErr.Errors {
+					if _, ok := failure.(*pipeline.ChunkUploadError); ok {
+						chunkErrors++
+					}
+				}
+				Expect(chunkErrors).To(Equal(2))
+				var missingErr *MissingChunksError
+				Expect(errors.As(err, &missingErr)).To(BeTrue())
+				Expect(missingErr.Chunks).To(HaveLen(2))
+				var manifestErr *pipeline.ManifestUploadError
+				Expect(errors.As(err, &manifestErr)).To(BeFalse())
+			})
+			It("Should succeed if a failed chunk succeeds when it is retried", func() {
+				baseWait := pipeline.UploadRetryBaseWait
+				pipeline.UploadRetryBaseWait = 0
+				defer func() {
+					pipeline.UploadRetryBaseWait = baseWait
+				}()
+				uploader, err := NewSloUploader(&flakyDestination{}, 128, "container", "object", tempfile, 2, false, nil)
+				Expect(err).ShouldNot(HaveOccurred())
+				Expect(uploader.Upload()).To(Succeed())
+				Expect(uploader.Status.ChunksRetried()).To(Equal(uint(1)))
+				Expect(uploader.Status.ChunksFailed()).To(BeZero())
+			})
+			It("Should not upload the manifest if any chunk is missing", func() {
+				maxAttempts, baseWait := pipeline.UploadMaxAttempts, pipeline.UploadRetryBaseWait
+				pipeline.UploadMaxAttempts, pipeline.UploadRetryBaseWait = 1, 0
+				defer func() {
+					pipeline.UploadMaxAttempts, pipeline.UploadRetryBaseWait = maxAttempts, baseWait
+				}()
+				dest := &failingDestination{failing: "object-chunk-0002-size-128"}
+				uploader, err := NewSloUploader(dest, 128, "container", "object", tempfile, 4, false, nil)
+				Expect(err).ShouldNot(HaveOccurred())
+				err = uploader.Upload()
+				var missingErr *MissingChunksError
+				Expect(errors.As(err, &missingErr)).To(BeTrue())
+				Expect(missingErr.Chunks).To(HaveLen(1))
+				Expect(missingErr.Chunks[0].Number).To(Equal(uint(2)))
+				Expect(missingErr.Error()).To(ContainSubstring("object-chunk-0002-size-128"))
+				Expect(atomic.LoadInt32(&dest.manifests)).To(BeZero())
+			})
+		})
+		Context("When logging", func() {
+			It("Should write text lines to the output file", func() {
+				output := new(bytes.Buffer)
+				uploader, err := NewSloUploader(destination, uint(fileSize/2), "container", "object", tempfile, 1, false, output)
+				Expect(err).ShouldNot(HaveOccurred())
+				Expect(uploader.Upload()).To(Succeed())
+				Expect(output.String()).To(ContainSubstring("INFO Uploaded chunk chunk=1 object=object-chunk-0001-size-512 attempt=1 bytes=512"))
+				Expect(output.String()).To(ContainSubstring("INFO Uploading manifest manifest=0 object=object\n"))
+				Expect(output.String()).To(MatchRegexp("INFO Upload finished in .* uploaded=2 skipped=0 retried=0 failed=0 total=2 concurrency=1 bytes_per_second=[0-9.e+]+\n$"))
+			})
+			It("Should prefer a Logger provided with WithLogger", func() {
+				output, logged := new(bytes.Buffer), new(bytes.Buffer)
+				logger := slog.New(slog.NewTextHandler(logged, &slog.HandlerOptions{Level: slog.LevelDebug}))
+				uploader, err := NewSloUploader(destination, uint(fileSize/2), "container", "object", tempfile, 1, false, output, WithLogger(logger))
+				Expect(err).ShouldNot(HaveOccurred())
+				Expect(uploader.Upload()).To(Succeed())
+				Expect(output.Len()).To(BeZero())
+				Expect(logged.String()).To(ContainSubstring("level=DEBUG msg=\"Uploading chunk\" chunk=0"))
+				Expect(logged.String()).To(ContainSubstring("uploaded=2 skipped=0 retried=0 failed=0 total=2"))
+			})
+		})
+		Context("When observing", func() {
+			var (
+				lock   sync.Mutex
+				events []pipeline.Event
+				record pipeline.ObserverFunc
+			)
+			BeforeEach(func() {
+				events = nil
+				record = func(event pipeline.Event) {
+					lock.Lock()
+					defer lock.Unlock()
+					events = append(events, event)
+				}
+			})
+			It("Should send the events of a successful upload to every observer", func() {
+				destination.Containers["container"] = append(destination.Containers["container"], "object-chunk-0000-size-512")
+				var count int
+				uploader, err := NewSloUploader(destination, uint(fileSize/2), "container", "object", tempfile, 1, true, nil,
+					WithObserver(record), WithObserver(pipeline.ObserverFunc(func(pipeline.Event) {
+						lock.Lock()
+						defer lock.Unlock()
+						count++
+					})))
+				Expect(err).ShouldNot(HaveOccurred())
+				Expect(uploader.Upload()).To(Succeed())
+				Expect(count).To(Equal(len(events)))
+				Expect(events[0]).To(Equal(pipeline.UploadStarted{Container: "container", Object: "object", Chunks: 2, Bytes: 1024}))
+				Expect(events).To(ContainElement(pipeline.ChunkSkipped{Number: 0, Object: "object-chunk-0000-size-512", Bytes: 512}))
+				Expect(events).To(ContainElement(pipeline.ChunkStarted{Number: 1, Object: "object-chunk-0001-size-512", Attempt: 1}))
+				Expect(events).To(ContainElement(BeAssignableToTypeOf(pipeline.ChunkCompleted{})))
+				Expect(events).To(ContainElement(BeAssignableToTypeOf(pipeline.ManifestUploaded{})))
+				finished, ok := events[len(events)-1].(pipeline.UploadFinished)
+				Expect(ok).To(BeTrue())
+				Expect(finished.Bytes).To(Equal(uint(1024)))
+			})
+			It("Should end a failed upload with UploadFailed", func() {
+				maxAttempts := pipeline.UploadMaxAttempts
+				pipeline.UploadMaxAttempts = 0
+				defer func() {
+					pipeline.UploadMaxAttempts = maxAttempts
+				}()
+				uploader, err := NewSloUploader(mock.NewErrorDestination(), uint(fileSize), "container", "object", tempfile, 1, false, nil,
+					WithObserver(record))
+				Expect(err).ShouldNot(HaveOccurred())
+				err = uploader.Upload()
+				failed, ok := events[len(events)-1].(pipeline.UploadFailed)
+				Expect(ok).To(BeTrue())
+				Expect(failed.Err).To(Equal(err))
+			})
+		})
+		Context("With adaptive concurrency", func() {
+			It("Should report the number of concurrent uploads in the Status", func() {
+				// A steady latency keeps timing noise from looking like congestion
+				steady := mock.NewLatencyDestination(mock.NewNullDestination(), func(string, string) time.Duration {
+					return 20 * time.Millisecond
+				})
+				uploader, err := NewSloUploader(steady, uint(fileSize/8), "container", "object", tempfile, 4, false, nil,
+					WithAdaptiveConcurrency(1))
+				Expect(err).ShouldNot(HaveOccurred())
+				Expect(uploader.Upload()).To(Succeed())
+				Expect(uploader.Status.Concurrency()).To(BeNumerically(">", 1))
+				Expect(uploader.Status.Concurrency()).To(BeNumerically("<=", 4))
+			})
+			It("Should report the fixed number of uploads otherwise", func() {
+				uploader, err := NewSloUploader(mock.NewNullDestination(), uint(fileSize/8), "container", "object", tempfile, 4, false, nil)
+				Expect(err).ShouldNot(HaveOccurred())
+				Expect(uploader.Upload()).To(Succeed())
+				Expect(uploader.Status.Concurrency()).To(Equal(uint(4)))
+			})
+		})
+		Context("With a rate limit", func() {
+			It("Should limit the upload with the shared RateLimiter and allow the limit to change", func() {
+				limiter := pipeline.NewRateLimiter(uint(fileSize) * 4)
+				uploader, err := NewSloUploader(mock.NewNullDestination(), uint(fileSize/2), "container", "object", tempfile, 2, false, nil,
+					WithRateLimiter(limiter))
+				Expect(err).ShouldNot(HaveOccurred())
+				started := time.Now()
+				Expect(uploader.Upload()).To(Succeed())
+				// The second chunk waits for the first to be sent at the limited rate
+				Expect(time.Since(started)).To(BeNumerically(">=", 120*time.Millisecond))
+				uploader.SetRateLimit(0)
+				Expect(limiter.Rate()).To(BeZero())
+			})
+		})
+		Context("With precomputed Etags", func() {
+			It("Should upload chunks that object storage can check", func() {
+				uploader, err := NewSloUploader(destination, uint(fileSize/4), "container", "object", tempfile, 1, false, nil,
+					WithPrecomputedEtags(), WithChecksums(pipeline.SHA256))
+				Expect(err).ShouldNot(HaveOccurred())
+				Expect(uploader.Upload()).To(Succeed())
+				Expect(uploader.Status.NumberUploaded()).To(Equal(uint(4)))
+			})
+		})
+		Context("With checksums", func() {
+			It("Should store the checksums of each chunk and of the whole file", func() {
+				uploader, err := NewSloUploader(destination, uint(fileSize/4), "container", "object", tempfile, 1, false, nil,
+					WithChecksums(pipeline.SHA256))
+				Expect(err).ShouldNot(HaveOccurred())
+				Expect(uploader.Upload()).To(Succeed())
+				data, err := ioutil.ReadFile(tempfile.Name())
+				Expect(err).ShouldNot(HaveOccurred())
+				sum := sha256.Sum256(data)
+				Expect(destination.Metadata["container/object"]).To(Equal(map[string]string{
+					pipeline.ChecksumMetadataPrefix + "sha256": hex.EncodeToString(sum[:]),
+				}))
+				sum = sha256.Sum256(data[:fileSize/4])
+				Expect(destination.Metadata["container/object-chunk-0000-size-256"]).To(Equal(map[string]string{
+					pipeline.ChecksumMetadataPrefix + "sha256": hex.EncodeToString(sum[:]),
+				}))
+				report := uploader.Report()
+				Expect(report.Chunks[0].Checksums).To(HaveKey("sha256"))
+				Expect(report.Manifests[len(report.Manifests)-1].Checksums).To(HaveKey("sha256"))
+			})
+		})
+		Context("With encryption", func() {
+			var keys pipeline.StaticKey
+
+			BeforeEach(func() {
+				keys = pipeline.NewStaticKey(bytes.Repeat([]byte{7}, 32))
+			})
+
+			// segmentSizes decodes the sizes of the segments listed by the first
+			// manifest uploaded to dest
+			segmentSizes := func(dest *mock.BufferDestination) []uint {
+				var segments []struct {
+					Size uint `json:"size_bytes"`
+				}
+				Expect(json.NewDecoder(dest.ManifestContent).Decode(&segments)).To(Succeed())
+				var sizes []uint
+				for _, segment := range segments {
+					sizes = append(sizes, segment.Size)
+				}
+				return sizes
+			}
+
+			It("Should refer to the size of the ciphertext in the manifests", func() {
+				uploader, err := NewSloUploader(destination, uint(fileSize/2), "container", "object", tempfile, 1, false, nil,
+					WithEncryption(keys))
+				Expect(err).ShouldNot(HaveOccurred())
+				Expect(uploader.Upload()).To(Succeed())
+				encrypted := pipeline.EncryptedSize(uint(fileSize / 2))
+				Expect(destination.FileContent.Contents.Len()).To(Equal(int(2 * encrypted)))
+				Expect(segmentSizes(destination)).To(Equal([]uint{encrypted, encrypted}))
+				Expect(pipeline.IsEncrypted(destination.Metadata["container/object-chunk-0000-size-512"])).To(BeTrue())
+			})
+			It("Should refer to the size of the ciphertext of chunks that it skips", func() {
+				encrypted := pipeline.EncryptedSize(uint(fileSize / 2))
+				resumed := resumedDestination{BufferDestination: destination, objects: []swift.Object{
+					{Name: "object-chunk-0000-size-512", Bytes: int64(encrypted), Hash: "0123456789abcdef0123456789abcdef"},
+				}}
+				destination.Metadata["container/object-chunk-0000-size-512"] = map[string]string{
+					pipeline.MetadataEncryption: pipeline.EncryptionAlgorithm,
+					pipeline.MetadataKeyID:      keys.KeyID,
+				}
+				uploader, err := NewSloUploader(resumed, uint(fileSize/2), "container", "object", tempfile, 1, true, nil,
+					WithEncryption(keys))
+				Expect(err).ShouldNot(HaveOccurred())
+				Expect(uploader.Upload()).To(Succeed())
+				Expect(uploader.Status.ChunksSkipped()).To(Equal(uint(1)))
+				Expect(segmentSizes(destination)).To(Equal([]uint{encrypted, encrypted}))
+			})
+			It("Should upload chunks again that were not encrypted with a known key", func() {
+				resumed := resumedDestination{BufferDestination: destination, objects: []swift.Object{
+					{Name: "object-chunk-0000-size-512", Bytes: 512, Hash: "0123456789abcdef0123456789abcdef"},
+					{Name: "object-chunk-0001-size-512", Bytes: 512, Hash: "0123456789abcdef0123456789abcdef"},
+				}}
+				destination.Metadata["container/object-chunk-0001-size-512"] = map[string]string{
+					pipeline.MetadataEncryption: pipeline.EncryptionAlgorithm,
+					pipeline.MetadataKeyID:      "another key",
+				}
+				uploader, err := NewSloUploader(resumed, uint(fileSize/2), "container", "object", tempfile, 1, true, nil,
+					WithEncryption(keys))
+				Expect(err).ShouldNot(HaveOccurred())
+				Expect(uploader.Upload()).To(Succeed())
+				Expect(uploader.Status.ChunksSkipped()).To(BeZero())
+				encrypted := pipeline.EncryptedSize(uint(fileSize / 2))
+				Expect(segmentSizes(destination)).To(Equal([]uint{encrypted, encrypted}))
+			})
+			It("Should refuse a destination that cannot store metadata", func() {
+				_, err := NewSloUploader(mock.NewNullDestination(), uint(fileSize/2), "container", "object", tempfile, 1, false, nil,
+					WithEncryption(keys))
+				Expect(err).Should(HaveOccurred())
+			})
+		})
+		Context("With compression", func() {
+			It("Should build the manifests over the compressed segments and index them", func() {
+				uploader, err := NewSloUploader(destination, uint(fileSize/2), "container", "object", tempfile, 1, false, nil,
+					WithCompression(pipeline.Gzip))
+				Expect(err).ShouldNot(HaveOccurred())
+				Expect(uploader.Upload()).To(Succeed())
+				report := uploader.Report()
+				Expect(report.UploadedBytes).To(Equal(uint(fileSize)))
+				Expect(report.Chunks[1].Size).To(Equal(uint(fileSize / 2)))
+				Expect(report.Chunks[1].StoredSize).NotTo(BeZero())
+				Expect(destination.Metadata["container/object-chunk-0001-size-512"]).To(HaveKeyWithValue(pipeline.MetadataOriginalOffset, "512"))
+				Expect(destination.Metadata["container/object"]).To(Equal(map[string]string{pipeline.MetadataCompression: "gzip"}))
+
+				var segments []struct {
+					Size uint `json:"size_bytes"`
+				}
+				Expect(json.NewDecoder(destination.ManifestContent).Decode(&segments)).To(Succeed())
+				Expect(segments).To(HaveLen(2))
+				Expect(segments[1].Size).To(Equal(report.Chunks[1].StoredSize))
+
+				index := report.Index()
+				entry, ok := index.Find(600)
+				Expect(ok).To(BeTrue())
+				Expect(entry.Object).To(Equal("object-chunk-0001-size-512"))
+				Expect(entry.StoredOffset).To(Equal(report.Chunks[0].StoredSize))
+
+				// The segments decompress as a single stream
+				data, err := ioutil.ReadFile(tempfile.Name())
+				Expect(err).ShouldNot(HaveOccurred())
+				reader, err := pipeline.NewDecompressor(destination.FileContent.Contents, destination.Metadata["container/object"])
+				Expect(err).ShouldNot(HaveOccurred())
+				Expect(ioutil.ReadAll(reader)).To(Equal(data))
+			})
+		})
+		Context("With content-defined chunking", func() {
+			params := pipeline.ChunkingParams{MinSize: 64, AvgSize: 128, MaxSize: 512}
+
+			It("Should skip the chunks that are already in the segment container", func() {
+				uploader, err := NewDedupUploader(destination, params, "container", "segments", "object", tempfile, 1, nil)
+				Expect(err).ShouldNot(HaveOccurred())
+				Expect(uploader.Upload()).To(Succeed())
+				uploaded := destination.FileContent.Contents.Len()
+				Expect(uploaded).To(Equal(int(fileSize)))
+				report := uploader.Report()
+				Expect(report.SkippedChunks).To(BeEmpty())
+				Expect(destination.Containers["segments"]).To(ContainElement(fmt.Sprintf(DedupSegmentFormat, report.Chunks[0].Checksums["sha256"])))
+
+				uploader, err = NewDedupUploader(destination, params, "container", "segments", "object", tempfile, 1, nil)
+				Expect(err).ShouldNot(HaveOccurred())
+				Expect(uploader.Upload()).To(Succeed())
+				Expect(destination.FileContent.Contents.Len()).To(Equal(uploaded))
+				Expect(uploader.Report().SkippedChunks).To(HaveLen(len(report.Chunks)))
+			})
+			It("Should upload repeated data once and refer to it from every chunk", func() {
+				zeros, err := ioutil.TempFile("", "zeros")
+				Expect(err).ShouldNot(HaveOccurred())
+				defer os.Remove(zeros.Name())
+				defer zeros.Close()
+				_, err = zeros.Write(make([]byte, 4096))
+				Expect(err).ShouldNot(HaveOccurred())
+
+				uploader, err := NewDedupUploader(destination, params, "container", "segments", "object", zeros, 1, nil)
+				Expect(err).ShouldNot(HaveOccurred())
+				Expect(uploader.Upload()).To(Succeed())
+				Expect(destination.FileContent.Contents.Len()).To(BeNumerically("<", 4096))
+				var segments []struct {
+					Path string `json:"path"`
+					Size uint   `json:"size_bytes"`
+				}
+				Expect(json.NewDecoder(destination.ManifestContent).Decode(&segments)).To(Succeed())
+				var total uint
+				for _, segment := range segments {
+					total += segment.Size
+				}
+				Expect(total).To(Equal(uint(4096)))
+				Expect(segments[0].Path).To(Equal(segments[1].Path))
+			})
+			It("Should not refer to shared chunks that were compressed differently", func() {
+				uploader, err := NewDedupUploader(destination, params, "container", "segments", "object", tempfile, 1, nil)
+				Expect(err).ShouldNot(HaveOccurred())
+				Expect(uploader.Upload()).To(Succeed())
+
+				_, err = NewDedupUploader(destination, params, "container", "segments", "object", tempfile, 1, nil,
+					WithCompression(pipeline.Gzip))
+				Expect(err).To(MatchError(ContainSubstring("compressed or encrypted differently")))
+			})
+			It("Should refuse S3 destinations", func() {
+				s3 := auth.NewS3Destination("http://localhost:9000", "", "access", "secret")
+				_, err := NewDedupUploader(s3, params, "bucket", "segments", "object", tempfile, 1, nil)
+				Expect(err).Should(MatchError(ContainSubstring("S3")))
+			})
+			It("Should refuse chunk sizes that are out of order", func() {
+				_, err := NewDedupUploader(destination, pipeline.ChunkingParams{MinSize: 128, AvgSize: 128, MaxSize: 512},
+					"container", "segments", "object", tempfile, 1, nil)
+				Expect(err).Should(HaveOccurred())
+			})
+		})
+		Context("Through a destination with latency", func() {
+			// noLatency adds no latency to any object
+			noLatency := func(string, string) time.Duration {
+				return 0
+			}
+
+			It("Should use the features of the destination that it wraps", func() {
+				uploader, err := NewSloUploader(mock.NewLatencyDestination(destination, noLatency), uint(fileSize/2), "container", "object", tempfile, 1, false, nil,
+					WithCompression(pipeline.Gzip), WithSegmentContainer(SegmentContainer("container")))
+				Expect(err).ShouldNot(HaveOccurred())
+				Expect(uploader.Upload()).To(Succeed())
+				Expect(destination.Containers).To(HaveKey("container_segments"))
+				Expect(destination.Metadata["container_segments/object-chunk-0000-size-512"]).To(HaveKeyWithValue(pipeline.MetadataCompression, "gzip"))
+			})
+			It("Should keep the limits of the destination that it wraps", func() {
+				s3 := auth.NewS3Destination("http://localhost:9000", "", "access", "secret")
+				_, err := NewSloUploader(mock.NewLatencyDestination(s3, noLatency), uint(fileSize/2), "bucket", "object", tempfile, 1, false, nil)
+				Expect(err).Should(MatchError(ContainSubstring("at least")))
+			})
+		})
+		Context("With separate containers", func() {
+			It("Should store the chunks, intermediate manifests and object in their own containers", func() {
+				uploader, err := NewSloUploader(destination, 100, "container", "object", tempfile, 1, false, nil,
+					WithSegmentContainer(SegmentContainer("container")), WithManifestContainer("manifests"))
+				Expect(err).ShouldNot(HaveOccurred())
+				Expect(destination.Containers).To(HaveKey("container_segments"))
+				Expect(destination.Containers).To(HaveKey("container"))
+				Expect(uploader.Upload()).To(Succeed())
+				Expect(destination.Containers["container"]).To(Equal([]string{"object"}))
+				Expect(destination.Containers["container_segments"]).To(HaveLen(11))
+				Expect(destination.Containers["manifests"]).To(Equal([]string{"object-manifest-0000"}))
+				Expect(destination.ManifestContent.String()).To(ContainSubstring(`"path":"container_segments/object-chunk-0000-size-100"`))
+			})
+			It("Should report where each chunk is so that the index can read it back", func() {
+				uploader, err := NewSloUploader(destination, uint(fileSize/4), "container", "object", tempfile, 1, false, nil,
+					WithSegmentContainer(SegmentContainer("container")), WithCompression(pipeline.Gzip))
+				Expect(err).ShouldNot(HaveOccurred())
+				Expect(uploader.Upload()).To(Succeed())
+				report := uploader.Report()
+				Expect(report.Chunks[0].Container).To(Equal("container_segments"))
+				Expect(report.Manifests[len(report.Manifests)-1].Container).To(Equal("container"))
+
+				// The single uploader writes the segments one after another
+				stored := destination.FileContent.Contents.Bytes()
+				reader := pipeline.NewIndexedReader(report.Index(), func(entry pipeline.SeekEntry) (io.ReadCloser, map[string]string, error) {
+					metadata, exists := destination.Metadata[entry.Container+"/"+entry.Object]
+					if !exists {
+						return nil, nil, fmt.Errorf("No segment %s/%s", entry.Container, entry.Object)
+					}
+					segment := stored[entry.StoredOffset : entry.StoredOffset+entry.StoredSize]
+					return ioutil.NopCloser(bytes.NewReader(segment)), metadata, nil
+				})
+				data, err := ioutil.ReadFile(tempfile.Name())
+				Expect(err).ShouldNot(HaveOccurred())
+				part := make([]byte, 400)
+				_, err = reader.ReadAt(part, 200)
+				Expect(err).ShouldNot(HaveOccurred())
+				Expect(part).To(Equal(data[200:600]))
+			})
+			It("Should look for missing chunks in the segment container", func() {
+				destination.Containers["container_segments"] = []string{"object-chunk-0000-size-512"}
+				uploader, err := NewSloUploader(destination, 512, "container", "object", tempfile, 1, true, nil,
+					WithSegmentContainer(SegmentContainer("container")))
+				Expect(err).ShouldNot(HaveOccurred())
+				Expect(uploader.Upload()).To(Succeed())
+				Expect(uploader.Status.ChunksSkipped()).To(Equal(uint(1)))
+			})
+			It("Should fail if a container cannot be created", func() {
+				_, err := NewSloUploader(containerlessDestination{destination}, 100, "container", "object", tempfile, 1, false, nil,
+					WithSegmentContainer(SegmentContainer("container")))
+				Expect(err).Should(HaveOccurred())
+			})
+		})
+		Context("When reporting", func() {
+			It("Should describe every chunk and manifest of the upload", func() {
+				destination.Containers["container"] = append(destination.Containers["container"], "object-chunk-0000-size-512")
+				uploader, err := NewSloUploader(destination, uint(fileSize/2), "container", "object", tempfile, 1, true, nil)
+				Expect(err).ShouldNot(HaveOccurred())
+				Expect(uploader.Report()).To(BeNil())
+				Expect(uploader.Upload()).To(Succeed())
+				report := uploader.Report()
+				Expect(report.Container).To(Equal("container"))
+				Expect(report.TotalBytes).To(Equal(uint(1024)))
+				Expect(report.UploadedBytes).To(Equal(uint(512)))
+				Expect(report.SkippedChunks).To(Equal([]string{"object-chunk-0000-size-512"}))
+				Expect(report.Chunks).To(HaveLen(2))
+				Expect(report.Chunks[0].Skipped).To(BeTrue())
+				uploaded := report.Chunks[1]
+				Expect(uploaded.Name).To(Equal("object-chunk-0001-size-512"))
+				Expect(uploaded.Offset).To(Equal(uint(512)))
+				Expect(uploaded.Size).To(Equal(uint(512)))
+				Expect(uploaded.Etag).NotTo(BeEmpty())
+				Expect(uploaded.Attempts).To(Equal(uint(1)))
+				Expect(uploaded.Duration).To(BeNumerically(">", 0))
+				Expect(report.Manifests).To(HaveLen(2))
+				Expect(report.Manifests[1].Name).To(Equal("object"))
+				Expect(report.Manifests[1].Size).To(Equal(uint(1024)))
+				Expect(report.WallTime).To(BeNumerically(">", 0))
+				Expect(report.BytesPerSecond).To(BeNumerically(">", 0))
+				Expect(report.Errors).To(BeEmpty())
+				encoded, err := json.Marshal(report)
+				Expect(err).ShouldNot(HaveOccurred())
+				var decoded UploadReport
+				Expect(json.Unmarshal(encoded, &decoded)).To(Succeed())
+				Expect(decoded.Chunks).To(Equal(report.Chunks))
+				Expect(decoded.Manifests).To(Equal(report.Manifests))
+			})
+			It("Should list the errors of a failed upload", func() {
+				maxAttempts := pipeline.UploadMaxAttempts
+				pipeline.UploadMaxAttempts = 0
+				defer func() {
+					pipeline.UploadMaxAttempts = maxAttempts
+				}()
+				uploader, err := NewSloUploader(mock.NewErrorDestination(), uint(fileSize), "container", "object", tempfile, 1, false, nil)
+				Expect(err).ShouldNot(HaveOccurred())
+				Expect(uploader.Upload()).NotTo(Succeed())
+				report := uploader.Report()
+				Expect(report.Errors).NotTo(BeEmpty())
+				Expect(report.Chunks).To(HaveLen(1))
+				Expect(report.Chunks[0].Etag).To(BeEmpty())
+				Expect(report.UploadedBytes).To(BeZero())
+			})
+		})
+		Context("When tracing", func() {
+			It("Should create chunk, manifest and top-level manifest spans within the upload's span", func() {
+				recorder := tracetest.NewSpanRecorder()
+				provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+				parent, _ := provider.Tracer("test").Start(context.Background(), "parent")
+				uploader, err := NewSloUploader(destination, uint(fileSize/2), "container", "object", tempfile, 1, false, nil,
+					WithTracerProvider(provider))
+				Expect(err).ShouldNot(HaveOccurred())
+				Expect(uploader.UploadContext(parent)).To(Succeed())
+				spans := recorder.Ended()
+				upload := spans[len(spans)-1]
+				Expect(upload.Name()).To(Equal("Upload"))
+				Expect(upload.Parent().SpanID()).To(Equal(trace.SpanContextFromContext(parent).SpanID()))
+				names := make([]string, 0, len(spans)-1)
+				for _, span := range spans[:len(spans)-1] {
+					Expect(span.Parent().SpanID()).To(Equal(upload.SpanContext().SpanID()))
+					names = append(names, span.Name())
+				}
+				Expect(names).To(ConsistOf("UploadChunk", "UploadChunk", "UploadManifest", "UploadManifest"))
+			})
+		})
+		Context("Uploading to an S3-compatible destination", func() {
+			It("Should assemble the file with a multipart upload", func() {
+				server := mock.NewS3Server()
+				httpServer := httptest.NewServer(server)
+				defer httpServer.Close()
+				s3 := auth.NewS3Destination(httpServer.URL, "", "access", "secret")
+				uploader, err := NewSloUploader(s3, uint(fileSize), "bucket", "object", tempfile, 1, false, ioutil.Discard)
+				Expect(err).ShouldNot(HaveOccurred())
+				Expect(server.Bucket("bucket")).To(BeTrue())
+				err = uploader.Upload()
+				Expect(err).ShouldNot(HaveOccurred())
+				fileReadBuffer := make([]byte, fileSize)
+				tempfile.Seek(0, 0)
+				_, err = tempfile.Read(fileReadBuffer)
+				if err != nil {
+					Fail(fmt.Sprintf("Unable to read data from temporary file: %s", err))
+				}
+				data, exists := server.Object("bucket", "object")
+				Expect(exists).To(BeTrue())
+				Expect(data).To(Equal(fileReadBuffer))
+			})
+			It("Should abort the multipart upload if a part cannot be uploaded", func() {
+				server := mock.NewS3Server()
+				httpServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					if r.URL.Query().Get("partNumber") != "" {
+						w.WriteHeader(http.StatusForbidden)
+						return
+					}
+					server.ServeHTTP(w, r)
+				}))
+				defer httpServer.Close()
+				s3 := auth.NewS3Destination(httpServer.URL, "", "access", "secret")
+				uploader, err := NewSloUploader(s3, uint(fileSize), "bucket", "object", tempfile, 1, false, nil)
+				Expect(err).ShouldNot(HaveOccurred())
+				Expect(uploader.Upload()).ShouldNot(Succeed())
+				Expect(server.PendingUploads()).To(Equal(0))
+			})
+			It("Should refuse to store the chunks in another bucket", func() {
+				s3 := auth.NewS3Destination("http://localhost:9000", "", "access", "secret")
+				_, err := NewSloUploader(s3, uint(fileSize), "bucket", "object", tempfile, 1, false, nil,
+					WithSegmentContainer(SegmentContainer("bucket")))
+				Expect(err).Should(HaveOccurred())
 			})
 		})
 	})
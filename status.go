@@ -2,6 +2,8 @@ package swiftlygo
 
 import (
 	"fmt"
+	"github.com/ibmjstart/swiftlygo/pipeline"
+	"sync"
 	"time"
 )
 
@@ -10,22 +12,55 @@ type currentStatus struct {
 	uploadSize     uint
 	totalUploads   uint
 	numberUploaded uint
+	totalBytes     uint
+	bytesUploaded  uint // the size of the chunks that finished uploading
+	bytesInFlight  uint // the data sent so far for chunks that are uploading
+	chunksSkipped  uint
+	bytesSkipped   uint
+	chunksRetried  uint // the number of failed attempts that were retried
+	bytesRetried   uint // the data sent by failed attempts that were retried
+	chunksFailed   uint
+	bytesFailed    uint
+	concurrency    uint // the number of chunks that may upload at once
 	uploadStarted  time.Time
 	uploadDuration time.Duration
 }
 
-// percentComplete computes the percentage of the data that has finished uploading.
+// bytesTransferred is the amount of data that has been sent, including
+// partially uploaded chunks.
+func (s *currentStatus) bytesTransferred() uint {
+	return s.bytesUploaded + s.bytesInFlight
+}
+
+// bytesToUpload is the amount of data that this upload needs to send, which
+// excludes chunks that were already in object storage.
+func (s *currentStatus) bytesToUpload() uint {
+	if s.bytesSkipped >= s.totalBytes {
+		return 0
+	}
+	return s.totalBytes - s.bytesSkipped
+}
+
+// percentComplete computes the percentage of the data that needs to be
+// uploaded that has been uploaded.
 func (s *currentStatus) percentComplete() float64 {
-	if s.totalUploads <= 0 {
+	if s.totalBytes <= 0 {
 		return 0.0
+	} else if s.bytesToUpload() == 0 {
+		return 100.0
 	}
-	return float64(s.numberUploaded) / float64(s.totalUploads) * 100
+	return float64(s.bytesTransferred()) / float64(s.bytesToUpload()) * 100
 }
 
 // timeRemaining computes the amount of upload time that remains based upon the
 // observed upload rate and the amount of data remaining to be uploaded.
 func (s *currentStatus) timeRemaining() time.Duration {
-	finishedIn := int(float64((s.totalUploads-s.numberUploaded)*s.uploadSize) / s.rate())
+	rate := s.rate()
+	done := s.bytesTransferred() + s.bytesFailed
+	if rate <= 0 || done >= s.bytesToUpload() {
+		return 0
+	}
+	finishedIn := int(float64(s.bytesToUpload()-done) / rate)
 	timeRemaining := time.Duration(finishedIn) * time.Second
 	return timeRemaining
 }
@@ -35,10 +70,10 @@ func (s *currentStatus) rate() float64 {
 	if s.uploadStarted == (time.Time{}) {
 		return 0.0
 	} else if s.uploadDuration != (time.Duration(0)) {
-		return float64(s.totalUploads*s.uploadSize) / float64(s.uploadDuration.Seconds())
+		return float64(s.bytesUploaded) / float64(s.uploadDuration.Seconds())
 	}
 	elapsed := time.Since(s.uploadStarted)
-	rate := float64(s.numberUploaded*s.uploadSize) / elapsed.Seconds()
+	rate := float64(s.bytesTransferred()) / elapsed.Seconds()
 	return rate
 }
 
@@ -48,9 +83,12 @@ func (s *currentStatus) String() string {
 		return "Upload not started yet"
 	} else if s.uploadDuration != time.Duration(0) {
 		return fmt.Sprintf(
-			"Upload finished in %s at approximately %2.2f MB/sec",
+			"Upload finished in %s at approximately %2.2f MB/sec (%d chunks uploaded, %d skipped, %d failed)",
 			s.uploadDuration,
-			s.rate()/(1000*1000))
+			s.rate()/(1000*1000),
+			s.numberUploaded,
+			s.chunksSkipped,
+			s.chunksFailed)
 	}
 	return fmt.Sprintf(
 		"[%s] %3.2f%% Uploaded\tAverage Upload Speed %03.2f MB/sec\t%s Remaining",
@@ -62,32 +100,62 @@ func (s *currentStatus) String() string {
 
 type Status struct {
 	current        currentStatus
-	outputChannel  chan string
+	logger         pipeline.Logger
 	chunkCompleted chan struct{}
+	events         chan pipeline.Event
 	requestStatus  chan chan *currentStatus
 	signalStart    chan struct{}
 	signalStop     chan struct{}
+	signalClose    chan struct{}
+	closeOnce      sync.Once
+	done           chan struct{} // closed once the Status stops tracking the upload
 }
 
+// channelLogger sends the message of each log entry to a channel.
+type channelLogger chan string
+
+func (c channelLogger) Debug(msg string, args ...interface{}) { c <- msg }
+func (c channelLogger) Info(msg string, args ...interface{})  { c <- msg }
+func (c channelLogger) Warn(msg string, args ...interface{})  { c <- msg }
+func (c channelLogger) Error(msg string, args ...interface{}) { c <- msg }
+
 // NewStatus creates a new Status with the number of individual
-// uploads and the size of each upload.
+// uploads and the size of each upload. Print sends status messages
+// to the output channel.
 func NewStatus(numberUploads, uploadSize uint, output chan string) *Status {
+	return NewLoggingStatus(numberUploads, uploadSize, channelLogger(output))
+}
+
+// NewLoggingStatus creates a new Status with the number of individual
+// uploads and the size of each upload. Print logs to logger.
+func NewLoggingStatus(numberUploads, uploadSize uint, logger pipeline.Logger) *Status {
 	completed := make(chan struct{})
 	requestStatus := make(chan chan *currentStatus)
 	signalStart, signalStop := make(chan struct{}), make(chan struct{})
 	stat := &Status{
 		chunkCompleted: completed,
+		events:         make(chan pipeline.Event),
 		requestStatus:  requestStatus,
-		outputChannel:  output,
+		logger:         logger,
 		signalStart:    signalStart,
 		signalStop:     signalStop,
+		signalClose:    make(chan struct{}),
+		done:           make(chan struct{}),
 		current: currentStatus{
 			uploadSize:     uploadSize,
 			totalUploads:   numberUploads,
 			numberUploaded: 0,
+			totalBytes:     numberUploads * uploadSize,
 		},
 	}
 	go func(s *Status) {
+		defer close(s.done)
+		// inFlight tracks the bytes sent so far for each chunk that is uploading
+		inFlight := make(map[uint]uint)
+		finishAttempt := func(number uint) {
+			s.current.bytesInFlight -= inFlight[number]
+			delete(inFlight, number)
+		}
 		for {
 			select {
 			case <-s.signalStart:
@@ -98,14 +166,38 @@ func NewStatus(numberUploads, uploadSize uint, output chan string) *Status {
 				s.signalStop = nil
 			case <-s.chunkCompleted:
 				s.current.numberUploaded++
-			case sendBack := <-s.requestStatus:
-				sendBack <- &currentStatus{
-					uploadSize:     s.current.uploadSize,
-					totalUploads:   s.current.totalUploads,
-					numberUploaded: s.current.numberUploaded,
-					uploadStarted:  s.current.uploadStarted,
-					uploadDuration: s.current.uploadDuration,
+				s.current.bytesUploaded += min(s.current.uploadSize, s.current.totalBytes-s.current.bytesUploaded)
+			case event := <-s.events:
+				switch event := event.(type) {
+				case pipeline.UploadStarted:
+					s.current.totalUploads = event.Chunks
+					s.current.totalBytes = event.Bytes
+				case pipeline.ChunkProgress:
+					s.current.bytesInFlight += event.Bytes - inFlight[event.Number]
+					inFlight[event.Number] = event.Bytes
+				case pipeline.ChunkSkipped:
+					s.current.chunksSkipped++
+					s.current.bytesSkipped += event.Bytes
+				case pipeline.ChunkRetried:
+					s.current.chunksRetried++
+					s.current.bytesRetried += inFlight[event.Number]
+					finishAttempt(event.Number)
+				case pipeline.ChunkFailed:
+					finishAttempt(event.Number)
+					s.current.chunksFailed++
+					s.current.bytesFailed += event.Bytes
+				case pipeline.ChunkCompleted:
+					finishAttempt(event.Number)
+					s.current.numberUploaded++
+					s.current.bytesUploaded += event.Bytes
+				case pipeline.ConcurrencyChanged:
+					s.current.concurrency = event.Limit
 				}
+			case sendBack := <-s.requestStatus:
+				snapshot := s.current
+				sendBack <- &snapshot
+			case <-s.signalClose:
+				return
 			}
 		}
 	}(stat)
@@ -114,26 +206,72 @@ func NewStatus(numberUploads, uploadSize uint, output chan string) *Status {
 
 // Start begins timing the upload. Only call this once.
 func (s *Status) Start() {
-	s.signalStart <- struct{}{}
+	select {
+	case s.signalStart <- struct{}{}:
+	case <-s.done:
+	}
 }
 
 // Stop finalizes the duration of the upload. Only call this once.
 func (s *Status) Stop() {
-	s.signalStop <- struct{}{}
+	select {
+	case s.signalStop <- struct{}{}:
+	case <-s.done:
+	}
+}
+
+// Close stops the goroutine that tracks the upload. Afterwards the Status
+// keeps reporting its final state, but ignores anything more that happens.
+// SloUploader closes its Status when the upload finishes. Close may be called
+// more than once.
+func (s *Status) Close() {
+	s.closeOnce.Do(func() {
+		close(s.signalClose)
+	})
+	<-s.done
 }
 
-// UploadComplete marks that one chunk has been uploaded. Call this
-// each time an upload succeeds.
+// UploadComplete marks that one chunk of uploadSize bytes has been uploaded.
+// Call this each time an upload succeeds, unless the Status is observing the
+// upload's events.
 func (s *Status) UploadComplete() {
-	s.chunkCompleted <- struct{}{}
+	select {
+	case s.chunkCompleted <- struct{}{}:
+	case <-s.done:
+	}
+}
+
+// OnEvent updates the Status from the Events of an upload, which lets it
+// track the progress of chunks while they upload and the actual size of each
+// chunk. A Status that observes an upload should not also be told about
+// completed chunks with UploadComplete.
+func (s *Status) OnEvent(event pipeline.Event) {
+	switch event.(type) {
+	case pipeline.UploadStarted, pipeline.ChunkProgress, pipeline.ChunkCompleted,
+		pipeline.ChunkSkipped, pipeline.ChunkRetried, pipeline.ChunkFailed, pipeline.ConcurrencyChanged:
+		select {
+		case s.events <- event:
+		case <-s.done:
+		}
+	}
 }
 
-// getCurrent retrieves a pointer to a copy of the current upload status.
+// Ensure that Status satisfies the interface at compile-time
+var _ pipeline.Observer = &Status{}
+
+// getCurrent retrieves a pointer to a copy of the current upload status, or of
+// the final status once the Status is closed.
 func (s *Status) getCurrent() *currentStatus {
 	stat := make(chan *currentStatus)
 	defer close(stat)
-	s.requestStatus <- stat
-	return <-stat
+	select {
+	case s.requestStatus <- stat:
+		return <-stat
+	case <-s.done:
+		// The goroutine no longer changes current
+		snapshot := s.current
+		return &snapshot
+	}
 }
 
 // NumberUploaded returns how many file chunks have been uploaded.
@@ -152,6 +290,57 @@ func (s *Status) UploadSize() uint {
 	return s.getCurrent().uploadSize
 }
 
+// TotalBytes returns the size of the upload.
+func (s *Status) TotalBytes() uint {
+	return s.getCurrent().totalBytes
+}
+
+// BytesUploaded returns how much data has been sent, including the data sent
+// so far for chunks that have not finished uploading.
+func (s *Status) BytesUploaded() uint {
+	return s.getCurrent().bytesTransferred()
+}
+
+// ChunksSkipped returns how many chunks were not uploaded because they were
+// already in object storage.
+func (s *Status) ChunksSkipped() uint {
+	return s.getCurrent().chunksSkipped
+}
+
+// BytesSkipped returns the size of the chunks that were not uploaded because
+// they were already in object storage.
+func (s *Status) BytesSkipped() uint {
+	return s.getCurrent().bytesSkipped
+}
+
+// ChunksRetried returns how many failed attempts to upload a chunk were
+// followed by another attempt.
+func (s *Status) ChunksRetried() uint {
+	return s.getCurrent().chunksRetried
+}
+
+// BytesRetried returns how much data was sent by attempts to upload a chunk
+// that failed and were retried.
+func (s *Status) BytesRetried() uint {
+	return s.getCurrent().bytesRetried
+}
+
+// ChunksFailed returns how many chunks could not be uploaded.
+func (s *Status) ChunksFailed() uint {
+	return s.getCurrent().chunksFailed
+}
+
+// BytesFailed returns the size of the chunks that could not be uploaded.
+func (s *Status) BytesFailed() uint {
+	return s.getCurrent().bytesFailed
+}
+
+// Concurrency returns how many chunks the upload may currently upload at once,
+// which changes over time if the uploader adapts its concurrency.
+func (s *Status) Concurrency() uint {
+	return s.getCurrent().concurrency
+}
+
 // Rate computes the observed rate of upload in bytes / second.
 func (s *Status) Rate() float64 {
 	return s.getCurrent().rate()
@@ -167,7 +356,9 @@ func (s *Status) TimeRemaining() time.Duration {
 	return s.getCurrent().timeRemaining()
 }
 
-// PercentComplete returns much of the upload is complete.
+// PercentComplete returns how much of the data that this upload needs to send
+// has been sent. Chunks that were skipped because they were already in object
+// storage are not included.
 func (s *Status) PercentComplete() float64 {
 	return s.getCurrent().percentComplete()
 }
@@ -177,7 +368,15 @@ func (s *Status) String() string {
 	return s.getCurrent().String()
 }
 
-// Print sends the current status of the upload to the output channel.
+// Print logs the current status of the upload.
 func (s *Status) Print() {
-	s.outputChannel <- s.String()
+	current := s.getCurrent()
+	s.logger.Info(current.String(),
+		"uploaded", current.numberUploaded,
+		"skipped", current.chunksSkipped,
+		"retried", current.chunksRetried,
+		"failed", current.chunksFailed,
+		"total", current.totalUploads,
+		"concurrency", current.concurrency,
+		"bytes_per_second", current.rate())
 }
@@ -2,6 +2,7 @@ package swiftlygo_test
 
 import (
 	"github.com/ibmjstart/swiftlygo"
+	"github.com/ibmjstart/swiftlygo/pipeline"
 	"time"
 
 	. "github.com/onsi/ginkgo"
@@ -68,6 +69,65 @@ var _ = Describe("Status", func() {
 			Expect(initial).ShouldNot(Equal(s.PercentComplete()))
 		})
 	})
+	Context("When observing an upload's events", func() {
+		It("Should track the bytes sent within chunks", func() {
+			s.Start()
+			s.OnEvent(pipeline.UploadStarted{Chunks: 2, Bytes: 1500})
+			Expect(s.TotalBytes()).To(Equal(uint(1500)))
+			s.OnEvent(pipeline.ChunkProgress{Number: 0, Attempt: 1, Bytes: 300})
+			s.OnEvent(pipeline.ChunkProgress{Number: 0, Attempt: 1, Bytes: 500})
+			Expect(s.BytesUploaded()).To(Equal(uint(500)))
+			Expect(s.PercentComplete()).To(BeNumerically("~", 100.0/3, 0.01))
+			Expect(s.Rate()).To(BeNumerically(">", 0))
+			s.OnEvent(pipeline.ChunkRetried{Number: 0, Attempt: 1})
+			Expect(s.BytesUploaded()).To(BeZero())
+			s.OnEvent(pipeline.ChunkProgress{Number: 0, Attempt: 2, Bytes: 1000})
+			s.OnEvent(pipeline.ChunkCompleted{Number: 0, Attempt: 2, Bytes: 1000})
+			s.OnEvent(pipeline.ChunkProgress{Number: 1, Attempt: 1, Bytes: 500})
+			s.OnEvent(pipeline.ChunkCompleted{Number: 1, Attempt: 1, Bytes: 500})
+			Expect(s.NumberUploaded()).To(Equal(uint(2)))
+			Expect(s.BytesUploaded()).To(Equal(uint(1500)))
+			Expect(s.PercentComplete()).To(Equal(100.0))
+			Expect(s.TimeRemaining()).To(BeZero())
+		})
+	})
+	Context("When chunks are skipped, retried, or fail", func() {
+		It("Should count them separately", func() {
+			s.Start()
+			s.OnEvent(pipeline.UploadStarted{Chunks: 3, Bytes: 3000})
+			s.OnEvent(pipeline.ChunkSkipped{Number: 0, Bytes: 1000})
+			s.OnEvent(pipeline.ChunkProgress{Number: 1, Attempt: 1, Bytes: 400})
+			s.OnEvent(pipeline.ChunkRetried{Number: 1, Attempt: 1})
+			s.OnEvent(pipeline.ChunkProgress{Number: 1, Attempt: 2, Bytes: 1000})
+			s.OnEvent(pipeline.ChunkCompleted{Number: 1, Attempt: 2, Bytes: 1000})
+			Expect(s.PercentComplete()).To(Equal(50.0))
+			s.OnEvent(pipeline.ChunkProgress{Number: 2, Attempt: 1, Bytes: 100})
+			s.OnEvent(pipeline.ChunkFailed{Number: 2, Attempts: 1, Bytes: 1000})
+			Expect(s.NumberUploaded()).To(Equal(uint(1)))
+			Expect(s.BytesUploaded()).To(Equal(uint(1000)))
+			Expect(s.ChunksSkipped()).To(Equal(uint(1)))
+			Expect(s.BytesSkipped()).To(Equal(uint(1000)))
+			Expect(s.ChunksRetried()).To(Equal(uint(1)))
+			Expect(s.BytesRetried()).To(Equal(uint(400)))
+			Expect(s.ChunksFailed()).To(Equal(uint(1)))
+			Expect(s.BytesFailed()).To(Equal(uint(1000)))
+			Expect(s.PercentComplete()).To(Equal(50.0))
+			Expect(s.TimeRemaining()).To(BeZero())
+		})
+	})
+	Context("When it is closed", func() {
+		It("Should keep reporting the final status", func() {
+			s.Start()
+			s.OnEvent(pipeline.ChunkCompleted{Number: 0, Bytes: 1024})
+			s.Close()
+			s.OnEvent(pipeline.ChunkCompleted{Number: 1, Bytes: 1024})
+			s.UploadComplete()
+			s.Stop()
+			Expect(s.NumberUploaded()).To(Equal(uint(1)))
+			Expect(s.BytesUploaded()).To(Equal(uint(1024)))
+			s.Close()
+		})
+	})
 	Context("When Print() is called after Stop()", func() {
 		It("Writes a string to the output channel", func() {
 			s.Start()